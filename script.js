@@ -21,14 +21,12 @@
       tgUser = tg.initDataUnsafe.user;
       tgChatId = tgUser.id;
 
-      // Отправляем chat_id на бэкенд
+      // Отправляем подписанный initData на бэкенд — chat_id сервер возьмёт из него
       fetch('/api/tg/init', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
-          chat_id: tgChatId,
-          first_name: tgUser.first_name,
-          username: tgUser.username,
+          init_data: tg.initData,
           phone: ''
         })
       }).catch(function(err) {
@@ -75,7 +73,238 @@
   var message = document.getElementById('rsvp-message');
   var submitButton = form ? form.querySelector('.rsvp-form__submit') : null;
   var isSubmitting = false;
-  
+  var successMessages = {
+    attending: 'Спасибо! Рады, что вы будете с нами. Ждём на празднике!',
+    maybe: 'Спасибо за ответ! Будем рады, если получится прийти.',
+    declined: 'Спасибо, что предупредили! Очень жаль, что не получится.'
+  };
+
+  // Спутники не нужны, если гость не придёт
+  var statusSelect = document.getElementById('guest-status');
+  var partyRow = document.getElementById('party-row');
+  var partyList = document.getElementById('party-list');
+  var partyAdd = document.getElementById('party-add');
+  var maxParty = 19;
+  var questionsBox = document.getElementById('rsvp-questions');
+  var questions = [];
+  function toggleParty() {
+    if (!statusSelect) return;
+    var declined = statusSelect.value === 'declined';
+    if (partyRow) partyRow.style.display = declined || maxParty === 0 ? 'none' : '';
+    // Скрытые обязательные поля иначе не дадут отправить форму
+    if (questionsBox) {
+      questionsBox.style.display = declined ? 'none' : '';
+      var fields = questionsBox.querySelectorAll('input, select, textarea');
+      for (var i = 0; i < fields.length; i++) fields[i].disabled = declined;
+    }
+  }
+  if (statusSelect) {
+    statusSelect.addEventListener('change', toggleParty);
+  }
+
+  function addPartyMember(member) {
+    if (!partyList || partyList.children.length >= maxParty) return;
+    var item = document.createElement('div');
+    item.className = 'party-member';
+    item.innerHTML =
+      '<div class="party-member__row">' +
+        '<input class="rsvp-form__input party-member__name" type="text" placeholder="Имя и фамилия" maxlength="200">' +
+        '<label class="party-member__child"><input type="checkbox" class="party-member__is-child"> ребёнок</label>' +
+        '<button type="button" class="party-member__remove" aria-label="Убрать">✕</button>' +
+      '</div>' +
+      '<input class="rsvp-form__input party-member__notes" type="text" placeholder="Примечание (необязательно)" maxlength="500">';
+    item.querySelector('.party-member__remove').addEventListener('click', function () {
+      partyList.removeChild(item);
+    });
+    partyList.appendChild(item);
+    if (member) {
+      item.querySelector('.party-member__name').value = member.name || '';
+      item.querySelector('.party-member__is-child').checked = !!member.child;
+      item.querySelector('.party-member__notes').value = member.notes || '';
+    } else {
+      item.querySelector('.party-member__name').focus();
+    }
+  }
+  if (partyAdd) {
+    partyAdd.addEventListener('click', function () { addPartyMember(); });
+  }
+
+  function collectParty() {
+    var out = [];
+    if (!partyList) return out;
+    var items = partyList.querySelectorAll('.party-member');
+    for (var i = 0; i < items.length; i++) {
+      var memberName = items[i].querySelector('.party-member__name').value.trim();
+      if (!memberName) continue;
+      out.push({
+        name: memberName,
+        child: items[i].querySelector('.party-member__is-child').checked,
+        notes: items[i].querySelector('.party-member__notes').value.trim()
+      });
+    }
+    return out;
+  }
+
+  // Дополнительные вопросы приходят с сервера (/api/questions)
+  function renderQuestion(q) {
+    var row = document.createElement('div');
+    row.className = 'rsvp-form__row';
+    var fieldId = 'question-' + q.id;
+    var label = document.createElement(q.type === 'multi' ? 'span' : 'label');
+    label.className = 'rsvp-form__label';
+    label.textContent = q.label + (q.required ? ' *' : '');
+    if (q.type !== 'multi') label.setAttribute('for', fieldId);
+    row.appendChild(label);
+
+    var field;
+    if (q.type === 'choice' || q.type === 'bool') {
+      field = document.createElement('select');
+      field.style.cursor = 'pointer';
+      var options = q.type === 'bool' ? [['', '—'], ['true', 'Да'], ['false', 'Нет']] : [['', '—']].concat(q.options.map(function (o) { return [o, o]; }));
+      options.forEach(function (o) {
+        var opt = document.createElement('option');
+        opt.value = o[0];
+        opt.textContent = o[1];
+        field.appendChild(opt);
+      });
+    } else if (q.type === 'multi') {
+      field = document.createElement('div');
+      q.options.forEach(function (o) {
+        var opt = document.createElement('label');
+        opt.className = 'rsvp-form__option';
+        var box = document.createElement('input');
+        box.type = 'checkbox';
+        box.value = o;
+        opt.appendChild(box);
+        opt.appendChild(document.createTextNode(o));
+        field.appendChild(opt);
+      });
+    } else {
+      field = document.createElement('input');
+      field.type = q.type === 'number' ? 'number' : 'text';
+      if (q.type === 'number') {
+        field.step = 'any';
+        if (q.min != null) field.min = q.min;
+        if (q.max != null) field.max = q.max;
+      }
+      if (q.max_length) field.maxLength = q.max_length;
+    }
+    field.id = fieldId;
+    if (q.type !== 'multi') {
+      field.className = 'rsvp-form__input';
+      field.required = !!q.required;
+    }
+    row.appendChild(field);
+    return row;
+  }
+
+  function collectAnswers() {
+    var out = {};
+    questions.forEach(function (q) {
+      var field = document.getElementById('question-' + q.id);
+      if (!field) return;
+      if (q.type === 'multi') {
+        var picked = [];
+        field.querySelectorAll('input:checked').forEach(function (box) { picked.push(box.value); });
+        if (picked.length) out[q.id] = picked;
+      } else if (q.type === 'bool') {
+        if (field.value) out[q.id] = field.value === 'true';
+      } else if (q.type === 'number') {
+        if (field.value !== '') out[q.id] = parseFloat(field.value);
+      } else if (field.value.trim()) {
+        out[q.id] = field.value.trim();
+      }
+    });
+    return out;
+  }
+
+  // Изменение ответа: токен из ссылки в письме (?edit=) или сохранённый после прошлой отправки
+  var editKey = 'wedding_rsvp_edit';
+  var editToken = new URLSearchParams(window.location.search).get('edit') || '';
+  if (!editToken) {
+    try { editToken = localStorage.getItem(editKey) || ''; } catch (e) {}
+  }
+
+  // Персональное приглашение (?invite=КОД): имя, контакты и сколько человек можно привести
+  var inviteCode = new URLSearchParams(window.location.search).get('invite') || '';
+
+  function loadInvite() {
+    if (!inviteCode || !form) return;
+    return fetch('/api/invitation?code=' + encodeURIComponent(inviteCode))
+      .then(function (res) { return res.json(); })
+      .then(function (data) {
+        if (!data.ok) {
+          inviteCode = '';
+          if (message) {
+            message.textContent = 'Приглашение не найдено. Проверьте ссылку или заполните анкету вручную.';
+            message.classList.add('rsvp-form__message--error');
+            message.classList.add('is-visible');
+          }
+          return;
+        }
+        inviteCode = data.code;
+        if (data.max_party > 0) maxParty = data.max_party - 1;
+        document.getElementById('guest-name').value = data.name || '';
+        document.getElementById('guest-phone').value = data.phone || '';
+        document.getElementById('guest-email').value = data.email || '';
+        // Ответ по приглашению уже есть — открываем его для правки; чужой сохранённый ответ не трогаем
+        editToken = data.edit_token || new URLSearchParams(window.location.search).get('edit') || '';
+        toggleParty();
+      })
+      .catch(function () {});
+  }
+
+  function fillAnswers(answers) {
+    questions.forEach(function (q) {
+      var field = document.getElementById('question-' + q.id);
+      var v = answers[q.id];
+      if (!field || v == null) return;
+      if (q.type === 'multi') {
+        field.querySelectorAll('input').forEach(function (box) { box.checked = v.indexOf(box.value) >= 0; });
+      } else {
+        field.value = String(v);
+      }
+    });
+  }
+
+  function loadEdit() {
+    if (!editToken || !form) return;
+    fetch('/api/rsvp?token=' + encodeURIComponent(editToken))
+      .then(function (res) { return res.json(); })
+      .then(function (data) {
+        if (!data.ok) {
+          editToken = '';
+          try { localStorage.removeItem(editKey); } catch (e) {}
+          return;
+        }
+        document.getElementById('guest-name').value = data.name || '';
+        document.getElementById('guest-phone').value = data.phone || '';
+        document.getElementById('guest-email').value = data.email || '';
+        if (statusSelect) statusSelect.value = data.status || 'attending';
+        if (partyList) partyList.innerHTML = '';
+        (data.party || []).forEach(function (m) { addPartyMember(m); });
+        fillAnswers(data.answers || {});
+        toggleParty();
+        if (submitButton) submitButton.textContent = 'Изменить ответ';
+      })
+      .catch(function () {});
+  }
+
+  if (questionsBox) {
+    fetch('/api/questions')
+      .then(function (res) { return res.json(); })
+      .then(function (data) {
+        questions = (data && data.questions) || [];
+        questions.forEach(function (q) { questionsBox.appendChild(renderQuestion(q)); });
+        toggleParty();
+      })
+      .catch(function () {})
+      .then(loadInvite)
+      .then(loadEdit);
+  } else {
+    Promise.resolve(loadInvite()).then(loadEdit);
+  }
+
   if (form && message) {
     form.addEventListener('submit', function (e) {
       e.preventDefault();
@@ -93,13 +322,23 @@
       var nameInput = document.getElementById('guest-name');
       var phoneInput = document.getElementById('guest-phone');
       var emailInput = document.getElementById('guest-email');
-      var guestCountInput = document.getElementById('guest-count');
+      var statusInput = document.getElementById('guest-status');
       var name = nameInput && nameInput.value ? nameInput.value.trim() : '';
       var phoneRaw = phoneInput && phoneInput.value ? phoneInput.value.replace(/\D/g, '') : '';
       var phone = phoneInput && phoneInput.value ? phoneInput.value.trim() : '';
       var email = emailInput && emailInput.value ? emailInput.value.trim() : '';
-      var guestCount = guestCountInput && guestCountInput.value ? parseInt(guestCountInput.value) : 1;
-      if (!name || !phoneRaw) {
+      var status = statusInput && statusInput.value ? statusInput.value : 'attending';
+      var party = status === 'declined' ? [] : collectParty();
+      var answers = status === 'declined' ? {} : collectAnswers();
+      var missing = status === 'declined' ? null : questions.filter(function (q) {
+        return q.required && q.type === 'multi' && !answers[q.id];
+      })[0];
+      if (missing) {
+        message.textContent = 'Ответьте, пожалуйста, на вопрос «' + missing.label + '».';
+        message.classList.add('rsvp-form__message--error');
+        message.classList.add('is-visible');
+      }
+      if (!name || !phoneRaw || missing) {
         isSubmitting = false;
         if (submitButton) {
           submitButton.disabled = false;
@@ -113,8 +352,12 @@
         name: name, 
         phone: phone, 
         email: email || '',
-        telegram_chat_id: tgChatId || null,
-        guest_count: guestCount
+        telegram_init_data: (tg && tg.initData) || '',
+        status: status,
+        party: party,
+        answers: answers,
+        edit_token: editToken || undefined,
+        invite_code: inviteCode || undefined
       };
       
       fetch('/api/rsvp', {
@@ -122,23 +365,58 @@
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(payload)
       }).then(function (res) {
-        if (res.ok) {
-          message.textContent = 'Спасибо! Рады, что вы будете с нами. Ждём на празднике!';
-          message.classList.remove('rsvp-form__message--error');
-          message.classList.add('is-visible');
-          form.reset();
-          isSubmitting = false;
-          if (submitButton) {
-            submitButton.disabled = false;
-            submitButton.textContent = 'Отправлено';
-            submitButton.style.opacity = '1';
+        return res.json().catch(function () { return {}; }).then(function (data) {
+          if (res.ok) {
+            var wasEditing = !!editToken;
+            editToken = data.edit_token || '';
+            try { localStorage.setItem(editKey, editToken); } catch (e) {}
+            message.textContent = data.updated ? 'Ответ обновлён. Спасибо!' : (successMessages[status] || successMessages.attending);
+            message.classList.remove('rsvp-form__message--error');
+            message.classList.add('is-visible');
+            if (!wasEditing) {
+              form.reset();
+              if (partyList) partyList.innerHTML = '';
+              toggleParty();
+            }
+            isSubmitting = false;
+            if (submitButton) {
+              submitButton.disabled = false;
+              submitButton.textContent = 'Отправлено';
+              submitButton.style.opacity = '1';
+            }
+            return;
+          }
+          // Ошибки, при которых повторять отправку бессмысленно
+          var known = {
+            'already answered': data.edit_link_sent
+              ? 'Вы уже отвечали с этим номером. Мы отправили на вашу почту ссылку, чтобы изменить ответ.'
+              : 'Вы уже отвечали с этим номером. Чтобы изменить ответ, воспользуйтесь ссылкой из письма или свяжитесь с нами.',
+            'link expired': 'Ссылка для изменения ответа устарела. Пожалуйста, свяжитесь с нами.',
+            'invalid link': 'Ссылка для изменения ответа недействительна. Пожалуйста, свяжитесь с нами.',
+            'phone already used': 'С этим номером уже есть другой ответ.',
+            'invalid invitation': 'Приглашение не найдено. Проверьте ссылку из приглашения.',
+            'invitation required': 'Ответить можно по ссылке из персонального приглашения.'
+          };
+          if (data.error && data.error.indexOf('party too large') === 0) {
+            known[data.error] = 'По приглашению можно прийти не больше чем ' + maxParty + (maxParty === 1 ? ' спутником.' : ' спутниками.');
+          }
+          if (known[data.error]) {
+            if (data.error === 'link expired' || data.error === 'invalid link') {
+              editToken = '';
+              try { localStorage.removeItem(editKey); } catch (e) {}
+            }
+            message.textContent = known[data.error];
+            message.classList.add('rsvp-form__message--error');
+            message.classList.add('is-visible');
+            isSubmitting = false;
+            if (submitButton) {
+              submitButton.disabled = false;
+              submitButton.textContent = 'Отправить';
+              submitButton.style.opacity = '1';
+            }
+            return;
           }
-          return;
-        }
-        return res.json().then(function (data) {
           throw new Error(data.error || res.statusText);
-        }).catch(function () {
-          throw new Error(res.statusText);
         });
       }).catch(function (err) {
         try {
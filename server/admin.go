@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// revisionSourceAdmin — правка из админки.
+const revisionSourceAdmin = "admin"
+
+const (
+	adminDefaultPerPage = 50
+	adminMaxPerPage     = 500
+)
+
+// parsePage — ?page= (с 1) и ?per_page= для списков админки.
+func parsePage(q url.Values) (page, perPage int, err error) {
+	page, perPage = 1, adminDefaultPerPage
+	if s := q.Get("page"); s != "" {
+		if page, err = strconv.Atoi(s); err != nil || page < 1 {
+			return 0, 0, errors.New("page must be a positive number")
+		}
+	}
+	if s := q.Get("per_page"); s != "" {
+		if perPage, err = strconv.Atoi(s); err != nil || perPage < 1 || perPage > adminMaxPerPage {
+			return 0, 0, errors.New("per_page must be 1..500")
+		}
+	}
+	return page, perPage, nil
+}
+
+// paginate — страница page списка items.
+func paginate[T any](items []T, page, perPage int) []T {
+	start := (page - 1) * perPage
+	if start >= len(items) {
+		return []T{}
+	}
+	return items[start:min(start+perPage, len(items))]
+}
+
+// matchSearch — поиск без учёта регистра по имени и почте; цифры ищутся в телефоне.
+func matchSearch(q, name, phone, email string) bool {
+	if q == "" {
+		return true
+	}
+	lq := strings.ToLower(q)
+	if strings.Contains(strings.ToLower(name), lq) || strings.Contains(strings.ToLower(email), lq) {
+		return true
+	}
+	digits := normalizePhone(q)
+	return len(digits) >= 3 && strings.Contains(normalizePhone(phone), digits)
+}
+
+// decodeAdminJSON читает тело запроса админки; при ошибке сам отвечает клиенту.
+func decodeAdminJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if ct := r.Header.Get("Content-Type"); !strings.Contains(ct, "application/json") {
+		http.Error(w, `{"error":"content-type must be application/json"}`, http.StatusUnsupportedMediaType)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeAdminJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleAdminRSVPs — /api/admin/rsvps и /api/admin/rsvps/{id} (доступ — см. adminAccess).
+// GET списка: ?q= (имя, почта, цифры телефона), фильтры выгрузки (status, since, has_email), page, per_page.
+// POST — новый ответ, PUT /{id} — замена полей анкеты, DELETE /{id}. Проверки те же, что у /api/rsvp;
+// гостю при этом ничего не отправляется.
+func (a *app) handleAdminRSVPs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		who, ok := a.adminAccess(w, r, "")
+		if !ok {
+			return
+		}
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/rsvps"), "/")
+		switch {
+		case id == "" && r.Method == http.MethodGet:
+			a.adminListRSVPs(w, r)
+		case id == "" && r.Method == http.MethodPost:
+			a.adminCreateRSVP(w, r, who)
+		case id != "" && r.Method == http.MethodGet:
+			entry, ok := a.adminLoadRSVP(w, id)
+			if ok {
+				writeAdminJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "rsvp": entry})
+			}
+		case id != "" && r.Method == http.MethodPut:
+			a.adminUpdateRSVP(w, r, who, id)
+		case id != "" && r.Method == http.MethodDelete:
+			a.adminDeleteRSVP(w, r, who, id)
+		default:
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func (a *app) adminListRSVPs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	flt, err := parseExportFilter(q, a.weddingLocation())
+	if err != nil {
+		httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, perPage, err := parsePage(q)
+	if err != nil {
+		httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := a.rsvps.list()
+	if err != nil {
+		log.Printf("админка: %v", err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	}
+	search := strings.TrimSpace(q.Get("q"))
+	matched := make([]storedRSVP, 0, len(list))
+	for _, entry := range flt.apply(list) {
+		if matchSearch(search, entry.Name, entry.Phone, entry.Email) {
+			// История правок — только в карточке ответа
+			entry.Revisions = nil
+			matched = append(matched, entry)
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":       true,
+		"total":    len(matched),
+		"page":     page,
+		"per_page": perPage,
+		"rsvps":    paginate(matched, page, perPage),
+	})
+}
+
+func (a *app) adminLoadRSVP(w http.ResponseWriter, id string) (*storedRSVP, bool) {
+	entry, found, err := a.rsvps.get(id)
+	if err != nil {
+		log.Printf("админка: загрузка %s: %v", id, err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return nil, false
+	}
+	if !found {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return nil, false
+	}
+	return entry, true
+}
+
+// phoneTaken — телефон уже занят другим ответом (не exceptID).
+func (a *app) phoneTaken(phone, exceptID string) (bool, error) {
+	other, found, err := a.rsvps.findByPhone(phone)
+	if err != nil {
+		return false, err
+	}
+	return found && other.ID != exceptID, nil
+}
+
+func (a *app) adminCreateRSVP(w http.ResponseWriter, r *http.Request, who adminIdentity) {
+	var body RSVPRequest
+	if !decodeAdminJSON(w, r, &body) {
+		return
+	}
+	in, err := a.validateRSVP(body)
+	if err != nil {
+		httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if taken, err := a.phoneTaken(in.phone, ""); err != nil {
+		log.Printf("админка: поиск по телефону: %v", err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	} else if taken {
+		http.Error(w, `{"error":"phone already used"}`, http.StatusConflict)
+		return
+	}
+	saved, err := a.rsvps.create(storedRSVP{
+		ID:         newID(),
+		Name:       in.name,
+		Phone:      in.phone,
+		Email:      in.email,
+		Status:     in.status,
+		Party:      in.party,
+		GuestCount: in.guestCount,
+		Answers:    in.answers,
+		At:         time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("админка: сохранение: %v", err)
+		http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+		return
+	}
+	auditAdmin(a.audit, r, who, auditCreate, nil, &saved)
+	log.Printf("админка: добавлен ответ %s (%s)", saved.Name, saved.Phone)
+	writeAdminJSON(w, http.StatusCreated, map[string]interface{}{"ok": true, "rsvp": saved})
+}
+
+func (a *app) adminUpdateRSVP(w http.ResponseWriter, r *http.Request, who adminIdentity, id string) {
+	var body RSVPRequest
+	if !decodeAdminJSON(w, r, &body) {
+		return
+	}
+	in, err := a.validateRSVP(body)
+	if err != nil {
+		httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	existing, ok := a.adminLoadRSVP(w, id)
+	if !ok {
+		return
+	}
+	if taken, err := a.phoneTaken(in.phone, id); err != nil {
+		log.Printf("админка: поиск по телефону: %v", err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	} else if taken {
+		http.Error(w, `{"error":"phone already used"}`, http.StatusConflict)
+		return
+	}
+	saved := *existing
+	saved.Name, saved.Phone, saved.Email, saved.Status = in.name, in.phone, in.email, in.status
+	saved.Party, saved.GuestCount, saved.Answers = in.party, in.guestCount, in.answers
+	// Отказ отмечается так же, как отмена гостем; снова «придёт» — это уже не отмена
+	now := time.Now()
+	if in.status == statusDeclined {
+		saved.markDeclined(now)
+	} else {
+		saved.CancelledAt = ""
+	}
+	changes := diffRSVP(*existing, saved, a.questions)
+	if len(changes) > 0 {
+		saved.recordRevision(revisionSourceAdmin, changes, now)
+		if err := a.rsvps.update(saved); err != nil {
+			log.Printf("админка: сохранение %s: %v", id, err)
+			http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+			return
+		}
+		auditAdmin(a.audit, r, who, auditUpdate, existing, &saved)
+		log.Printf("админка: изменён ответ %s (%s), полей: %d", saved.Name, saved.Phone, len(changes))
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "rsvp": saved, "changes": changes})
+}
+
+func (a *app) adminDeleteRSVP(w http.ResponseWriter, r *http.Request, who adminIdentity, id string) {
+	entry, ok := a.adminLoadRSVP(w, id)
+	if !ok {
+		return
+	}
+	if err := a.rsvps.delete(id); err != nil {
+		log.Printf("админка: удаление %s: %v", id, err)
+		http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+		return
+	}
+	auditAdmin(a.audit, r, who, auditDelete, entry, nil)
+	// Приглашение снова ждёт ответа
+	if entry.InvitationID != "" {
+		if inv, found, err := a.invitations.get(entry.InvitationID); err == nil && found && inv.RSVPID == id {
+			inv.RSVPID = ""
+			if err := a.invitations.update(*inv); err != nil {
+				log.Printf("админка: приглашение %s: %v", inv.ID, err)
+			}
+		}
+	}
+	log.Printf("админка: удалён ответ %s (%s)", entry.Name, entry.Phone)
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+}
+
+// tgUserRequest — тело POST/PUT для пользователей Telegram.
+type tgUserRequest struct {
+	ChatID int64  `json:"chat_id"`
+	Phone  string `json:"phone"`
+	Name   string `json:"name"`
+}
+
+func validateTgUser(req tgUserRequest) (tgUser, error) {
+	user := tgUser{ChatID: req.ChatID, Phone: normalizePhone(req.Phone), Name: strings.TrimSpace(req.Name)}
+	if user.ChatID == 0 {
+		return user, errors.New("chat_id required")
+	}
+	if len(user.Phone) < 10 {
+		return user, errors.New("phone required, at least 10 digits")
+	}
+	if len(user.Name) > 200 {
+		return user, errors.New("name max 200 chars")
+	}
+	return user, nil
+}
+
+// handleAdminTgUsers — /api/admin/tg-users и /api/admin/tg-users/{chat_id}: список (?q=, page, per_page),
+// POST — добавить, PUT /{chat_id} — изменить телефон и имя, DELETE /{chat_id}.
+func (a *app) handleAdminTgUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := a.adminAccess(w, r, ""); !ok {
+			return
+		}
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/tg-users"), "/")
+		var chatID int64
+		if rest != "" {
+			var err error
+			if chatID, err = strconv.ParseInt(rest, 10, 64); err != nil {
+				http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+				return
+			}
+		}
+		switch {
+		case rest == "" && r.Method == http.MethodGet:
+			a.adminListTgUsers(w, r)
+		case rest == "" && r.Method == http.MethodPost:
+			var req tgUserRequest
+			if !decodeAdminJSON(w, r, &req) {
+				return
+			}
+			a.adminSaveTgUser(w, req, http.StatusCreated)
+		case rest != "" && r.Method == http.MethodGet:
+			user, found := a.tgUsers.getByChatID(chatID)
+			if !found {
+				http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+				return
+			}
+			writeAdminJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "user": user})
+		case rest != "" && r.Method == http.MethodPut:
+			if _, found := a.tgUsers.getByChatID(chatID); !found {
+				http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+				return
+			}
+			var req tgUserRequest
+			if !decodeAdminJSON(w, r, &req) {
+				return
+			}
+			req.ChatID = chatID
+			a.adminSaveTgUser(w, req, http.StatusOK)
+		case rest != "" && r.Method == http.MethodDelete:
+			err := a.tgUsers.delete(chatID)
+			if err == errNotFound {
+				http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Printf("админка: удаление tg %d: %v", chatID, err)
+				http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+				return
+			}
+			log.Printf("админка: удалён пользователь Telegram chat_id=%d", chatID)
+			writeAdminJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+		default:
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func (a *app) adminListTgUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page, perPage, err := parsePage(q)
+	if err != nil {
+		httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	users, err := a.tgUsers.list()
+	if err != nil {
+		log.Printf("админка: %v", err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	}
+	search := strings.TrimSpace(q.Get("q"))
+	matched := make([]tgUser, 0, len(users))
+	for _, u := range users {
+		if matchSearch(search, u.Name, u.Phone, "") || (search != "" && strconv.FormatInt(u.ChatID, 10) == search) {
+			matched = append(matched, u)
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":       true,
+		"total":    len(matched),
+		"page":     page,
+		"per_page": perPage,
+		"users":    paginate(matched, page, perPage),
+	})
+}
+
+// adminSaveTgUser сохраняет пользователя; другая запись с тем же телефоном заменяется, как и при регистрации в боте.
+func (a *app) adminSaveTgUser(w http.ResponseWriter, req tgUserRequest, code int) {
+	user, err := validateTgUser(req)
+	if err != nil {
+		httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.tgUsers.save(user); err != nil {
+		log.Printf("админка: сохранение tg %d: %v", user.ChatID, err)
+		http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("админка: сохранён пользователь Telegram chat_id=%d, phone=%s", user.ChatID, user.Phone)
+	writeAdminJSON(w, code, map[string]interface{}{"ok": true, "user": user})
+}
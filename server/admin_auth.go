@@ -0,0 +1,469 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Роли администраторов: owner — всё, включая учётные записи; planner — правка гостей, приглашений и выгрузка;
+// readonly — только просмотр и выгрузка.
+const (
+	roleOwner    = "owner"
+	rolePlanner  = "planner"
+	roleReadOnly = "readonly"
+)
+
+// adminCookie — cookie сессии панели управления: подписанный токен, живёт adminSessionTTL.
+const (
+	adminCookie       = "wedding_admin"
+	adminSessionTTL   = 12 * time.Hour
+	adminMinPassword  = 8
+	adminCSRFHeader   = "X-CSRF-Token"
+	adminCSRFFormName = "csrf"
+)
+
+// После adminLoginMaxFailures неудачных попыток за adminLoginFailWindow вход под этим логином с этого адреса
+// закрыт до конца окна. Считается по паре логин и адрес: иначе любой, кто знает логин владельца, мог бы
+// держать его вход закрытым, просто вводя неверный пароль. Общий темп попыток с адреса ограничивает loginLimiter.
+const (
+	adminLoginMaxFailures = 10
+	adminLoginFailWindow  = 15 * time.Minute
+)
+
+// loginFailures — неудачные попытки входа по паре логин и адрес клиента.
+type loginFailures struct {
+	mu    sync.Mutex
+	fails map[string][]time.Time
+}
+
+func newLoginFailures() *loginFailures {
+	return &loginFailures{fails: make(map[string][]time.Time)}
+}
+
+func loginFailureKey(login, ip string) string {
+	return strings.ToLower(strings.TrimSpace(login)) + "|" + ip
+}
+
+// recent — попытки за окно; вызывать под mu.
+func (l *loginFailures) recent(key string, now time.Time) []time.Time {
+	cut := now.Add(-adminLoginFailWindow)
+	var kept []time.Time
+	for _, t := range l.fails[key] {
+		if t.After(cut) {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == 0 {
+		delete(l.fails, key)
+	} else {
+		l.fails[key] = kept
+	}
+	return kept
+}
+
+func (l *loginFailures) blocked(login, ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.recent(loginFailureKey(login, ip), time.Now())) >= adminLoginMaxFailures
+}
+
+func (l *loginFailures) fail(login, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	key := loginFailureKey(login, ip)
+	l.fails[key] = append(l.recent(key, now), now)
+	// Перебор логинов и адресов не должен раздувать карту: устаревшие записи выкидываем
+	if len(l.fails) > 1000 {
+		for k := range l.fails {
+			l.recent(k, now)
+		}
+	}
+}
+
+func (l *loginFailures) reset(login, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.fails, loginFailureKey(login, ip))
+}
+
+var adminLoginRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,31}$`)
+
+// adminUser — учётная запись панели управления. Пароль хранится только как bcrypt-хеш.
+type adminUser struct {
+	Login        string `json:"login"`
+	Role         string `json:"role"`
+	PasswordHash string `json:"password_hash"`
+	CreatedAt    string `json:"created_at,omitempty"`
+	// fromConfig — задан в ADMIN_USERS; такие записи не меняются через API и CLI
+	fromConfig bool
+}
+
+// adminIdentity — кто выполняет запрос админки.
+type adminIdentity struct {
+	Login string
+	Role  string
+	// session — вошёл через /admin (cookie), а не по ключу в заголовке; такому запросу нужен CSRF-токен
+	session bool
+	csrf    string
+}
+
+// parseRole — роль из конфига, API или CLI; «read-only» тоже принимается.
+func parseRole(s string) (string, bool) {
+	switch r := strings.ToLower(strings.TrimSpace(s)); r {
+	case roleOwner, rolePlanner, roleReadOnly:
+		return r, true
+	case "read-only", "read_only":
+		return roleReadOnly, true
+	}
+	return "", false
+}
+
+func validateAdminLogin(login string) error {
+	if !adminLoginRe.MatchString(login) {
+		return errors.New("login must be 1-32 characters: a-z, 0-9, '.', '_' and '-'")
+	}
+	return nil
+}
+
+func hashAdminPassword(password string) (string, error) {
+	if len([]rune(password)) < adminMinPassword {
+		return "", fmt.Errorf("password must be at least %d characters", adminMinPassword)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// parseAdminUsers читает ADMIN_USERS: «логин:роль:bcrypt-хеш» через запятую.
+// Хеш печатает команда «wedding-rsvp admin hash»; в .env для docker compose значение берите в одинарные
+// кавычки, иначе $ в хеше будет подставлен как переменная.
+func parseAdminUsers(s string) ([]adminUser, error) {
+	var out []adminUser
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%q: нужен формат логин:роль:хеш", item)
+		}
+		login := strings.ToLower(strings.TrimSpace(parts[0]))
+		if err := validateAdminLogin(login); err != nil {
+			return nil, fmt.Errorf("%q: %v", parts[0], err)
+		}
+		role, ok := parseRole(parts[1])
+		if !ok {
+			return nil, fmt.Errorf("%s: неизвестная роль %q (owner, planner, readonly)", login, parts[1])
+		}
+		hash := strings.TrimSpace(parts[2])
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("%s: это не bcrypt-хеш", login)
+		}
+		if seen[login] {
+			return nil, fmt.Errorf("%s: логин повторяется", login)
+		}
+		seen[login] = true
+		out = append(out, adminUser{Login: login, Role: role, PasswordHash: hash, fromConfig: true})
+	}
+	return out, nil
+}
+
+// adminUser ищет учётную запись: сначала в ADMIN_USERS, потом в хранилище.
+func (a *app) adminUser(login string) (*adminUser, bool, error) {
+	for _, u := range a.configAdmins {
+		if u.Login == login {
+			return &u, true, nil
+		}
+	}
+	if a.admins == nil {
+		return nil, false, nil
+	}
+	return a.admins.get(login)
+}
+
+// listAdminUsers — учётные записи из ADMIN_USERS и из хранилища (одноимённые из хранилища не показываются).
+func (a *app) listAdminUsers() ([]adminUser, error) {
+	out := append([]adminUser(nil), a.configAdmins...)
+	if a.admins == nil {
+		return out, nil
+	}
+	stored, err := a.admins.list()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range stored {
+		if !containsAdmin(out, u.Login) {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func containsAdmin(list []adminUser, login string) bool {
+	for _, u := range list {
+		if u.Login == login {
+			return true
+		}
+	}
+	return false
+}
+
+// dummyPasswordHash — сравнение для несуществующего логина, чтобы по времени ответа нельзя было узнать, есть ли он.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("wedding-rsvp-dummy"), bcrypt.DefaultCost)
+
+// checkAdminPassword возвращает учётную запись, если логин и пароль верны.
+func (a *app) checkAdminPassword(login, password string) (*adminUser, error) {
+	u, found, err := a.adminUser(strings.ToLower(strings.TrimSpace(login)))
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return nil, nil
+	}
+	return u, nil
+}
+
+// sessionID — логин и отпечаток хеша пароля: после смены пароля или удаления записи старые cookie не подходят.
+func (a *app) sessionID(u adminUser) string {
+	return u.Login + ":" + hex.EncodeToString(a.tokens.mac("session:" + u.PasswordHash))[:16]
+}
+
+// csrfToken — токен для изменяющих запросов из панели; выводится из cookie сессии, хранить его не нужно.
+func (a *app) csrfToken(cookie string) string {
+	return hex.EncodeToString(a.tokens.mac("csrf:" + cookie))
+}
+
+// adminIdentify — кто делает запрос: по cookie сессии из /admin. Ключ EXPORT_SECRET здесь не принимается,
+// им можно только выгрузить список (см. exportAccess).
+func (a *app) adminIdentify(r *http.Request) (adminIdentity, bool) {
+	c, err := r.Cookie(adminCookie)
+	if err != nil {
+		return adminIdentity{}, false
+	}
+	id, err := a.tokens.verify(tokenPurposeAdmin, c.Value)
+	if err != nil {
+		return adminIdentity{}, false
+	}
+	login, _, _ := strings.Cut(id, ":")
+	u, found, err := a.adminUser(login)
+	if err != nil {
+		log.Printf("админка: учётная запись %s: %v", login, err)
+		return adminIdentity{}, false
+	}
+	if !found || a.sessionID(*u) != id {
+		return adminIdentity{}, false
+	}
+	return adminIdentity{Login: u.Login, Role: u.Role, session: true, csrf: a.csrfToken(c.Value)}, true
+}
+
+// canWrite — роль может менять данные.
+func (id adminIdentity) canWrite() bool {
+	return id.Role == roleOwner || id.Role == rolePlanner
+}
+
+// exportAccess — доступ к /api/export: ключ EXPORT_SECRET в X-Export-Key (для скриптов, только чтение)
+// или сессия админки. Ключ в адресе (?key=) больше не принимается: он оседает в истории и логах.
+func (a *app) exportAccess(w http.ResponseWriter, r *http.Request) bool {
+	if key := r.Header.Get("X-Export-Key"); key != "" {
+		if a.exportSecret == "" || subtle.ConstantTimeCompare([]byte(key), []byte(a.exportSecret)) != 1 {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	_, ok := a.adminAccess(w, r, "")
+	return ok
+}
+
+// adminAccess проверяет доступ к API админки и сам отвечает клиенту при отказе: 401 без входа,
+// 403 без CSRF-токена у изменяющего запроса из панели или для readonly. minRole — owner для
+// управления учётными записями, planner — для того, что readonly видеть не должен, иначе пусто.
+func (a *app) adminAccess(w http.ResponseWriter, r *http.Request, minRole string) (adminIdentity, bool) {
+	id, ok := a.adminIdentify(r)
+	if !ok {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return id, false
+	}
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if id.session && !safe {
+		got := r.Header.Get(adminCSRFHeader)
+		// из формы — только у обычных форм: multipart-тело нужно обработчику импорта целиком
+		if got == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			got = r.PostFormValue(adminCSRFFormName)
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(id.csrf)) != 1 {
+			http.Error(w, `{"error":"csrf token mismatch"}`, http.StatusForbidden)
+			return id, false
+		}
+	}
+	if (!safe && !id.canWrite()) || (minRole == roleOwner && id.Role != roleOwner) || (minRole == rolePlanner && !id.canWrite()) {
+		http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+		return id, false
+	}
+	return id, true
+}
+
+func (a *app) setAdminCookie(w http.ResponseWriter, r *http.Request, value string, exp time.Time) {
+	c := &http.Cookie{
+		Name:     adminCookie,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   requestIsHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	}
+	if value == "" {
+		c.MaxAge = -1
+	} else {
+		c.Expires = exp
+	}
+	http.SetCookie(w, c)
+}
+
+// handleAdminLogin — POST /admin/login: логин и пароль из формы меняются на cookie сессии.
+func (a *app) handleAdminLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		ip := clientIP(r)
+		if !a.loginLimiter.allow(ip) {
+			http.Redirect(w, r, "/admin?error=too+many+attempts", http.StatusSeeOther)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		login := r.PostFormValue("login")
+		if a.loginFailures.blocked(login, ip) {
+			log.Printf("админка: вход %q с %s отклонён — много неудачных попыток", login, ip)
+			http.Redirect(w, r, "/admin?error=too+many+attempts", http.StatusSeeOther)
+			return
+		}
+		u, err := a.checkAdminPassword(login, r.PostFormValue("password"))
+		if err != nil {
+			log.Printf("админка: вход %s: %v", login, err)
+			http.Error(w, "не удалось проверить пароль", http.StatusInternalServerError)
+			return
+		}
+		if u == nil {
+			a.loginFailures.fail(login, ip)
+			log.Printf("админка: неудачный вход %q с %s", login, ip)
+			http.Redirect(w, r, "/admin?error=wrong+login+or+password", http.StatusSeeOther)
+			return
+		}
+		a.loginFailures.reset(login, ip)
+		exp := time.Now().Add(adminSessionTTL)
+		a.setAdminCookie(w, r, a.tokens.sign(tokenPurposeAdmin, a.sessionID(*u), exp), exp)
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	}
+}
+
+// handleAdminLogout — POST /admin/logout (с CSRF-токеном из формы): удаляет cookie сессии.
+func (a *app) handleAdminLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		id, ok := a.adminIdentify(r)
+		if ok && id.session && subtle.ConstantTimeCompare([]byte(r.PostFormValue(adminCSRFFormName)), []byte(id.csrf)) != 1 {
+			http.Error(w, "csrf token mismatch", http.StatusForbidden)
+			return
+		}
+		a.setAdminCookie(w, r, "", time.Time{})
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	}
+}
+
+// requestIsHTTPS — запрос пришёл по HTTPS напрямую или через прокси (X-Forwarded-Proto).
+func requestIsHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// trustedProxies — адреса и сети из TRUSTED_PROXIES: только от них принимается X-Forwarded-For.
+var trustedProxies []netip.Prefix
+
+// parseTrustedProxies разбирает список адресов или сетей через запятую («127.0.0.1, 10.0.0.0/8»).
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if strings.Contains(part, "/") {
+			p, err := netip.ParsePrefix(part)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(part)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return out, nil
+}
+
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP — адрес клиента без порта (иначе у каждого соединения свой ключ лимита). X-Forwarded-For
+// клиент может подделать, поэтому он читается, только если запрос пришёл от прокси из TRUSTED_PROXIES:
+// клиент — самый правый адрес цепочки, добавленный не нашим прокси.
+func clientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop) {
+			return hop
+		}
+		ip = hop
+	}
+	return ip
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAdminApp() *app {
+	return &app{
+		tokens:       &tokenSigner{key: []byte("test-key")},
+		exportSecret: "sekret",
+		configAdmins: []adminUser{
+			{Login: "boss", Role: roleOwner, PasswordHash: "hash-boss"},
+			{Login: "plan", Role: rolePlanner, PasswordHash: "hash-plan"},
+			{Login: "look", Role: roleReadOnly, PasswordHash: "hash-look"},
+		},
+	}
+}
+
+// sessionCookie — cookie сессии, как её выдаёт handleAdminLogin.
+func sessionCookie(a *app, login string, exp time.Time) string {
+	u, _, _ := a.adminUser(login)
+	return a.tokens.sign(tokenPurposeAdmin, a.sessionID(*u), exp)
+}
+
+func TestAdminAccess(t *testing.T) {
+	a := testAdminApp()
+	future := time.Now().Add(time.Hour)
+	cookies := map[string]string{}
+	for _, login := range []string{"boss", "plan", "look"} {
+		cookies[login] = sessionCookie(a, login, future)
+	}
+	expired := sessionCookie(a, "plan", time.Now().Add(-time.Minute))
+	// пароль сменили — старые сессии больше не действуют
+	stale := a.tokens.sign(tokenPurposeAdmin, "plan:0000000000000000", future)
+
+	tests := []struct {
+		name    string
+		method  string
+		minRole string
+		key     string
+		cookie  string
+		// csrf — "header", "form", "wrong" или пусто
+		csrf string
+		want int
+	}{
+		{"no credentials", http.MethodGet, "", "", "", "", http.StatusUnauthorized},
+		// ключ выгрузки — не вход в админку (см. TestExportAccess)
+		{"export key read", http.MethodGet, "", "sekret", "", "", http.StatusUnauthorized},
+		{"export key write", http.MethodPost, "", "sekret", "", "", http.StatusUnauthorized},
+		{"export key owner-only", http.MethodPost, roleOwner, "sekret", "", "", http.StatusUnauthorized},
+		{"tampered cookie", http.MethodGet, "", "", cookies["plan"] + "x", "", http.StatusUnauthorized},
+		{"expired session", http.MethodGet, "", "", expired, "", http.StatusUnauthorized},
+		{"session after password change", http.MethodGet, "", "", stale, "", http.StatusUnauthorized},
+		{"readonly read", http.MethodGet, "", "", cookies["look"], "", http.StatusOK},
+		{"readonly write", http.MethodPost, "", "", cookies["look"], "header", http.StatusForbidden},
+		{"planner read without csrf", http.MethodGet, "", "", cookies["plan"], "", http.StatusOK},
+		{"planner write without csrf", http.MethodPost, "", "", cookies["plan"], "", http.StatusForbidden},
+		{"planner write wrong csrf", http.MethodPut, "", "", cookies["plan"], "wrong", http.StatusForbidden},
+		{"planner write csrf header", http.MethodPut, "", "", cookies["plan"], "header", http.StatusOK},
+		{"planner write csrf form", http.MethodPost, "", "", cookies["plan"], "form", http.StatusOK},
+		{"planner owner-only", http.MethodGet, roleOwner, "", cookies["plan"], "", http.StatusForbidden},
+		{"owner owner-only write", http.MethodDelete, roleOwner, "", cookies["boss"], "header", http.StatusOK},
+		{"readonly planner-only read", http.MethodGet, rolePlanner, "", cookies["look"], "", http.StatusForbidden},
+		{"planner planner-only read", http.MethodGet, rolePlanner, "", cookies["plan"], "", http.StatusOK},
+		{"owner planner-only read", http.MethodGet, rolePlanner, "", cookies["boss"], "", http.StatusOK},
+		{"owner csrf of other session", http.MethodPost, "", "", cookies["boss"], "wrong", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r *http.Request
+			if tt.csrf == "form" {
+				form := url.Values{adminCSRFFormName: {a.csrfToken(tt.cookie)}}
+				r = httptest.NewRequest(tt.method, "/api/admin/rsvps", strings.NewReader(form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				r = httptest.NewRequest(tt.method, "/api/admin/rsvps", nil)
+			}
+			switch tt.csrf {
+			case "header":
+				r.Header.Set(adminCSRFHeader, a.csrfToken(tt.cookie))
+			case "wrong":
+				r.Header.Set(adminCSRFHeader, a.csrfToken(cookies["look"]))
+			}
+			if tt.key != "" {
+				r.Header.Set("X-Export-Key", tt.key)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: adminCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			if _, ok := a.adminAccess(w, r, tt.minRole); ok {
+				w.WriteHeader(http.StatusOK)
+			}
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestExportAccess(t *testing.T) {
+	a := testAdminApp()
+	look := sessionCookie(a, "look", time.Now().Add(time.Hour))
+	tests := []struct {
+		name   string
+		key    string
+		cookie string
+		want   int
+	}{
+		{"export key", "sekret", "", http.StatusOK},
+		{"wrong export key", "nope", "", http.StatusUnauthorized},
+		{"wrong export key with session", "nope", look, http.StatusUnauthorized},
+		{"readonly session", "", look, http.StatusOK},
+		{"nothing", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/export?format=csv", nil)
+			if tt.key != "" {
+				r.Header.Set("X-Export-Key", tt.key)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: adminCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			if a.exportAccess(w, r) {
+				w.WriteHeader(http.StatusOK)
+			}
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+
+	// без EXPORT_SECRET выгрузка по ключу выключена
+	a.exportSecret = ""
+	r := httptest.NewRequest(http.MethodGet, "/api/export", nil)
+	r.Header.Set("X-Export-Key", "sekret")
+	if a.exportAccess(httptest.NewRecorder(), r) {
+		t.Fatal("export key accepted without EXPORT_SECRET")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	saved := trustedProxies
+	defer func() { trustedProxies = saved }()
+	var err error
+	if trustedProxies, err = parseTrustedProxies("127.0.0.1, 10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"direct", "203.0.113.5:4000", "", "203.0.113.5"},
+		{"spoofed header from client", "203.0.113.5:4000", "1.2.3.4", "203.0.113.5"},
+		{"behind proxy", "127.0.0.1:4000", "198.51.100.7", "198.51.100.7"},
+		{"client prepends fake hop", "127.0.0.1:4000", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"proxy chain", "127.0.0.1:4000", "198.51.100.7, 10.1.2.3", "198.51.100.7"},
+		{"proxy without header", "127.0.0.1:4000", "", "127.0.0.1"},
+		{"ipv6 direct", "[2001:db8::1]:4000", "1.2.3.4", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Fatalf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Fatal("bad prefix accepted")
+	}
+}
+
+func TestLoginFailures(t *testing.T) {
+	l := newLoginFailures()
+	for i := 0; i < adminLoginMaxFailures-1; i++ {
+		l.fail("Boss", "198.51.100.7")
+	}
+	if l.blocked("boss", "198.51.100.7") {
+		t.Fatal("blocked before the limit")
+	}
+	l.fail(" boss ", "198.51.100.7")
+	if !l.blocked("BOSS", "198.51.100.7") {
+		t.Fatal("not blocked after the limit")
+	}
+	// перебор с одного адреса не закрывает вход владельцу с другого
+	if l.blocked("boss", "203.0.113.5") {
+		t.Fatal("login blocked for another address")
+	}
+	if l.blocked("plan", "198.51.100.7") {
+		t.Fatal("other login blocked")
+	}
+	l.reset("boss", "198.51.100.7")
+	if l.blocked("boss", "198.51.100.7") {
+		t.Fatal("still blocked after reset")
+	}
+}
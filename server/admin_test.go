@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminUpdateRSVPDecline(t *testing.T) {
+	a := testReminderApp(t, nil)
+	a.rsvps.create(storedRSVP{ID: "r1", Name: "Анна", Phone: "+7 999 000-00-01", Status: statusAttending})
+	update := func(status string) storedRSVP {
+		t.Helper()
+		body := `{"name":"Анна","phone":"+7 999 000-00-01","status":"` + status + `"}`
+		r := httptest.NewRequest(http.MethodPut, "/api/admin/rsvps/r1", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		a.adminUpdateRSVP(w, r, adminIdentity{Login: "boss", Role: roleOwner}, "r1")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", status, w.Code, w.Body)
+		}
+		entry, _, _ := a.rsvps.get("r1")
+		return *entry
+	}
+
+	declined := update(statusDeclined)
+	if declined.attendance() != statusDeclined || declined.CancelledAt == "" {
+		t.Fatalf("after decline: status %s, cancelled_at %q", declined.attendance(), declined.CancelledAt)
+	}
+	if again := update(statusDeclined); again.CancelledAt != declined.CancelledAt {
+		t.Fatalf("cancelled_at changed on a repeated decline: %q → %q", declined.CancelledAt, again.CancelledAt)
+	}
+	if back := update(statusAttending); back.CancelledAt != "" {
+		t.Fatalf("cancelled_at %q kept after attending again", back.CancelledAt)
+	}
+}
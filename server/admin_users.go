@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// adminUserView — учётная запись в ответе API, без хеша пароля.
+type adminUserView struct {
+	Login     string `json:"login"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"created_at,omitempty"`
+	// Source — config (ADMIN_USERS, только чтение) или store
+	Source string `json:"source"`
+}
+
+func viewAdminUser(u adminUser) adminUserView {
+	v := adminUserView{Login: u.Login, Role: u.Role, CreatedAt: u.CreatedAt, Source: "store"}
+	if u.fromConfig {
+		v.Source = "config"
+	}
+	return v
+}
+
+type adminUserRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// handleAdminUsers — /api/admin/users и /api/admin/users/{login}, только для owner.
+// GET — список; POST {login, password, role} — новая запись; PUT /{login} {password?, role?}; DELETE /{login}.
+// Записи из ADMIN_USERS меняются только в конфиге; свою запись удалить или понизить нельзя.
+func (a *app) handleAdminUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := a.adminAccess(w, r, roleOwner)
+		if !ok {
+			return
+		}
+		login := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/users"), "/")
+		switch {
+		case login == "" && r.Method == http.MethodGet:
+			users, err := a.listAdminUsers()
+			if err != nil {
+				log.Printf("админка: учётные записи: %v", err)
+				http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+				return
+			}
+			out := make([]adminUserView, 0, len(users))
+			for _, u := range users {
+				out = append(out, viewAdminUser(u))
+			}
+			writeAdminJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "users": out})
+		case login == "" && r.Method == http.MethodPost:
+			a.adminCreateUser(w, r)
+		case login != "" && r.Method == http.MethodPut:
+			a.adminUpdateUser(w, r, id, login)
+		case login != "" && r.Method == http.MethodDelete:
+			a.adminDeleteUser(w, id, login)
+		default:
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func (a *app) adminCreateUser(w http.ResponseWriter, r *http.Request) {
+	var body adminUserRequest
+	if !decodeAdminJSON(w, r, &body) {
+		return
+	}
+	u, err := newAdminUser(body.Login, body.Role, body.Password)
+	if err != nil {
+		httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, found, err := a.adminUser(u.Login); err != nil {
+		log.Printf("админка: учётная запись %s: %v", u.Login, err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	} else if found {
+		http.Error(w, `{"error":"login already exists"}`, http.StatusConflict)
+		return
+	}
+	if err := a.admins.save(u); err != nil {
+		log.Printf("админка: сохранить %s: %v", u.Login, err)
+		http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusCreated, map[string]interface{}{"ok": true, "user": viewAdminUser(u)})
+}
+
+func (a *app) adminUpdateUser(w http.ResponseWriter, r *http.Request, id adminIdentity, login string) {
+	var body adminUserRequest
+	if !decodeAdminJSON(w, r, &body) {
+		return
+	}
+	u, ok := a.adminLoadUser(w, login)
+	if !ok {
+		return
+	}
+	if body.Role != "" {
+		role, ok := parseRole(body.Role)
+		if !ok {
+			http.Error(w, `{"error":"role must be owner, planner or readonly"}`, http.StatusBadRequest)
+			return
+		}
+		if u.Login == id.Login && role != roleOwner {
+			http.Error(w, `{"error":"cannot demote yourself"}`, http.StatusBadRequest)
+			return
+		}
+		u.Role = role
+	}
+	if body.Password != "" {
+		hash, err := hashAdminPassword(body.Password)
+		if err != nil {
+			httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		u.PasswordHash = hash
+	}
+	if err := a.admins.save(*u); err != nil {
+		log.Printf("админка: сохранить %s: %v", u.Login, err)
+		http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "user": viewAdminUser(*u)})
+}
+
+func (a *app) adminDeleteUser(w http.ResponseWriter, id adminIdentity, login string) {
+	u, ok := a.adminLoadUser(w, login)
+	if !ok {
+		return
+	}
+	if u.Login == id.Login {
+		http.Error(w, `{"error":"cannot delete yourself"}`, http.StatusBadRequest)
+		return
+	}
+	if err := a.admins.delete(u.Login); err != nil {
+		log.Printf("админка: удалить %s: %v", u.Login, err)
+		http.Error(w, `{"error":"failed to delete"}`, http.StatusInternalServerError)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+}
+
+// adminLoadUser — учётная запись из хранилища для правки; записи из ADMIN_USERS менять нельзя.
+func (a *app) adminLoadUser(w http.ResponseWriter, login string) (*adminUser, bool) {
+	u, found, err := a.adminUser(login)
+	if err != nil {
+		log.Printf("админка: учётная запись %s: %v", login, err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return nil, false
+	}
+	if !found {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return nil, false
+	}
+	if u.fromConfig {
+		http.Error(w, `{"error":"user is defined in ADMIN_USERS"}`, http.StatusConflict)
+		return nil, false
+	}
+	return u, true
+}
+
+// newAdminUser проверяет логин, роль и пароль и возвращает запись с bcrypt-хешем.
+func newAdminUser(login, role, password string) (adminUser, error) {
+	login = strings.ToLower(strings.TrimSpace(login))
+	if err := validateAdminLogin(login); err != nil {
+		return adminUser{}, err
+	}
+	r, ok := parseRole(role)
+	if !ok {
+		return adminUser{}, errors.New("role must be owner, planner or readonly")
+	}
+	hash, err := hashAdminPassword(password)
+	if err != nil {
+		return adminUser{}, err
+	}
+	return adminUser{Login: login, Role: r, PasswordHash: hash, CreatedAt: time.Now().UTC().Format(time.RFC3339)}, nil
+}
+
+// readPassword читает пароль первой строкой из stdin; в терминале — с подсказкой (ввод виден).
+func readPassword(prompt string) (string, error) {
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, prompt)
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", errors.New("пароль не введён")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// runAdminCommand — подкоманда «admin»: учётные записи панели управления в хранилище.
+// Как и import, с json-хранилищем запускайте её при остановленном сервере.
+func runAdminCommand(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, `использование:
+  wedding-rsvp admin add <логин> [owner|planner|readonly]   пароль — из stdin, роль по умолчанию planner
+  wedding-rsvp admin passwd <логин>                          новый пароль — из stdin
+  wedding-rsvp admin role <логин> <роль>
+  wedding-rsvp admin remove <логин>
+  wedding-rsvp admin list
+  wedding-rsvp admin hash                                    bcrypt-хеш пароля из stdin для ADMIN_USERS`)
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	cmd, rest := args[0], args[1:]
+	if cmd == "hash" {
+		password, err := readPassword("пароль: ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		hash, err := hashAdminPassword(password)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(hash)
+		return
+	}
+
+	st, err := openStorage(os.Getenv("STORAGE_DRIVER"), dataPathFromEnv(), strings.TrimSpace(os.Getenv("SQLITE_PATH")))
+	if err != nil {
+		log.Fatalf("хранилище: %v", err)
+	}
+	defer st.close()
+	fail := func(format string, v ...interface{}) {
+		st.close()
+		log.Fatalf(format, v...)
+	}
+	load := func(login string) adminUser {
+		u, found, err := st.admins.get(strings.ToLower(login))
+		if err != nil {
+			fail("%s: %v", login, err)
+		}
+		if !found {
+			fail("%s: нет такой учётной записи", login)
+		}
+		return *u
+	}
+
+	switch {
+	case cmd == "add" && (len(rest) == 1 || len(rest) == 2):
+		role := rolePlanner
+		if len(rest) == 2 {
+			role = rest[1]
+		}
+		if _, found, _ := st.admins.get(strings.ToLower(rest[0])); found {
+			fail("%s: уже есть", rest[0])
+		}
+		password, err := readPassword("пароль: ")
+		if err != nil {
+			fail("%v", err)
+		}
+		u, err := newAdminUser(rest[0], role, password)
+		if err != nil {
+			fail("%v", err)
+		}
+		if err := st.admins.save(u); err != nil {
+			fail("%v", err)
+		}
+		fmt.Printf("создан %s (%s)\n", u.Login, u.Role)
+	case cmd == "passwd" && len(rest) == 1:
+		u := load(rest[0])
+		password, err := readPassword("новый пароль: ")
+		if err != nil {
+			fail("%v", err)
+		}
+		if u.PasswordHash, err = hashAdminPassword(password); err != nil {
+			fail("%v", err)
+		}
+		if err := st.admins.save(u); err != nil {
+			fail("%v", err)
+		}
+		fmt.Printf("пароль %s изменён, его сессии закрыты\n", u.Login)
+	case cmd == "role" && len(rest) == 2:
+		u := load(rest[0])
+		role, ok := parseRole(rest[1])
+		if !ok {
+			fail("неизвестная роль %q (owner, planner, readonly)", rest[1])
+		}
+		u.Role = role
+		if err := st.admins.save(u); err != nil {
+			fail("%v", err)
+		}
+		fmt.Printf("%s теперь %s\n", u.Login, u.Role)
+	case cmd == "remove" && len(rest) == 1:
+		u := load(rest[0])
+		if err := st.admins.delete(u.Login); err != nil {
+			fail("%v", err)
+		}
+		fmt.Printf("%s удалён\n", u.Login)
+	case cmd == "list" && len(rest) == 0:
+		users, err := st.admins.list()
+		if err != nil {
+			fail("%v", err)
+		}
+		for _, u := range users {
+			fmt.Printf("%s\t%s\t%s\n", u.Login, u.Role, u.CreatedAt)
+		}
+	default:
+		st.close()
+		usage()
+	}
+}
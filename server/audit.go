@@ -0,0 +1,156 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Действия в журнале: новый ответ, изменение, повторная отправка без изменений, отказ из-за уже
+// существующего ответа с тем же телефоном, отмена гостем и удаление из админки.
+const (
+	auditCreate    = "create"
+	auditUpdate    = "update"
+	auditUnchanged = "unchanged"
+	auditDuplicate = "duplicate"
+	auditCancel    = "cancel"
+	auditDelete    = "delete"
+)
+
+// Каналы: форма на сайте, Telegram (Web App или бот), ссылка из письма, админка.
+const (
+	auditChannelWeb      = "web"
+	auditChannelTelegram = "telegram"
+	auditChannelEmail    = "email"
+	auditChannelAdmin    = "admin"
+)
+
+// auditActorGuest — действие гостя без Telegram; в админке actor — логин.
+const auditActorGuest = "guest"
+
+// auditEntry — запись журнала. Before и After — ответ до и после (без истории правок);
+// у duplicate в After то, что гость пытался отправить.
+type auditEntry struct {
+	ID      string      `json:"id"`
+	At      string      `json:"at"`
+	Action  string      `json:"action"`
+	Channel string      `json:"channel"`
+	Actor   string      `json:"actor"`
+	IP      string      `json:"ip,omitempty"`
+	RSVPID  string      `json:"rsvp_id,omitempty"`
+	Before  *storedRSVP `json:"before,omitempty"`
+	After   *storedRSVP `json:"after,omitempty"`
+}
+
+// auditStore — журнал изменений ответов: записи только добавляются.
+type auditStore interface {
+	append(e auditEntry) error
+	list() ([]auditEntry, error)
+}
+
+// auditSnapshot — копия ответа для журнала; история правок в журнал не копируется.
+func auditSnapshot(entry *storedRSVP) *storedRSVP {
+	if entry == nil {
+		return nil
+	}
+	c := *entry
+	c.Revisions = nil
+	return &c
+}
+
+// recordAudit пишет запись в журнал. Ошибка журнала не отменяет уже сохранённый ответ — только в лог.
+func recordAudit(store auditStore, e auditEntry) {
+	if store == nil {
+		return
+	}
+	e.ID = newID()
+	e.At = time.Now().UTC().Format(time.RFC3339Nano)
+	e.Before, e.After = auditSnapshot(e.Before), auditSnapshot(e.After)
+	if e.RSVPID == "" && e.After != nil {
+		e.RSVPID = e.After.ID
+	}
+	if e.RSVPID == "" && e.Before != nil {
+		e.RSVPID = e.Before.ID
+	}
+	if err := store.append(e); err != nil {
+		log.Printf("журнал: %s %s %s: %v", e.Action, e.Channel, e.RSVPID, err)
+	}
+}
+
+// auditTelegramActor — actor для действий из Telegram.
+func auditTelegramActor(chatID int64) string {
+	return "tg:" + strconv.FormatInt(chatID, 10)
+}
+
+// auditAdmin — запись о правке из админки: actor — логин (или export-key для запросов с ключом).
+func auditAdmin(store auditStore, r *http.Request, who adminIdentity, action string, before, after *storedRSVP) {
+	recordAudit(store, auditEntry{Action: action, Channel: auditChannelAdmin, Actor: who.Login, IP: clientIP(r), Before: before, After: after})
+}
+
+// handleAdminAudit — GET /api/admin/audit: журнал, новые записи первыми. Фильтры: rsvp_id, action,
+// channel, actor, since (YYYY-MM-DD или RFC3339), q (имя, почта или цифры телефона в ответе до или после правки), page, per_page.
+func (a *app) handleAdminAudit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := a.adminAccess(w, r, ""); !ok {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		page, perPage, err := parsePage(q)
+		if err != nil {
+			httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// since разбирается так же, как в выгрузке
+		flt, err := parseExportFilter(url.Values{"since": {q.Get("since")}}, a.weddingLocation())
+		if err != nil {
+			httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries, err := a.audit.list()
+		if err != nil {
+			log.Printf("журнал: %v", err)
+			http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+			return
+		}
+		rsvpID, action := strings.TrimSpace(q.Get("rsvp_id")), strings.TrimSpace(q.Get("action"))
+		channel, actor := strings.TrimSpace(q.Get("channel")), strings.TrimSpace(q.Get("actor"))
+		search := strings.TrimSpace(q.Get("q"))
+		// записи лежат в порядке добавления, выдаём с конца
+		matched := make([]auditEntry, 0, len(entries))
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			if (rsvpID != "" && e.RSVPID != rsvpID) || (action != "" && e.Action != action) ||
+				(channel != "" && e.Channel != channel) || (actor != "" && e.Actor != actor) {
+				continue
+			}
+			if !flt.since.IsZero() {
+				at, err := time.Parse(time.RFC3339Nano, e.At)
+				if err != nil || at.Before(flt.since) {
+					continue
+				}
+			}
+			if search != "" && !auditMatch(search, e.Before) && !auditMatch(search, e.After) {
+				continue
+			}
+			matched = append(matched, e)
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+			"ok":       true,
+			"total":    len(matched),
+			"page":     page,
+			"per_page": perPage,
+			"entries":  paginate(matched, page, perPage),
+		})
+	}
+}
+
+func auditMatch(q string, entry *storedRSVP) bool {
+	return entry != nil && matchSearch(q, entry.Name, entry.Phone, entry.Email)
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Кому отправить рассылку (поле audience).
+const (
+	// broadcastAttending — все, кто придёт (ответ «приду» или «не уверен(а)»)
+	broadcastAttending = "attending"
+	// broadcastTelegram — те из них, у кого известен чат Telegram; по умолчанию только в Telegram
+	broadcastTelegram = "telegram"
+	// broadcastAnswer — те, кто ответил на вопрос анкеты question ответом answer, например
+	// едущие трансфером: {"audience": "answer", "question": "shuttle", "answer": true}
+	broadcastAnswer = "answer"
+)
+
+// broadcastMaxText — длина сообщения в символах; больше Telegram не примет.
+const broadcastMaxText = 4096
+
+// broadcastNoContact — состояние в отчёте у гостя, которому некуда отправить по выбранным каналам.
+const broadcastNoContact = "no_contact"
+
+var broadcastIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// broadcastRequest — тело POST /api/admin/broadcasts.
+type broadcastRequest struct {
+	// ID — необязательный ключ рассылки: повтор запроса с тем же id не отправит сообщения второй раз
+	ID       string          `json:"id"`
+	Audience string          `json:"audience"`
+	Question string          `json:"question"`
+	Answer   json.RawMessage `json:"answer"`
+	// Channels — email и/или telegram; по умолчанию все настроенные (для audience=telegram — только telegram)
+	Channels []string `json:"channels"`
+	// Subject — тема письма; Text — текст как есть, в письме переводы строк становятся <br>
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	DryRun  bool   `json:"dry_run"`
+}
+
+// broadcastDelivery — строка отчёта о рассылке: сообщение одному получателю.
+type broadcastDelivery struct {
+	// Channel — email или telegram; пусто у гостя без контактов
+	Channel   string `json:"channel,omitempty"`
+	Guest     string `json:"guest"`
+	Name      string `json:"name"`
+	Email     string `json:"email,omitempty"`
+	ChatID    int64  `json:"chat_id,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+	// Status — состояние сообщения в очереди (pending, sent, dead), no_contact или пусто при dry_run
+	Status    string `json:"status,omitempty"`
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+	SentAt    string `json:"sent_at,omitempty"`
+
+	key string
+}
+
+// broadcastFilter — разобранные audience, question и answer.
+type broadcastFilter struct {
+	audience string
+	question string
+	answer   interface{}
+}
+
+// parseBroadcastFilter проверяет аудиторию; ответ на вопрос разбирается по его типу в анкете.
+// У вопроса «да/нет» без answer подразумевается «да», у multi answer — один из вариантов.
+func parseBroadcastFilter(req broadcastRequest, questions []question) (broadcastFilter, error) {
+	f := broadcastFilter{audience: strings.TrimSpace(req.Audience)}
+	switch f.audience {
+	case "":
+		f.audience = broadcastAttending
+	case broadcastAttending, broadcastTelegram:
+	case broadcastAnswer:
+		f.question = strings.TrimSpace(req.Question)
+		var q *question
+		for i := range questions {
+			if questions[i].ID == f.question {
+				q = &questions[i]
+			}
+		}
+		if q == nil {
+			return f, errors.New("unknown question")
+		}
+		raw := req.Answer
+		switch {
+		case q.Type == questionBool && len(raw) == 0:
+			raw = json.RawMessage("true")
+		case q.Type == questionMulti:
+			// вариант multi разбирается как ответ на choice
+			single := *q
+			single.Type = questionChoice
+			q = &single
+		}
+		answer, err := parseAnswer(*q, raw)
+		if err != nil {
+			return f, fmt.Errorf("answer: %v", err)
+		}
+		if answer == nil {
+			return f, errors.New("answer is required")
+		}
+		f.answer = answer
+	default:
+		return f, errors.New("audience must be attending, telegram or answer")
+	}
+	return f, nil
+}
+
+func (f broadcastFilter) matches(entry storedRSVP) bool {
+	if entry.attendance() == statusDeclined {
+		return false
+	}
+	if f.audience != broadcastAnswer {
+		return true
+	}
+	return answerEquals(entry.Answers[f.question], f.answer)
+}
+
+// answerEquals — совпадает ли сохранённый ответ v с want; у multi — отмечен ли вариант want.
+func answerEquals(v, want interface{}) bool {
+	switch v := v.(type) {
+	case []string:
+		for _, s := range v {
+			if s == want {
+				return true
+			}
+		}
+		return false
+	case []interface{}:
+		// так multi читается обратно из JSON
+		for _, s := range v {
+			if s == want {
+				return true
+			}
+		}
+		return false
+	case string:
+		w, ok := want.(string)
+		return ok && strings.EqualFold(v, w)
+	}
+	return v == want
+}
+
+// broadcastChannels — каналы рассылки: указанные в запросе (должны быть настроены) или все настроенные.
+func (a *app) broadcastChannels(req broadcastRequest, audience string) (email, telegram bool, err error) {
+	if len(req.Channels) == 0 {
+		return a.mail != nil && audience != broadcastTelegram, a.tg != nil, nil
+	}
+	for _, c := range req.Channels {
+		switch c {
+		case outboxEmail:
+			if a.mail == nil {
+				return false, false, errors.New("email is not configured")
+			}
+			email = true
+		case outboxTelegram:
+			if a.tg == nil {
+				return false, false, errors.New("telegram bot is not configured")
+			}
+			telegram = true
+		default:
+			return false, false, errors.New("channels must be email and/or telegram")
+		}
+	}
+	return email, telegram, nil
+}
+
+// planBroadcast — сообщения рассылки id по гостям, подходящим под f. Одному адресу или чату,
+// к которому привязано несколько ответов, уходит одно сообщение. В Telegram — только в чат, из которого
+// отправлен ответ (см. guestChatID), а не тому, кто назвал боту телефон гостя.
+func (a *app) planBroadcast(id string, f broadcastFilter, email, telegram bool, rsvps []storedRSVP) []broadcastDelivery {
+	seen := make(map[string]bool)
+	var out []broadcastDelivery
+	for _, entry := range rsvps {
+		if !f.matches(entry) {
+			continue
+		}
+		chatID := a.guestChatID(entry)
+		if f.audience == broadcastTelegram && chatID == 0 {
+			continue
+		}
+		contacted := false
+		if addr := strings.TrimSpace(entry.Email); email && addr != "" {
+			key := "broadcast:" + id + ":" + normalizeEmail(addr) + ":" + outboxEmail
+			if !seen[key] {
+				seen[key] = true
+				out = append(out, broadcastDelivery{Channel: outboxEmail, Guest: entry.ID, Name: entry.Name, Email: addr, key: key})
+			}
+			contacted = true
+		}
+		if telegram && chatID != 0 {
+			key := "broadcast:" + id + ":tg" + strconv.FormatInt(chatID, 10) + ":" + outboxTelegram
+			if !seen[key] {
+				seen[key] = true
+				out = append(out, broadcastDelivery{Channel: outboxTelegram, Guest: entry.ID, Name: entry.Name, ChatID: chatID, key: key})
+			}
+			contacted = true
+		}
+		if !contacted {
+			out = append(out, broadcastDelivery{Guest: entry.ID, Name: entry.Name, Status: broadcastNoContact})
+		}
+	}
+	return out
+}
+
+// broadcastHTML — текст ведущего в письме: экранированный, с переводами строк.
+func broadcastHTML(text string) string {
+	return "<p>" + strings.ReplaceAll(html.EscapeString(text), "\n", "<br>\n") + "</p>"
+}
+
+// handleAdminBroadcasts — /api/admin/broadcasts: GET — отправленные рассылки (page, per_page), новые первыми;
+// POST — разослать сообщение гостям (см. broadcastRequest), с dry_run — только показать, кому уйдёт
+// (counts тогда по каналам);
+// GET /{id} — отчёт о доставке по каждому получателю. Сообщения уходят через очередь уведомлений.
+func (a *app) handleAdminBroadcasts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		who, ok := a.adminAccess(w, r, "")
+		if !ok {
+			return
+		}
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/broadcasts"), "/")
+		switch {
+		case rest == "" && r.Method == http.MethodGet:
+			a.adminListBroadcasts(w, r)
+		case rest == "" && r.Method == http.MethodPost:
+			a.adminSendBroadcast(w, r, who)
+		case rest != "" && !strings.Contains(rest, "/") && r.Method == http.MethodGet:
+			a.adminBroadcastReport(w, rest)
+		default:
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func (a *app) adminSendBroadcast(w http.ResponseWriter, r *http.Request, who adminIdentity) {
+	var req broadcastRequest
+	if !decodeAdminJSON(w, r, &req) {
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	req.Subject = strings.TrimSpace(req.Subject)
+	req.ID = strings.TrimSpace(req.ID)
+	switch {
+	case req.Text == "":
+		http.Error(w, `{"error":"text is required"}`, http.StatusBadRequest)
+		return
+	case len([]rune(req.Text)) > broadcastMaxText:
+		httpErrorJSON(w, fmt.Sprintf("text is too long (max %d chars)", broadcastMaxText), http.StatusBadRequest)
+		return
+	case req.ID != "" && !broadcastIDRe.MatchString(req.ID):
+		http.Error(w, `{"error":"invalid id"}`, http.StatusBadRequest)
+		return
+	}
+	if req.ID == "" {
+		req.ID = newID()
+	}
+	f, err := parseBroadcastFilter(req, a.questions)
+	if err != nil {
+		httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	email, telegram, err := a.broadcastChannels(req, f.audience)
+	if err != nil {
+		httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !email && !telegram {
+		http.Error(w, `{"error":"no channels configured"}`, http.StatusBadRequest)
+		return
+	}
+	if email && req.Subject == "" {
+		http.Error(w, `{"error":"subject is required for email"}`, http.StatusBadRequest)
+		return
+	}
+	rsvps, err := a.rsvps.list()
+	if err != nil {
+		log.Printf("рассылка: %v", err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	}
+
+	deliveries := a.planBroadcast(req.ID, f, email, telegram, rsvps)
+	counts := map[string]int{}
+	for i := range deliveries {
+		d := &deliveries[i]
+		if d.Channel == "" {
+			counts[broadcastNoContact]++
+			continue
+		}
+		if req.DryRun {
+			counts[d.Channel]++
+			continue
+		}
+		m := outboxMessage{Kind: d.Channel, RSVPID: d.Guest, Broadcast: req.ID}
+		if d.Channel == outboxEmail {
+			m.To, m.Subject, m.HTML = d.Email, req.Subject, broadcastHTML(req.Text)
+		} else {
+			m.ChatID, m.Text = d.ChatID, req.Text
+		}
+		if err := a.outbox.enqueueOnce(d.key, m); err != nil {
+			log.Printf("рассылка %s: %v", req.ID, err)
+			http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+			return
+		}
+		d.MessageID = outboxKeyID(d.key)
+		// при повторе с тем же id сообщение могло уже уйти — показываем его текущее состояние
+		if stored, found, err := a.outbox.store.get(d.MessageID); err == nil && found {
+			d.fromMessage(stored)
+		}
+		counts[d.Status]++
+	}
+	if !req.DryRun {
+		log.Printf("рассылка %s (%s, %s): сообщений %d, без контактов %d",
+			req.ID, who.Login, f.audience, len(deliveries)-counts[broadcastNoContact], counts[broadcastNoContact])
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":         true,
+		"broadcast":  req.ID,
+		"dry_run":    req.DryRun,
+		"counts":     counts,
+		"deliveries": deliveries,
+	})
+}
+
+// fromMessage переносит в строку отчёта состояние сообщения из очереди.
+func (d *broadcastDelivery) fromMessage(m *outboxMessage) {
+	d.MessageID, d.Status, d.Attempts, d.LastError, d.SentAt = m.ID, m.Status, m.Attempts, m.LastError, m.SentAt
+}
+
+// broadcastMessages — сообщения очереди, сгруппированные по рассылкам, в порядке постановки.
+func (a *app) broadcastMessages() (map[string][]outboxMessage, error) {
+	list, err := a.outbox.store.list()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]outboxMessage)
+	for _, m := range list {
+		if m.Broadcast != "" {
+			out[m.Broadcast] = append(out[m.Broadcast], m)
+		}
+	}
+	return out, nil
+}
+
+// broadcastSummary — рассылка в списке.
+type broadcastSummary struct {
+	ID        string         `json:"id"`
+	CreatedAt string         `json:"created_at"`
+	Subject   string         `json:"subject,omitempty"`
+	Text      string         `json:"text,omitempty"`
+	Counts    map[string]int `json:"counts"`
+}
+
+func (a *app) adminListBroadcasts(w http.ResponseWriter, r *http.Request) {
+	page, perPage, err := parsePage(r.URL.Query())
+	if err != nil {
+		httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	groups, err := a.broadcastMessages()
+	if err != nil {
+		log.Printf("рассылка: %v", err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	}
+	out := make([]broadcastSummary, 0, len(groups))
+	for id, msgs := range groups {
+		s := broadcastSummary{ID: id, CreatedAt: msgs[0].CreatedAt, Counts: map[string]int{outboxPending: 0, outboxSent: 0, outboxDead: 0}}
+		for _, m := range msgs {
+			s.Counts[m.Status]++
+			if s.Subject == "" {
+				s.Subject = m.Subject
+			}
+			if s.Text == "" {
+				s.Text = m.Text
+			}
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAt != out[j].CreatedAt {
+			return out[i].CreatedAt > out[j].CreatedAt
+		}
+		return out[i].ID < out[j].ID
+	})
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":         true,
+		"total":      len(out),
+		"page":       page,
+		"per_page":   perPage,
+		"broadcasts": paginate(out, page, perPage),
+	})
+}
+
+// adminBroadcastReport — отчёт по рассылке из очереди. Гостей без контактов в нём нет:
+// они видны только в ответе на POST.
+func (a *app) adminBroadcastReport(w http.ResponseWriter, id string) {
+	groups, err := a.broadcastMessages()
+	if err != nil {
+		log.Printf("рассылка %s: %v", id, err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	}
+	msgs, found := groups[id]
+	if !found {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	names := make(map[string]string)
+	if rsvps, err := a.rsvps.list(); err == nil {
+		for _, e := range rsvps {
+			names[e.ID] = e.Name
+		}
+	}
+	counts := map[string]int{outboxPending: 0, outboxSent: 0, outboxDead: 0}
+	deliveries := make([]broadcastDelivery, 0, len(msgs))
+	for i := range msgs {
+		m := &msgs[i]
+		d := broadcastDelivery{Channel: m.Kind, Guest: m.RSVPID, Name: names[m.RSVPID], Email: m.To, ChatID: m.ChatID}
+		d.fromMessage(m)
+		counts[m.Status]++
+		deliveries = append(deliveries, d)
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":         true,
+		"broadcast":  id,
+		"created_at": msgs[0].CreatedAt,
+		"counts":     counts,
+		"deliveries": deliveries,
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBroadcastFilter(t *testing.T) {
+	questions := []question{
+		{ID: "shuttle", Type: questionBool},
+		{ID: "meal", Type: questionChoice, Options: []string{"Мясо", "Рыба"}},
+		{ID: "days", Type: questionMulti, Options: []string{"Пятница", "Суббота"}},
+		{ID: "note", Type: questionText, MaxLength: 100},
+	}
+	tests := []struct {
+		name    string
+		req     broadcastRequest
+		want    broadcastFilter
+		wantErr string
+	}{
+		{"default audience", broadcastRequest{}, broadcastFilter{audience: broadcastAttending}, ""},
+		{"telegram", broadcastRequest{Audience: " telegram "}, broadcastFilter{audience: broadcastTelegram}, ""},
+		{"unknown audience", broadcastRequest{Audience: "everyone"}, broadcastFilter{}, "audience must be"},
+		{"bool defaults to true", broadcastRequest{Audience: broadcastAnswer, Question: "shuttle"}, broadcastFilter{broadcastAnswer, "shuttle", true}, ""},
+		{"bool false", broadcastRequest{Audience: broadcastAnswer, Question: "shuttle", Answer: json.RawMessage("false")}, broadcastFilter{broadcastAnswer, "shuttle", false}, ""},
+		{"choice", broadcastRequest{Audience: broadcastAnswer, Question: "meal", Answer: json.RawMessage(`"Рыба"`)}, broadcastFilter{broadcastAnswer, "meal", "Рыба"}, ""},
+		{"choice unknown option", broadcastRequest{Audience: broadcastAnswer, Question: "meal", Answer: json.RawMessage(`"Суп"`)}, broadcastFilter{}, "unknown option"},
+		{"multi takes one option", broadcastRequest{Audience: broadcastAnswer, Question: "days", Answer: json.RawMessage(`"Суббота"`)}, broadcastFilter{broadcastAnswer, "days", "Суббота"}, ""},
+		{"multi array rejected", broadcastRequest{Audience: broadcastAnswer, Question: "days", Answer: json.RawMessage(`["Суббота"]`)}, broadcastFilter{}, "must be a string"},
+		{"answer required", broadcastRequest{Audience: broadcastAnswer, Question: "meal"}, broadcastFilter{}, "answer is required"},
+		{"blank text answer", broadcastRequest{Audience: broadcastAnswer, Question: "note", Answer: json.RawMessage(`"  "`)}, broadcastFilter{}, "answer is required"},
+		{"unknown question", broadcastRequest{Audience: broadcastAnswer, Question: "hotel"}, broadcastFilter{}, "unknown question"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBroadcastFilter(tt.req, questions)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("filter = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBroadcastFilterMatches(t *testing.T) {
+	f := broadcastFilter{audience: broadcastAnswer, question: "days", answer: "Суббота"}
+	tests := []struct {
+		name  string
+		entry storedRSVP
+		want  bool
+	}{
+		{"picked", storedRSVP{Answers: map[string]interface{}{"days": []string{"Пятница", "Суббота"}}}, true},
+		{"picked, read back from JSON", storedRSVP{Answers: map[string]interface{}{"days": []interface{}{"Суббота"}}}, true},
+		{"not picked", storedRSVP{Answers: map[string]interface{}{"days": []string{"Пятница"}}}, false},
+		{"no answer", storedRSVP{}, false},
+		{"declined", storedRSVP{Status: statusDeclined, Answers: map[string]interface{}{"days": []string{"Суббота"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.matches(tt.entry); got != tt.want {
+				t.Fatalf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanBroadcast(t *testing.T) {
+	chat := func(id int64) *int64 { return &id }
+	rsvps := []storedRSVP{
+		{ID: "r1", Name: "Анна", Email: "anna@example.com", TelegramChatID: chat(100)},
+		// тот же адрес в другом регистре и тот же чат — второго сообщения нет
+		{ID: "r2", Name: "Анна (второй ответ)", Email: " Anna@Example.com ", TelegramChatID: chat(100)},
+		{ID: "r3", Name: "Борис", Email: "boris@example.com"},
+		{ID: "r4", Name: "Вера", TelegramChatID: chat(300)},
+		{ID: "r5", Name: "Глеб", Status: statusDeclined, Email: "gleb@example.com", TelegramChatID: chat(500)},
+		{ID: "r6", Name: "Дина", Status: statusMaybe},
+		// телефон назвал боту чат 666, но ответ не из Telegram
+		{ID: "r7", Name: "Ева", Phone: "+7 999 000-00-07", Email: "eva@example.com"},
+	}
+	type row struct {
+		channel, guest, to string
+	}
+	summarize := func(out []broadcastDelivery) []row {
+		var rows []row
+		for _, d := range out {
+			to := d.Email
+			if d.Channel == outboxTelegram {
+				to = d.key
+			}
+			if d.Status == broadcastNoContact {
+				to = broadcastNoContact
+			}
+			rows = append(rows, row{d.Channel, d.Guest, to})
+		}
+		return rows
+	}
+	tests := []struct {
+		name            string
+		audience        string
+		email, telegram bool
+		want            []row
+	}{
+		{"all channels", broadcastAttending, true, true, []row{
+			{outboxEmail, "r1", "anna@example.com"},
+			{outboxTelegram, "r1", "broadcast:b1:tg100:telegram"},
+			{outboxEmail, "r3", "boris@example.com"},
+			{outboxTelegram, "r4", "broadcast:b1:tg300:telegram"},
+			{"", "r6", broadcastNoContact},
+			{outboxEmail, "r7", "eva@example.com"},
+		}},
+		{"email only", broadcastAttending, true, false, []row{
+			{outboxEmail, "r1", "anna@example.com"},
+			{outboxEmail, "r3", "boris@example.com"},
+			{"", "r4", broadcastNoContact},
+			{"", "r6", broadcastNoContact},
+			{outboxEmail, "r7", "eva@example.com"},
+		}},
+		{"telegram audience skips guests without a chat", broadcastTelegram, false, true, []row{
+			{outboxTelegram, "r1", "broadcast:b1:tg100:telegram"},
+			{outboxTelegram, "r4", "broadcast:b1:tg300:telegram"},
+		}},
+	}
+	st, err := openJSONStorage(filepath.Join(t.TempDir(), "rsvps.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.close()
+	st.tgUsers.save(tgUser{ChatID: 666, Phone: "+7 999 000-00-07"})
+	a := &app{tgUsers: st.tgUsers}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := a.planBroadcast("b1", broadcastFilter{audience: tt.audience}, tt.email, tt.telegram, rsvps)
+			if got := summarize(out); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("plan =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBroadcastHTML(t *testing.T) {
+	got := broadcastHTML("Трансфер в 15:00\n<b>не опаздывайте</b> & до встречи")
+	want := "<p>Трансфер в 15:00<br>\n&lt;b&gt;не опаздывайте&lt;/b&gt; &amp; до встречи</p>"
+	if got != want {
+		t.Fatalf("html = %q, want %q", got, want)
+	}
+}
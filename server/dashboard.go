@@ -0,0 +1,209 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//go:embed admin_dashboard.html
+var dashboardHTML string
+
+var dashboardTmpl = template.Must(template.New("admin").Parse(dashboardHTML))
+
+// dashboardGuest — строка таблицы гостей в панели управления.
+type dashboardGuest struct {
+	ID        string
+	Name      string
+	Phone     string
+	Email     string
+	Status    string
+	Label     string
+	Cancelled bool
+	Headcount int
+	Telegram  bool
+	At        string
+	Reminder  string
+}
+
+type dashboardPage struct {
+	// Login — показать форму входа вместо панели
+	Login bool
+	Error string
+	// User, Role — кто вошёл; CSRF — токен для изменяющих запросов; CanWrite — роль не readonly
+	User     string
+	Role     string
+	CSRF     string
+	CanWrite bool
+	Stats    rsvpStats
+	Guests   []dashboardGuest
+	// WeddingDate — дата из WEDDING_DATE, пусто — напоминания выключены
+	WeddingDate string
+	Formats     []string
+	// Broadcast — форма рассылки (только при CanWrite): какие каналы настроены и по каким ответам можно отобрать гостей
+	Broadcast dashboardBroadcast
+}
+
+type dashboardBroadcast struct {
+	Email    bool
+	Telegram bool
+	Answers  []dashboardBroadcastAnswer
+}
+
+// dashboardBroadcastAnswer — пункт «кому» в форме рассылки: ответ на вопрос анкеты; Answer — значение answer в JSON.
+type dashboardBroadcastAnswer struct {
+	Label    string
+	Question string
+	Answer   string
+}
+
+// broadcastAnswers — по каким ответам можно отобрать гостей: «да» у вопросов да/нет и варианты choice и multi.
+func broadcastAnswers(questions []question) []dashboardBroadcastAnswer {
+	var out []dashboardBroadcastAnswer
+	for _, q := range questions {
+		switch q.Type {
+		case questionBool:
+			out = append(out, dashboardBroadcastAnswer{Label: q.Label + ": да", Question: q.ID, Answer: "true"})
+		case questionChoice, questionMulti:
+			for _, o := range q.Options {
+				answer, _ := json.Marshal(o)
+				out = append(out, dashboardBroadcastAnswer{Label: q.Label + ": " + o, Question: q.ID, Answer: string(answer)})
+			}
+		}
+	}
+	return out
+}
+
+// reminderState — что с напоминаниями этому гостю по каждому правилу: отправлено, дата отправки или уже не будет.
+func (a *app) reminderState(entry storedRSVP, sent map[string]bool, chatID int64) string {
+	if a.weddingDate.IsZero() {
+		return "выключены"
+	}
+	rcpt := reminderRecipient{Guest: entry.ID, Email: strings.TrimSpace(entry.Email), ChatID: chatID}
+	now := time.Now()
+	var parts []string
+	for i := range a.reminderRules {
+		rule := &a.reminderRules[i]
+		if rule.Audience == audienceUnanswered || !reminderMatches(rule, entry) {
+			continue
+		}
+		state := "нет контактов"
+		switch {
+		case reminderSent(sent, rule, rcpt, outboxEmail) || reminderSent(sent, rule, rcpt, outboxTelegram):
+			state = "отправлено"
+		case !(rule.email && rcpt.Email != "" && a.mail != nil) && !(rule.telegram && chatID != 0 && a.tg != nil):
+		case now.After(rule.fireAt(a.weddingDate).Add(a.reminderGrace)):
+			state = "не отправлено"
+		default:
+			state = rule.fireAt(a.weddingDate).Format("02.01.2006 15:04")
+		}
+		parts = append(parts, rule.ID+": "+state)
+	}
+	if len(parts) == 0 {
+		return "не нужно"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// dashboardLoginErrors — тексты для ?error= после неудачного входа.
+var dashboardLoginErrors = map[string]string{
+	"wrong login or password": "Неверный логин или пароль",
+	"too many attempts":       "Слишком много попыток, попробуйте позже",
+}
+
+// handleAdminPage — GET /admin: панель управления. Без входа показывает форму логина и пароля.
+func (a *app) handleAdminPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/admin" && r.URL.Path != "/admin/" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		id, ok := a.adminIdentify(r)
+		if !ok {
+			a.renderDashboard(w, http.StatusOK, dashboardPage{Login: true, Error: dashboardLoginErrors[r.URL.Query().Get("error")]})
+			return
+		}
+		list, err := a.rsvps.list()
+		if err != nil {
+			log.Printf("панель: %v", err)
+			http.Error(w, "не удалось загрузить ответы", http.StatusInternalServerError)
+			return
+		}
+		sent := map[string]bool{}
+		if a.reminders != nil {
+			if sent, err = a.reminders.list(); err != nil {
+				log.Printf("панель: отметки напоминаний: %v", err)
+				sent = map[string]bool{}
+			}
+		}
+		page := dashboardPage{
+			Stats:    a.rsvpStats(list),
+			Guests:   make([]dashboardGuest, 0, len(list)),
+			Formats:  []string{exportFormatXLSX, exportFormatCSV, exportFormatJSON, exportFormatVCF},
+			User:     id.Login,
+			Role:     id.Role,
+			CSRF:     id.csrf,
+			CanWrite: id.canWrite(),
+		}
+		if page.CanWrite {
+			page.Broadcast = dashboardBroadcast{Email: a.mail != nil, Telegram: a.tg != nil, Answers: broadcastAnswers(a.questions)}
+		}
+		if !a.weddingDate.IsZero() {
+			page.WeddingDate = a.weddingDate.Format("02.01.2006")
+		}
+		for _, entry := range list {
+			telegram := a.telegramLinked(entry)
+			page.Guests = append(page.Guests, dashboardGuest{
+				ID:        entry.ID,
+				Name:      entry.Name,
+				Phone:     entry.Phone,
+				Email:     entry.Email,
+				Status:    entry.attendance(),
+				Label:     statusLabel(entry.attendance()),
+				Cancelled: entry.CancelledAt != "",
+				Headcount: entry.headcount(),
+				Telegram:  telegram,
+				At:        formatExportDate(entry.At),
+				Reminder:  a.reminderState(entry, sent, a.guestChatID(entry)),
+			})
+		}
+		a.renderDashboard(w, http.StatusOK, page)
+	}
+}
+
+func (a *app) renderDashboard(w http.ResponseWriter, code int, page dashboardPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := dashboardTmpl.Execute(w, page); err != nil {
+		log.Printf("панель: шаблон: %v", err)
+	}
+}
+
+// handleAdminStats — GET /api/admin/stats: итоги для панели (та же сводка, что в выгрузке).
+func (a *app) handleAdminStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := a.adminAccess(w, r, ""); !ok {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		list, err := a.rsvps.list()
+		if err != nil {
+			log.Printf("админка: %v", err)
+			http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "stats": a.rsvpStats(list)})
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Листы выгрузки
+const (
+	exportSheetSummary   = "Сводка"
+	exportSheetAll       = "Ответы"
+	exportSheetAttending = "Придут"
+	exportSheetMaybe     = "Не уверены"
+	exportSheetDeclined  = "Не придут"
+	exportSheetCancelled = "Отменили"
+)
+
+// exportColumn — столбец листа с ответами.
+type exportColumn struct {
+	title string
+	width float64
+}
+
+// exportColumns — базовые столбцы, к ним справа добавляются дополнительные вопросы.
+var exportColumns = []exportColumn{
+	{"№", 6},
+	{"ФИО", 28},
+	{"Ответ от", 28},
+	{"Возраст", 11},
+	{"Примечание", 28},
+	{"Телефон", 18},
+	{"Почта", 26},
+	{"Статус", 17},
+	{"Гостей", 8},
+	{"Дата", 17},
+}
+
+// exportPhoneCol — номер столбца «Телефон» (с 1): он хранится как текст, чтобы Excel не превращал номера в числа.
+const exportPhoneCol = 6
+
+const exportQuestionWidth = 22
+
+// exportStyles — стили книги, создаются один раз на файл.
+type exportStyles struct {
+	header int
+	text   int
+	title  int
+}
+
+func newExportStyles(f *excelize.File) (exportStyles, error) {
+	var s exportStyles
+	var err error
+	if s.header, err = f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true},
+		Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"F3E3E3"}},
+		Alignment: &excelize.Alignment{Vertical: "center", WrapText: true},
+	}); err != nil {
+		return s, err
+	}
+	// 49 — встроенный формат «@» (текст)
+	if s.text, err = f.NewStyle(&excelize.Style{NumFmt: 49}); err != nil {
+		return s, err
+	}
+	if s.title, err = f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true, Size: 13}}); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// handleExport — GET /api/export: по умолчанию книга xlsx со сводкой, общим листом и листами по статусам;
+// ?format=csv|json|vcf — те же ответы в другом виде. Фильтры (status, since, has_email) — см. parseExportFilter.
+func (a *app) handleExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		if !a.exportAccess(w, r) {
+			return
+		}
+		format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+		if format == "" {
+			format = exportFormatXLSX
+		}
+		switch format {
+		case exportFormatXLSX, exportFormatCSV, exportFormatJSON, exportFormatVCF:
+		default:
+			http.Error(w, `{"error":"format must be xlsx, csv, json or vcf"}`, http.StatusBadRequest)
+			return
+		}
+		flt, err := parseExportFilter(r.URL.Query(), a.weddingLocation())
+		if err != nil {
+			httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		list, err := a.rsvps.list()
+		if err != nil {
+			log.Printf("export list: %v", err)
+			http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+			return
+		}
+		list = flt.apply(list)
+
+		disposition := `attachment; filename="rsvp.` + format + `"`
+		switch format {
+		case exportFormatCSV:
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", disposition)
+			err = a.writeExportCSV(w, list)
+		case exportFormatJSON:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Set("Content-Disposition", disposition)
+			err = a.writeExportJSON(w, list)
+		case exportFormatVCF:
+			w.Header().Set("Content-Type", "text/vcard; charset=utf-8")
+			w.Header().Set("Content-Disposition", disposition)
+			err = writeExportVCF(w, list)
+		default:
+			f, ferr := a.exportWorkbook(list)
+			if ferr != nil {
+				log.Printf("export: %v", ferr)
+				http.Error(w, `{"error":"failed to build export"}`, http.StatusInternalServerError)
+				return
+			}
+			defer f.Close()
+			w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+			w.Header().Set("Content-Disposition", disposition)
+			err = f.Write(w)
+		}
+		if err != nil {
+			log.Printf("export write: %v", err)
+		}
+	}
+}
+
+// exportWorkbook собирает книгу: сводка, все ответы и отдельные листы по статусам.
+// Отменившие по ссылке или в Telegram попадают на свой лист, а не к «Не придут».
+func (a *app) exportWorkbook(list []storedRSVP) (*excelize.File, error) {
+	f := excelize.NewFile()
+	styles, err := newExportStyles(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.SetSheetName("Sheet1", exportSheetSummary); err != nil {
+		return nil, err
+	}
+	if err := a.writeExportSummary(f, styles, list); err != nil {
+		return nil, err
+	}
+
+	var attending, maybe, declined, cancelled []storedRSVP
+	for _, entry := range list {
+		switch {
+		case entry.CancelledAt != "":
+			cancelled = append(cancelled, entry)
+		case entry.attendance() == statusDeclined:
+			declined = append(declined, entry)
+		case entry.attendance() == statusMaybe:
+			maybe = append(maybe, entry)
+		default:
+			attending = append(attending, entry)
+		}
+	}
+	sheets := []struct {
+		name    string
+		entries []storedRSVP
+	}{
+		{exportSheetAll, list},
+		{exportSheetAttending, attending},
+		{exportSheetMaybe, maybe},
+		{exportSheetDeclined, declined},
+		{exportSheetCancelled, cancelled},
+	}
+	for _, s := range sheets {
+		if _, err := f.NewSheet(s.name); err != nil {
+			return nil, err
+		}
+		if err := a.writeExportSheet(f, styles, s.name, s.entries); err != nil {
+			return nil, err
+		}
+	}
+	f.SetActiveSheet(0)
+	return f, nil
+}
+
+// exportHeaders — заголовки таблицы с ответами: базовые столбцы и дополнительные вопросы.
+func (a *app) exportHeaders() []string {
+	headers := make([]string, 0, len(exportColumns)+len(a.questions))
+	for _, c := range exportColumns {
+		headers = append(headers, c.title)
+	}
+	for _, q := range a.questions {
+		headers = append(headers, q.Label)
+	}
+	return headers
+}
+
+// exportRows — одна строка на человека: сначала ответивший, под ним его спутники с тем же № ответа.
+// Дополнительные вопросы — по столбцу на вопрос, ответ в строке ответившего.
+func (a *app) exportRows(entries []storedRSVP) [][]interface{} {
+	var rows [][]interface{}
+	for i, entry := range entries {
+		status := statusLabel(entry.attendance())
+		cells := []interface{}{
+			i + 1, entry.Name, entry.Name, "взрослый", "", entry.Phone, entry.Email, status, entry.headcount(), formatExportDate(entry.At),
+		}
+		for _, q := range a.questions {
+			cells = append(cells, formatAnswer(entry.Answers[q.ID]))
+		}
+		rows = append(rows, cells)
+		for _, m := range exportParty(entry) {
+			age := "взрослый"
+			if m.Child {
+				age = "ребёнок"
+			}
+			rows = append(rows, []interface{}{i + 1, m.Name, entry.Name, age, m.Notes, "", "", status})
+		}
+	}
+	return rows
+}
+
+// writeExportSheet — лист с ответами: жирная закреплённая шапка, автофильтр, ширина столбцов.
+func (a *app) writeExportSheet(f *excelize.File, styles exportStyles, sheet string, entries []storedRSVP) error {
+	headers := a.exportHeaders()
+	if err := f.SetSheetRow(sheet, "A1", &headers); err != nil {
+		return err
+	}
+
+	for i, c := range exportColumns {
+		col, _ := excelize.ColumnNumberToName(i + 1)
+		if err := f.SetColWidth(sheet, col, col, c.width); err != nil {
+			return err
+		}
+	}
+	if len(a.questions) > 0 {
+		first, _ := excelize.ColumnNumberToName(len(exportColumns) + 1)
+		last, _ := excelize.ColumnNumberToName(len(headers))
+		if err := f.SetColWidth(sheet, first, last, exportQuestionWidth); err != nil {
+			return err
+		}
+	}
+	phoneCol, _ := excelize.ColumnNumberToName(exportPhoneCol)
+	if err := f.SetColStyle(sheet, phoneCol, styles.text); err != nil {
+		return err
+	}
+
+	row := 2
+	for _, cells := range a.exportRows(entries) {
+		if err := f.SetSheetRow(sheet, "A"+strconv.Itoa(row), &cells); err != nil {
+			return err
+		}
+		// Телефон явно строкой с текстовым форматом: иначе «+7…» и «8…» Excel может прочитать как число
+		if phone, _ := cells[exportPhoneCol-1].(string); phone != "" {
+			phoneCell, _ := excelize.CoordinatesToCellName(exportPhoneCol, row)
+			if err := f.SetCellStr(sheet, phoneCell, phone); err != nil {
+				return err
+			}
+			if err := f.SetCellStyle(sheet, phoneCell, phoneCell, styles.text); err != nil {
+				return err
+			}
+		}
+		row++
+	}
+
+	lastCol, _ := excelize.ColumnNumberToName(len(headers))
+	if err := f.SetCellStyle(sheet, "A1", lastCol+"1", styles.header); err != nil {
+		return err
+	}
+	if err := f.SetPanes(sheet, &excelize.Panes{
+		Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft",
+	}); err != nil {
+		return err
+	}
+	return f.AutoFilter(sheet, "A1:"+lastCol+strconv.Itoa(max(row-1, 1)), nil)
+}
+
+// writeExportSummary — лист «Сводка»: сколько ответов и гостей, отказы, связь с Telegram
+// и разбивка ответов на дополнительные вопросы (по тем, кто не отказался).
+func (a *app) writeExportSummary(f *excelize.File, styles exportStyles, list []storedRSVP) error {
+	sheet := exportSheetSummary
+	st := a.rsvpStats(list)
+
+	row := 1
+	put := func(values ...interface{}) error {
+		err := f.SetSheetRow(sheet, "A"+strconv.Itoa(row), &values)
+		row++
+		return err
+	}
+	title := func(s string) error {
+		if err := f.SetCellValue(sheet, "A"+strconv.Itoa(row), s); err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(sheet, "A"+strconv.Itoa(row), "A"+strconv.Itoa(row), styles.title); err != nil {
+			return err
+		}
+		row++
+		return nil
+	}
+
+	if err := title("Сводка на " + time.Now().Format("02.01.2006 15:04")); err != nil {
+		return err
+	}
+	for _, line := range [][]interface{}{
+		{"Ответов всего", st.Responses},
+		{"Придут", st.Attending},
+		{"Пока не уверены", st.Maybe},
+		{"Не придут", st.Declined},
+		{"из них отменили", st.Cancelled},
+		{"Гостей всего (придут и не уверены)", st.Headcount},
+		{"из них детей", st.Children},
+		{"Связаны с Telegram", st.Telegram},
+	} {
+		if err := put(line...); err != nil {
+			return err
+		}
+	}
+
+	for _, q := range a.questions {
+		row++
+		if err := title(q.Label); err != nil {
+			return err
+		}
+		counts := make(map[string]int)
+		answered := 0
+		var sum float64
+		for _, entry := range list {
+			if entry.attendance() == statusDeclined {
+				continue
+			}
+			v, ok := entry.Answers[q.ID]
+			if !ok || v == nil {
+				continue
+			}
+			answered++
+			switch v := v.(type) {
+			case []interface{}:
+				for _, o := range v {
+					counts[formatAnswer(o)]++
+				}
+			case []string:
+				for _, o := range v {
+					counts[o]++
+				}
+			case float64:
+				sum += v
+			default:
+				counts[formatAnswer(v)]++
+			}
+		}
+		var lines [][]interface{}
+		switch q.Type {
+		case questionChoice, questionMulti:
+			for _, o := range q.Options {
+				lines = append(lines, []interface{}{o, counts[o]})
+			}
+		case questionBool:
+			lines = append(lines, []interface{}{"да", counts["да"]}, []interface{}{"нет", counts["нет"]})
+		case questionNumber:
+			lines = append(lines, []interface{}{"Сумма", sum})
+		}
+		lines = append(lines, []interface{}{"Ответили", answered})
+		for _, line := range lines {
+			if err := put(line...); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := f.SetColWidth(sheet, "A", "A", 40); err != nil {
+		return err
+	}
+	return f.SetColWidth(sheet, "B", "B", 12)
+}
+
+// rsvpStats — итоги по ответам для сводки и панели управления.
+type rsvpStats struct {
+	Responses int `json:"responses"`
+	Attending int `json:"attending"`
+	Maybe     int `json:"maybe"`
+	Declined  int `json:"declined"`
+	// Cancelled — из Declined те, кто отменил ранее данное согласие
+	Cancelled int `json:"cancelled"`
+	// Headcount — сколько человек придёт, включая не уверенных
+	Headcount int `json:"headcount"`
+	Children  int `json:"children"`
+	Telegram  int `json:"telegram"`
+}
+
+func (a *app) rsvpStats(list []storedRSVP) rsvpStats {
+	st := rsvpStats{Responses: len(list)}
+	for _, entry := range list {
+		switch entry.attendance() {
+		case statusDeclined:
+			st.Declined++
+			if entry.CancelledAt != "" {
+				st.Cancelled++
+			}
+		case statusMaybe:
+			st.Maybe++
+		default:
+			st.Attending++
+		}
+		st.Headcount += entry.headcount()
+		if entry.attendance() != statusDeclined {
+			for _, m := range entry.Party {
+				if m.Child {
+					st.Children++
+				}
+			}
+		}
+		if a.telegramLinked(entry) {
+			st.Telegram++
+		}
+	}
+	return st
+}
+
+// telegramLinked — гость отвечал из Telegram или зарегистрирован у бота по номеру телефона.
+func (a *app) telegramLinked(entry storedRSVP) bool {
+	if entry.TelegramChatID != nil {
+		return true
+	}
+	if a.tgUsers == nil {
+		return false
+	}
+	_, found := a.tgUsers.get(entry.Phone)
+	return found
+}
+
+// exportParty — спутники для выгрузки. У старых записей есть только число гостей,
+// для них добавляются безымянные строки, чтобы людей в таблице было столько же, сколько придёт.
+func exportParty(entry storedRSVP) []partyMember {
+	if entry.attendance() == statusDeclined {
+		return nil
+	}
+	if len(entry.Party) > 0 {
+		return entry.Party
+	}
+	var out []partyMember
+	for i := 1; i < entry.headcount(); i++ {
+		out = append(out, partyMember{Name: "(имя не указано)"})
+	}
+	return out
+}
+
+// formatExportDate переводит RFC3339 (2026-02-13T18:55:36Z) в вид "13.02.2026 18:55"
+func formatExportDate(s string) string {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	return t.Format("02.01.2006 15:04")
+}
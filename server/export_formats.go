@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Форматы выгрузки: ?format=
+const (
+	exportFormatXLSX = "xlsx"
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json"
+	exportFormatVCF  = "vcf"
+)
+
+// exportCancelled — значение фильтра status для отменивших по ссылке или в Telegram.
+const exportCancelled = "cancelled"
+
+// exportFilter — какие ответы попадают в выгрузку; общий для всех форматов.
+type exportFilter struct {
+	// statuses — attending, maybe, declined, cancelled; пусто — все
+	statuses map[string]bool
+	since    time.Time
+	hasEmail bool
+}
+
+// parseExportFilter читает фильтры из запроса: status=attending,maybe; since=2026-05-01 (полночь в loc)
+// или RFC3339; has_email=1. Текст ошибки уходит клиенту как есть.
+func parseExportFilter(q url.Values, loc *time.Location) (exportFilter, error) {
+	var flt exportFilter
+	if s := strings.TrimSpace(q.Get("status")); s != "" {
+		flt.statuses = make(map[string]bool)
+		for _, st := range strings.Split(s, ",") {
+			st = strings.TrimSpace(st)
+			switch st {
+			case statusAttending, statusMaybe, statusDeclined, exportCancelled:
+				flt.statuses[st] = true
+			default:
+				return flt, fmt.Errorf("unknown status %q (attending, maybe, declined, cancelled)", st)
+			}
+		}
+	}
+	if s := strings.TrimSpace(q.Get("since")); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			t, err = time.Parse(time.RFC3339, s)
+		}
+		if err != nil {
+			return flt, errors.New("since must be YYYY-MM-DD or RFC3339")
+		}
+		flt.since = t
+	}
+	flt.hasEmail, _ = strconv.ParseBool(q.Get("has_email"))
+	return flt, nil
+}
+
+// match — ответ проходит фильтр. declined включает и отменивших, cancelled — только их.
+func (flt exportFilter) match(entry storedRSVP) bool {
+	if flt.statuses != nil && !flt.statuses[entry.attendance()] && !(flt.statuses[exportCancelled] && entry.CancelledAt != "") {
+		return false
+	}
+	if !flt.since.IsZero() {
+		at, err := time.Parse(time.RFC3339, entry.At)
+		if err != nil || at.Before(flt.since) {
+			return false
+		}
+	}
+	if flt.hasEmail && strings.TrimSpace(entry.Email) == "" {
+		return false
+	}
+	return true
+}
+
+// weddingLocation — часовой пояс свадьбы (WEDDING_TIMEZONE), в нём гости и вы считаете дни.
+// Без WEDDING_DATE дата нулевая и пояса не хранит — тогда пояс сервера.
+func (a *app) weddingLocation() *time.Location {
+	if a.weddingDate.IsZero() {
+		return time.Local
+	}
+	return a.weddingDate.Location()
+}
+
+func (flt exportFilter) apply(list []storedRSVP) []storedRSVP {
+	out := make([]storedRSVP, 0, len(list))
+	for _, entry := range list {
+		if flt.match(entry) {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// writeExportCSV — те же столбцы, что на листе «Ответы». UTF-8 с BOM, чтобы Excel в Windows не испортил кириллицу.
+func (a *app) writeExportCSV(w io.Writer, list []storedRSVP) error {
+	if _, err := io.WriteString(w, "\xef\xbb\xbf"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(a.exportHeaders()); err != nil {
+		return err
+	}
+	for _, cells := range a.exportRows(list) {
+		record := make([]string, len(cells))
+		for i, c := range cells {
+			if str, ok := c.(string); ok {
+				record[i] = csvSafe(str)
+			} else {
+				record[i] = fmt.Sprint(c)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvSafe — текст, который Excel не примет за формулу: имена и ответы вводят гости.
+// Апостроф в начале Excel не показывает, но другие программы (импорт контактов и т. п.) оставляют его в значении,
+// поэтому телефоны вроде «+7 999 000-00-00» идут как есть: из цифр, пробелов, скобок и дефисов формулу,
+// которая что-то вызовет, не собрать.
+func csvSafe(s string) string {
+	if s == "" || !strings.ContainsRune("=+-@\t\r", rune(s[0])) || isPlainPhone(s) {
+		return s
+	}
+	return "'" + s
+}
+
+// isPlainPhone — «+» и дальше только цифры, пробелы, скобки и дефисы, хотя бы одна цифра.
+func isPlainPhone(s string) bool {
+	if !strings.HasPrefix(s, "+") {
+		return false
+	}
+	digits := 0
+	for _, r := range s[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == ' ' || r == '(' || r == ')' || r == '-':
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// exportJSONEntry — ответ в JSON-выгрузке; история правок не выгружается.
+type exportJSONEntry struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Phone       string                 `json:"phone"`
+	Email       string                 `json:"email,omitempty"`
+	Status      string                 `json:"status"`
+	Cancelled   bool                   `json:"cancelled"`
+	GuestCount  int                    `json:"guest_count"`
+	Party       []partyMember          `json:"party"`
+	Answers     map[string]interface{} `json:"answers"`
+	Telegram    bool                   `json:"telegram"`
+	At          string                 `json:"at"`
+	UpdatedAt   string                 `json:"updated_at,omitempty"`
+	CancelledAt string                 `json:"cancelled_at,omitempty"`
+}
+
+func (a *app) writeExportJSON(w io.Writer, list []storedRSVP) error {
+	out := make([]exportJSONEntry, 0, len(list))
+	for _, entry := range list {
+		item := exportJSONEntry{
+			ID:          entry.ID,
+			Name:        entry.Name,
+			Phone:       entry.Phone,
+			Email:       entry.Email,
+			Status:      entry.attendance(),
+			Cancelled:   entry.CancelledAt != "",
+			GuestCount:  entry.headcount(),
+			Party:       exportParty(entry),
+			Answers:     entry.Answers,
+			Telegram:    a.telegramLinked(entry),
+			At:          entry.At,
+			UpdatedAt:   entry.UpdatedAt,
+			CancelledAt: entry.CancelledAt,
+		}
+		if item.Party == nil {
+			item.Party = []partyMember{}
+		}
+		if item.Answers == nil {
+			item.Answers = map[string]interface{}{}
+		}
+		out = append(out, item)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{"rsvps": out})
+}
+
+// writeExportVCF — по визитке vCard 3.0 на ответившего: имя, телефон, почта и статус в заметке.
+// Спутники без контактов в визитки не попадают.
+func writeExportVCF(w io.Writer, list []storedRSVP) error {
+	var b strings.Builder
+	for _, entry := range list {
+		note := statusLabel(entry.attendance())
+		if entry.attendance() != statusDeclined {
+			note += fmt.Sprintf(", гостей: %d", entry.headcount())
+		}
+		lines := []string{
+			"BEGIN:VCARD",
+			"VERSION:3.0",
+			"FN:" + vcardEscape(entry.Name),
+			"N:" + vcardEscape(entry.Name) + ";;;;",
+		}
+		if entry.Phone != "" {
+			lines = append(lines, "TEL;TYPE=CELL:"+vcardEscape(entry.Phone))
+		}
+		if entry.Email != "" {
+			lines = append(lines, "EMAIL;TYPE=INTERNET:"+vcardEscape(entry.Email))
+		}
+		lines = append(lines, "CATEGORIES:Свадьба", "NOTE:"+vcardEscape("Свадьба: "+note), "END:VCARD")
+		for _, l := range lines {
+			b.WriteString(vcardFold(l))
+			b.WriteString("\r\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var vcardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`, "\r", "")
+
+func vcardEscape(s string) string {
+	return vcardEscaper.Replace(s)
+}
+
+// vcardFold переносит строки длиннее 75 байт (RFC 2425), не разрывая символы UTF-8.
+func vcardFold(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if n+size > limit {
+			b.WriteString("\r\n ")
+			// пробел в начале продолжения тоже считается
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
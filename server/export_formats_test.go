@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Анна", "Анна"},
+		{"", ""},
+		{"+7 999 000-00-01", "+7 999 000-00-01"},
+		{"+7 (999) 000-00-01", "+7 (999) 000-00-01"},
+		{"+79990000001", "+79990000001"},
+		{"+", "'+"},
+		{"+7+cmd|' /C calc'!A0", "'+7+cmd|' /C calc'!A0"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+	}
+	for _, tt := range tests {
+		if got := csvSafe(tt.in); got != tt.want {
+			t.Errorf("csvSafe(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseExportFilterSinceInWeddingZone(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip(err)
+	}
+	flt, err := parseExportFilter(url.Values{"since": {"2026-05-01"}}, moscow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 30 апреля 21:30 UTC — уже 1 мая в Москве
+	if !flt.match(storedRSVP{Status: statusAttending, At: "2026-04-30T21:30:00Z"}) {
+		t.Error("answer after midnight in Moscow is filtered out")
+	}
+	if flt.match(storedRSVP{Status: statusAttending, At: "2026-04-30T20:30:00Z"}) {
+		t.Error("answer before midnight in Moscow passes the filter")
+	}
+	if a := (&app{}); a.weddingLocation() != time.Local {
+		t.Error("without WEDDING_DATE the server zone is used")
+	}
+}
@@ -3,8 +3,10 @@ module wedding-rsvp
 go 1.23
 
 require (
+	github.com/mattn/go-sqlite3 v1.14.52
 	github.com/resend/resend-go/v2 v2.28.0
 	github.com/xuri/excelize/v2 v2.8.1
+	golang.org/x/crypto v0.19.0
 )
 
 require (
@@ -13,7 +15,6 @@ require (
 	github.com/richardlehane/msoleps v1.0.3 // indirect
 	github.com/xuri/efp v0.0.0-20231025114914-d1ff6096ae53 // indirect
 	github.com/xuri/nfp v0.0.0-20230919160717-d98342af3f05 // indirect
-	golang.org/x/crypto v0.19.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
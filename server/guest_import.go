@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxImportSize — предел для загружаемого файла со списком гостей.
+const maxImportSize = 10 << 20
+
+// Поля приглашения, которые можно взять из таблицы
+const (
+	importFieldName     = "name"
+	importFieldPhone    = "phone"
+	importFieldEmail    = "email"
+	importFieldMaxParty = "max_party"
+)
+
+// importColumnAliases — заголовки, по которым колонки находятся без явного сопоставления.
+var importColumnAliases = map[string][]string{
+	importFieldName:     {"name", "имя", "фио", "гость", "семья"},
+	importFieldPhone:    {"phone", "телефон", "тел", "тел."},
+	importFieldEmail:    {"email", "e-mail", "почта"},
+	importFieldMaxParty: {"max_party", "гостей", "мест", "количество"},
+}
+
+var columnLetterRe = regexp.MustCompile(`^[A-Za-z]{1,3}$`)
+
+// importRow — строка таблицы со списком гостей; Row — номер строки в файле (с 1).
+type importRow struct {
+	Row int
+	invitationImport
+	// maxPartySet — количество указано (пустая ячейка лимит не меняет)
+	maxPartySet bool
+	// invalid — почему строка не годится, если её не удалось разобрать
+	invalid string
+}
+
+// Что импорт сделает со строкой
+const (
+	importCreate = "create"
+	importUpdate = "update"
+	importSkip   = "skip"
+)
+
+// importReasonUnchanged — строка совпала с приглашением, и менять в нём нечего.
+const importReasonUnchanged = "unchanged"
+
+// importResult — решение по одной строке импорта.
+type importResult struct {
+	Row    int    `json:"row"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+	Name   string `json:"name"`
+	Phone  string `json:"phone,omitempty"`
+	Code   string `json:"code,omitempty"`
+	inv    invitation
+}
+
+// importReport — итог импорта или пробного прогона.
+type importReport struct {
+	DryRun  bool           `json:"dry_run"`
+	Created int            `json:"created"`
+	Updated int            `json:"updated"`
+	Skipped int            `json:"skipped"`
+	Rows    []importResult `json:"rows"`
+}
+
+// parseColumnMap разбирает сопоставление колонок «name=ФИО,phone=Телефон,max_party=C»:
+// справа — заголовок колонки или её буква.
+func parseColumnMap(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		field, col, ok := strings.Cut(part, "=")
+		field = strings.TrimSpace(field)
+		if !ok || strings.TrimSpace(col) == "" {
+			return nil, fmt.Errorf("columns: %q must be field=column", part)
+		}
+		if _, known := importColumnAliases[field]; !known {
+			return nil, fmt.Errorf("columns: unknown field %q (name, phone, email, max_party)", field)
+		}
+		out[field] = strings.TrimSpace(col)
+	}
+	return out, nil
+}
+
+// importFormat — формат файла по явному значению, расширению имени или Content-Type.
+func importFormat(format, filename, contentType string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".xlsx":
+			format = "xlsx"
+		case ".csv":
+			format = "csv"
+		}
+	}
+	if format == "" {
+		switch {
+		case strings.Contains(contentType, "spreadsheetml"):
+			format = "xlsx"
+		case strings.Contains(contentType, "csv"):
+			format = "csv"
+		}
+	}
+	if format != "xlsx" && format != "csv" {
+		return "", errors.New("format must be xlsx or csv")
+	}
+	return format, nil
+}
+
+// readGuestTable читает таблицу целиком: для xlsx — лист sheet (по умолчанию первый).
+func readGuestTable(data []byte, format, sheet string) ([][]string, error) {
+	if format == "xlsx" {
+		f, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("xlsx: %w", err)
+		}
+		defer f.Close()
+		if sheet == "" {
+			sheet = f.GetSheetName(0)
+		}
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("xlsx: %w", err)
+		}
+		return rows, nil
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	cr := csv.NewReader(bytes.NewReader(data))
+	// Excel с русской локалью сохраняет CSV через точку с запятой
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+	return rows, nil
+}
+
+// mapGuestRows находит строку заголовков (первую непустую) и разбирает строки под ней.
+func mapGuestRows(table [][]string, columns map[string]string) ([]importRow, error) {
+	header := -1
+	for i, row := range table {
+		if !blankRow(row) {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	idx := make(map[string]int)
+	for field, aliases := range importColumnAliases {
+		want, explicit := columns[field]
+		col := -1
+		if explicit {
+			col = headerIndex(table[header], []string{want})
+			if col < 0 && columnLetterRe.MatchString(want) {
+				if n, err := excelize.ColumnNameToNumber(strings.ToUpper(want)); err == nil {
+					col = n - 1
+				}
+			}
+			if col < 0 {
+				return nil, fmt.Errorf("column %q not found", want)
+			}
+		} else {
+			col = headerIndex(table[header], aliases)
+		}
+		if col >= 0 {
+			idx[field] = col
+		}
+	}
+	if _, ok := idx[importFieldName]; !ok {
+		return nil, errors.New("name column not found")
+	}
+
+	cell := func(row []string, field string) string {
+		col, ok := idx[field]
+		if !ok || col >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[col])
+	}
+	var out []importRow
+	for i := header + 1; i < len(table); i++ {
+		row := table[i]
+		if blankRow(row) {
+			continue
+		}
+		r := importRow{
+			Row: i + 1,
+			invitationImport: invitationImport{
+				Name:  cell(row, importFieldName),
+				Phone: cell(row, importFieldPhone),
+				Email: cell(row, importFieldEmail),
+			},
+		}
+		if s := cell(row, importFieldMaxParty); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				r.invalid = "max_party must be a number"
+			}
+			r.MaxParty, r.maxPartySet = n, true
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func headerIndex(header []string, names []string) int {
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		for _, n := range names {
+			if h == strings.ToLower(n) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func blankRow(row []string) bool {
+	for _, c := range row {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// importKey — по чему строка совпадает с уже известным приглашением: телефон, а без него — имя.
+func importKey(name, phone string) string {
+	if p := normalizePhone(phone); p != "" {
+		return "phone:" + p
+	}
+	return "name:" + strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// planGuestImport решает по каждой строке, создать приглашение, обновить существующее или пропустить.
+// Ничего не сохраняет.
+func planGuestImport(store invitationStore, rows []importRow) (importReport, error) {
+	existing, err := store.list()
+	if err != nil {
+		return importReport{}, err
+	}
+	known := make(map[string]invitation, len(existing))
+	for _, inv := range existing {
+		known[importKey(inv.Name, inv.Phone)] = inv
+	}
+
+	var report importReport
+	seen := make(map[string]int)
+	for _, r := range rows {
+		res := importResult{Row: r.Row, Name: strings.TrimSpace(r.Name), Phone: canonicalPhone(r.Phone)}
+		reason := r.invalid
+		if reason == "" {
+			reason = validateInvitationItem(r.invitationImport)
+		}
+		key := importKey(r.Name, r.Phone)
+		if reason == "" {
+			if first, dup := seen[key]; dup {
+				reason = fmt.Sprintf("duplicate of row %d", first)
+			}
+		}
+		if reason != "" {
+			res.Action, res.Reason = importSkip, reason
+			report.Skipped++
+			report.Rows = append(report.Rows, res)
+			continue
+		}
+		seen[key] = r.Row
+
+		if old, ok := known[key]; ok {
+			upd := old
+			upd.Name = res.Name
+			// приглашения, сохранённые до канонического вида, получают его при повторном импорте
+			if res.Phone != "" {
+				upd.Phone = res.Phone
+			}
+			if e := strings.TrimSpace(r.Email); e != "" {
+				upd.Email = e
+			}
+			if r.maxPartySet {
+				upd.MaxParty = r.MaxParty
+			}
+			res.Code, res.inv = old.Code, upd
+			if upd == old {
+				res.Action, res.Reason = importSkip, importReasonUnchanged
+				report.Skipped++
+			} else {
+				res.Action = importUpdate
+				report.Updated++
+			}
+		} else {
+			res.Action = importCreate
+			res.inv = invitation{Name: res.Name, Phone: res.Phone, Email: strings.TrimSpace(r.Email), MaxParty: r.MaxParty}
+			report.Created++
+		}
+		report.Rows = append(report.Rows, res)
+	}
+	return report, nil
+}
+
+// applyGuestImport сохраняет то, что решил planGuestImport, и проставляет коды новым приглашениям.
+func applyGuestImport(store invitationStore, report *importReport) error {
+	for i := range report.Rows {
+		res := &report.Rows[i]
+		switch res.Action {
+		case importUpdate:
+			if err := store.update(res.inv); err != nil {
+				return fmt.Errorf("строка %d: %w", res.Row, err)
+			}
+		case importCreate:
+			res.inv.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+			// Коды случайные; на редкое совпадение просто берём другой
+			for attempt := 0; ; attempt++ {
+				res.inv.Code = newInviteCode()
+				created, err := store.create(res.inv)
+				if err == errCodeTaken && attempt < 5 {
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("строка %d: %w", res.Row, err)
+				}
+				res.inv = created
+				break
+			}
+			res.Code = res.inv.Code
+		}
+	}
+	return nil
+}
+
+// parseGuestList — строки списка гостей из файла.
+func parseGuestList(data []byte, format, sheet string, columns map[string]string) ([]importRow, error) {
+	table, err := readGuestTable(data, format, sheet)
+	if err != nil {
+		return nil, err
+	}
+	return mapGuestRows(table, columns)
+}
+
+// handleAdminImport — POST /api/admin/import (доступ — см. adminAccess): список гостей из .xlsx или .csv.
+// Файл — в поле file формы multipart или телом запроса. Параметры: format (xlsx|csv, по умолчанию по имени файла),
+// sheet, columns (name=ФИО,phone=Телефон,...), dry_run=1 — только отчёт, без сохранения.
+func (a *app) handleAdminImport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := a.adminAccess(w, r, ""); !ok {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		columns, err := parseColumnMap(q.Get("columns"))
+		if err != nil {
+			httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dryRun, _ := strconv.ParseBool(q.Get("dry_run"))
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+		var data []byte
+		filename, contentType := "", r.Header.Get("Content-Type")
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			file, hdr, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, `{"error":"file required"}`, http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+			filename, contentType = hdr.Filename, hdr.Header.Get("Content-Type")
+			data, err = io.ReadAll(file)
+			if err != nil {
+				http.Error(w, `{"error":"failed to read file"}`, http.StatusBadRequest)
+				return
+			}
+		} else {
+			data, err = io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, `{"error":"failed to read file"}`, http.StatusBadRequest)
+				return
+			}
+		}
+		format, err := importFormat(q.Get("format"), filename, contentType)
+		if err != nil {
+			httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rows, err := parseGuestList(data, format, q.Get("sheet"), columns)
+		if err != nil {
+			httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report, err := planGuestImport(a.invitations, rows)
+		if err != nil {
+			log.Printf("импорт гостей: %v", err)
+			http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+			return
+		}
+		report.DryRun = dryRun
+		if !dryRun {
+			if err := applyGuestImport(a.invitations, &report); err != nil {
+				log.Printf("импорт гостей: %v", err)
+				http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+				return
+			}
+			log.Printf("импорт гостей: создано %d, обновлено %d, пропущено %d", report.Created, report.Updated, report.Skipped)
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "report": report})
+	}
+}
+
+// runImportCommand — подкоманда «import»: тот же импорт из консоли, хранилище берётся из тех же переменных,
+// что и у сервера. С json-хранилищем запускайте её при остановленном сервере.
+func runImportCommand(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "xlsx или csv (по умолчанию по расширению)")
+	sheet := fs.String("sheet", "", "лист xlsx (по умолчанию первый)")
+	columnsFlag := fs.String("columns", "", "сопоставление колонок: name=ФИО,phone=Телефон,email=Почта,max_party=Мест")
+	dryRun := fs.Bool("dry-run", false, "только показать, что будет создано, обновлено и пропущено")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "использование: wedding-rsvp import [флаги] guests.xlsx")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+
+	columns, err := parseColumnMap(*columnsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmtName, err := importFormat(*format, path, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rows, err := parseGuestList(data, fmtName, *sheet, columns)
+	if err != nil {
+		log.Fatalf("%s: %v", path, err)
+	}
+	st, err := openStorage(os.Getenv("STORAGE_DRIVER"), dataPathFromEnv(), strings.TrimSpace(os.Getenv("SQLITE_PATH")))
+	if err != nil {
+		log.Fatalf("хранилище: %v", err)
+	}
+	defer st.close()
+
+	report, err := planGuestImport(st.invitations, rows)
+	if err != nil {
+		st.close()
+		log.Fatalf("импорт: %v", err)
+	}
+	report.DryRun = *dryRun
+	if !*dryRun {
+		err = applyGuestImport(st.invitations, &report)
+	}
+	actions := map[string]string{importCreate: "создать", importUpdate: "обновить", importSkip: "пропустить"}
+	for _, res := range report.Rows {
+		line := fmt.Sprintf("строка %d: %s %s", res.Row, actions[res.Action], res.Name)
+		if res.Phone != "" {
+			line += " (" + res.Phone + ")"
+		}
+		if res.Code != "" {
+			line += " код " + res.Code
+		}
+		if res.Reason != "" {
+			line += " — " + res.Reason
+		}
+		fmt.Println(line)
+	}
+	if err != nil {
+		st.close()
+		log.Fatalf("импорт: %v", err)
+	}
+	if *dryRun {
+		fmt.Printf("пробный прогон, ничего не сохранено: создать %d, обновить %d, пропустить %d\n", report.Created, report.Updated, report.Skipped)
+		return
+	}
+	fmt.Printf("создано %d, обновлено %d, пропущено %d\n", report.Created, report.Updated, report.Skipped)
+}
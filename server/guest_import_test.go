@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCanonicalPhone(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"+7 (999) 000-00-01", "+79990000001"},
+		{" +7 999 000 00 01 ", "+79990000001"},
+		{"8 999 000-00-01", "89990000001"},
+		{"79990000001", "79990000001"},
+		{"", ""},
+		{"+", ""},
+	}
+	for _, tt := range tests {
+		if got := canonicalPhone(tt.in); got != tt.want {
+			t.Errorf("canonicalPhone(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGuestImportStoresCanonicalPhone(t *testing.T) {
+	st, err := openJSONStorage(filepath.Join(t.TempDir(), "rsvps.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.close()
+	// приглашение из старой версии, с телефоном как ввели
+	st.invitations.create(invitation{ID: "old", Code: "OLDCODE2", Name: "Петровы", Phone: "+7 (999) 000-00-02"})
+
+	rows := []importRow{
+		{Row: 1, invitationImport: invitationImport{Name: "Ивановы", Phone: "+7 (999) 000-00-01"}},
+		{Row: 2, invitationImport: invitationImport{Name: "Петровы", Phone: "+7 999 000 00 02"}},
+	}
+	report, err := planGuestImport(st.invitations, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyGuestImport(st.invitations, &report); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := st.invitations.list()
+	phones := map[string]string{}
+	for _, inv := range list {
+		phones[inv.Name] = inv.Phone
+	}
+	if phones["Ивановы"] != "+79990000001" || phones["Петровы"] != "+79990000002" || len(list) != 2 {
+		t.Fatalf("phones = %v", phones)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// invitation — приглашённая семья из списка гостей.
+type invitation struct {
+	ID    string `json:"id"`
+	Code  string `json:"code"`
+	Name  string `json:"name"`
+	Phone string `json:"phone,omitempty"`
+	Email string `json:"email,omitempty"`
+	// MaxParty — сколько человек всего, включая ответившего; 0 — без ограничения
+	MaxParty int `json:"max_party"`
+	// RSVPID — ответ, данный по этому приглашению
+	RSVPID    string `json:"rsvp_id,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// inviteCodeAlphabet — без похожих друг на друга 0/O и 1/I/L, чтобы код легко продиктовать.
+const inviteCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+const inviteCodeLen = 8
+
+func newInviteCode() string {
+	// rand.Int, а не байт по модулю: 256 на 31 не делится, и первые буквы алфавита выпадали бы чаще
+	n := big.NewInt(int64(len(inviteCodeAlphabet)))
+	b := make([]byte, inviteCodeLen)
+	for i := range b {
+		k, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = inviteCodeAlphabet[k.Int64()]
+	}
+	return string(b)
+}
+
+// normalizeInviteCode — код без пробелов и дефисов, в верхнем регистре: «abcd-2345» == «ABCD2345».
+func normalizeInviteCode(code string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(code) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (a *app) inviteURL(code string) string {
+	return a.siteURL + "/?invite=" + url.QueryEscape(code) + "#rsvp"
+}
+
+// findInvitationRSVP — ответ по приглашению: по сохранённой ссылке, по invitation_id или по телефону.
+func findInvitationRSVP(inv invitation, rsvps []storedRSVP) *storedRSVP {
+	phoneNorm := normalizePhone(inv.Phone)
+	var byPhone *storedRSVP
+	for i := range rsvps {
+		r := &rsvps[i]
+		if (inv.RSVPID != "" && r.ID == inv.RSVPID) || r.InvitationID == inv.ID {
+			return r
+		}
+		if byPhone == nil && phoneNorm != "" && normalizePhone(r.Phone) == phoneNorm {
+			byPhone = r
+		}
+	}
+	return byPhone
+}
+
+// handleInvitation — GET /api/invitation?code=: данные приглашения, чтобы заполнить форму.
+// Если по приглашению уже ответили, отдаёт и токен для изменения ответа, поэтому запросы ограничены
+// тем же лимитом, что и отправка анкеты: иначе коды можно перебирать.
+func (a *app) handleInvitation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if !a.limiter.allow(clientIP(r)) {
+			http.Error(w, `{"error":"too many requests"}`, http.StatusTooManyRequests)
+			return
+		}
+		code := normalizeInviteCode(r.URL.Query().Get("code"))
+		if code == "" {
+			http.Error(w, `{"error":"invalid invitation"}`, http.StatusNotFound)
+			return
+		}
+		inv, found, err := a.invitations.getByCode(code)
+		if err != nil {
+			log.Printf("приглашение %s: %v", code, err)
+			http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, `{"error":"invalid invitation"}`, http.StatusNotFound)
+			return
+		}
+		resp := map[string]interface{}{
+			"ok":        true,
+			"code":      inv.Code,
+			"name":      inv.Name,
+			"phone":     inv.Phone,
+			"email":     inv.Email,
+			"max_party": inv.MaxParty,
+		}
+		if inv.RSVPID != "" {
+			resp["edit_token"] = a.tokens.sign(tokenPurposeEdit, inv.RSVPID, time.Now().Add(a.cancelTTL))
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// invitationImport — одна семья в запросе на импорт.
+type invitationImport struct {
+	Name     string `json:"name"`
+	Phone    string `json:"phone"`
+	Email    string `json:"email"`
+	MaxParty int    `json:"max_party"`
+}
+
+// validateInvitationItem — что не так с семьёй из импорта; пустая строка — всё в порядке.
+func validateInvitationItem(it invitationImport) string {
+	name := strings.TrimSpace(it.Name)
+	if name == "" || len(name) > 200 {
+		return "name required, max 200 chars"
+	}
+	if p := strings.TrimSpace(it.Phone); p != "" && len(normalizePhone(p)) < 10 {
+		return "phone must have at least 10 digits"
+	}
+	if e := strings.TrimSpace(it.Email); e != "" && (len(e) > 254 || !strings.Contains(e, "@")) {
+		return "invalid email"
+	}
+	if it.MaxParty < 0 || it.MaxParty > maxPartySize+1 {
+		return "max_party must be 0..20"
+	}
+	return ""
+}
+
+// handleAdminInvitations — /api/admin/invitations (доступ — см. adminAccess).
+// GET — список с отметкой, ответили ли (?filter=unanswered — только без ответа);
+// POST — импорт: JSON-массив {name, phone, email, max_party}; семья с уже известным телефоном обновляется,
+// код сохраняется. Таблицы .xlsx и .csv — через /api/admin/import.
+func (a *app) handleAdminInvitations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := a.adminAccess(w, r, ""); !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			a.listInvitations(w, r)
+		case http.MethodPost:
+			var items []invitationImport
+			r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+			if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+				http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+				return
+			}
+			rows := make([]importRow, 0, len(items))
+			for i, it := range items {
+				if msg := validateInvitationItem(it); msg != "" {
+					httpErrorJSON(w, fmt.Sprintf("item %d: %s", i+1, msg), http.StatusBadRequest)
+					return
+				}
+				rows = append(rows, importRow{Row: i + 1, invitationImport: it, maxPartySet: true})
+			}
+			report, err := planGuestImport(a.invitations, rows)
+			if err == nil {
+				err = applyGuestImport(a.invitations, &report)
+			}
+			if err != nil {
+				log.Printf("импорт приглашений: %v", err)
+				http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+				return
+			}
+			log.Printf("импорт приглашений: создано %d, обновлено %d", report.Created, report.Updated)
+			out := make([]map[string]interface{}, 0, len(report.Rows))
+			for _, res := range report.Rows {
+				if res.Action == importSkip && res.Reason != importReasonUnchanged {
+					continue
+				}
+				inv := res.inv
+				out = append(out, map[string]interface{}{
+					"id":        inv.ID,
+					"code":      inv.Code,
+					"link":      a.inviteURL(inv.Code),
+					"name":      inv.Name,
+					"max_party": inv.MaxParty,
+				})
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "invitations": out, "report": report})
+		default:
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func (a *app) listInvitations(w http.ResponseWriter, r *http.Request) {
+	invs, err := a.invitations.list()
+	if err != nil {
+		log.Printf("приглашения: %v", err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	}
+	rsvps, err := a.rsvps.list()
+	if err != nil {
+		log.Printf("приглашения: %v", err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	}
+	onlyUnanswered := r.URL.Query().Get("filter") == "unanswered"
+	out := make([]map[string]interface{}, 0, len(invs))
+	unanswered := 0
+	for _, inv := range invs {
+		item := map[string]interface{}{
+			"id":        inv.ID,
+			"code":      inv.Code,
+			"link":      a.inviteURL(inv.Code),
+			"name":      inv.Name,
+			"phone":     inv.Phone,
+			"email":     inv.Email,
+			"max_party": inv.MaxParty,
+			"answered":  false,
+		}
+		if rsvp := findInvitationRSVP(inv, rsvps); rsvp != nil {
+			item["answered"] = true
+			item["status"] = rsvp.attendance()
+			item["guest_count"] = rsvp.headcount()
+		} else {
+			unanswered++
+		}
+		if onlyUnanswered && item["answered"] == true {
+			continue
+		}
+		out = append(out, item)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":          true,
+		"total":       len(invs),
+		"unanswered":  unanswered,
+		"invitations": out,
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewInviteCode(t *testing.T) {
+	seen := map[rune]bool{}
+	for i := 0; i < 200; i++ {
+		code := newInviteCode()
+		if len(code) != inviteCodeLen || normalizeInviteCode(code) != code {
+			t.Fatalf("code %q", code)
+		}
+		for _, r := range code {
+			if !strings.ContainsRune(inviteCodeAlphabet, r) {
+				t.Fatalf("code %q has %q outside the alphabet", code, r)
+			}
+			seen[r] = true
+		}
+	}
+	// 1600 символов: все 31 должны встретиться
+	if len(seen) != len(inviteCodeAlphabet) {
+		t.Fatalf("only %d of %d symbols used", len(seen), len(inviteCodeAlphabet))
+	}
+}
+
+func TestHandleInvitationRateLimited(t *testing.T) {
+	a := testReminderApp(t, nil)
+	a.limiter = &rsvpLimiter{counts: make(map[string][]time.Time)}
+	h := a.handleInvitation()
+	codes := 0
+	for i := 0; i < rateLimitNum+1; i++ {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/api/invitation?code=GUESS"+newInviteCode(), nil))
+		if w.Code == http.StatusTooManyRequests {
+			break
+		}
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("request %d: status %d", i+1, w.Code)
+		}
+		codes++
+	}
+	if codes != rateLimitNum {
+		t.Fatalf("%d lookups allowed, want %d", codes, rateLimitNum)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// journalCompactEvery — после стольких записей в журнале снимок переписывается целиком.
+const journalCompactEvery = 64
+
+// readJSONFile читает path в v; отсутствующий файл — не ошибка (v остаётся пустым).
+// Файл, который не удаётся разобрать, — ошибка: лучше не стартовать, чем затереть данные.
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s повреждён: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSONFile атомарно заменяет path: пишет во временный файл рядом, fsync, rename, fsync каталога.
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	ok := false
+	defer func() {
+		if !ok {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	ok = true
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// Не все ФС умеют fsync каталога — это не повод терять запись
+	_ = d.Sync()
+	return nil
+}
+
+type journalRecord struct {
+	Op   string          `json:"op"`
+	Data json.RawMessage `json:"data"`
+}
+
+// journaledFile — JSON-снимок плюс журнал операций (<path>.journal, по строке JSON на операцию).
+// Каждая операция сначала дописывается в журнал с fsync и только потом применяется в памяти;
+// снимок периодически переписывается атомарно, после чего журнал обнуляется.
+// При открытии журнал проигрывается поверх снимка, поэтому операции обязаны быть идемпотентными.
+type journaledFile struct {
+	path    string
+	journal *os.File
+	pending int
+	apply   func(op string, data json.RawMessage) error
+}
+
+// openJournaledFile читает снимок в v, проигрывает журнал через apply и сразу уплотняет его.
+func openJournaledFile(path string, v interface{}, apply func(op string, data json.RawMessage) error) (*journaledFile, error) {
+	if err := readJSONFile(path, v); err != nil {
+		return nil, err
+	}
+	f := &journaledFile{path: path, apply: apply}
+	replayed, err := f.replay()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f.journal, err = os.OpenFile(path+".journal", os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if replayed > 0 {
+		log.Printf("журнал %s: восстановлено операций: %d", filepath.Base(path), replayed)
+		if err := f.compact(v); err != nil {
+			f.journal.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *journaledFile) replay() (int, error) {
+	data, err := os.ReadFile(f.path + ".journal")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	n := 0
+	r := bufio.NewReader(bytes.NewReader(data))
+	for line := 1; ; line++ {
+		raw, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		torn := err == io.EOF // последняя строка без \n — запись прервалась на середине
+		if len(bytes.TrimSpace(raw)) > 0 {
+			var rec journalRecord
+			if jerr := json.Unmarshal(raw, &rec); jerr != nil {
+				if torn {
+					log.Printf("журнал %s: отброшена недописанная строка %d", filepath.Base(f.path), line)
+					break
+				}
+				return n, fmt.Errorf("журнал %s.journal повреждён в строке %d: %w", f.path, line, jerr)
+			}
+			if aerr := f.apply(rec.Op, rec.Data); aerr != nil {
+				return n, fmt.Errorf("журнал %s.journal, строка %d: %w", f.path, line, aerr)
+			}
+			n++
+		}
+		if torn {
+			break
+		}
+	}
+	return n, nil
+}
+
+// record дописывает операцию в журнал и дожидается fsync.
+// record дописывает операцию в журнал и возвращает её данные и размер журнала до записи.
+func (f *journaledFile) record(op string, data interface{}) (json.RawMessage, int64, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	line, err := json.Marshal(journalRecord{Op: op, Data: payload})
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.journal.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := f.journal.Write(append(line, '\n')); err != nil {
+		// Не оставляем в журнале обрывок строки (например, при заполненном диске)
+		_ = f.journal.Truncate(info.Size())
+		return nil, 0, err
+	}
+	if err := f.journal.Sync(); err != nil {
+		return nil, 0, err
+	}
+	return payload, info.Size(), nil
+}
+
+// mutate журналирует операцию, применяет её и при необходимости уплотняет журнал в снимок v
+// (v — указатель на состояние: apply может заменить срез целиком).
+func (f *journaledFile) mutate(op string, data interface{}, v interface{}) error {
+	payload, size, err := f.record(op, data)
+	if err != nil {
+		return err
+	}
+	if err := f.apply(op, payload); err != nil {
+		// Операция, которую не удалось применить, не должна проиграться при следующем открытии
+		if terr := f.journal.Truncate(size); terr != nil {
+			return fmt.Errorf("%v (журнал не откатить: %v)", err, terr)
+		}
+		if serr := f.journal.Sync(); serr != nil {
+			return fmt.Errorf("%v (журнал не откатить: %v)", err, serr)
+		}
+		return err
+	}
+	f.pending++
+	if f.pending >= journalCompactEvery {
+		if err := f.compact(v); err != nil {
+			// Операция уже в журнале и не потеряется; снимок перепишем в следующий раз
+			log.Printf("снимок %s: %v", filepath.Base(f.path), err)
+		}
+	}
+	return nil
+}
+
+// compact атомарно записывает снимок v и обнуляет журнал.
+func (f *journaledFile) compact(v interface{}) error {
+	if err := writeJSONFile(f.path, v); err != nil {
+		return err
+	}
+	if err := f.journal.Truncate(0); err != nil {
+		return err
+	}
+	if err := f.journal.Sync(); err != nil {
+		return err
+	}
+	f.pending = 0
+	return nil
+}
+
+func (f *journaledFile) close(v interface{}) error {
+	err := f.compact(v)
+	if cerr := f.journal.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
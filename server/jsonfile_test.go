@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openTestJournal открывает journaledFile со списком строк: операция "add" дописывает строку.
+func openTestJournal(t *testing.T, path string) (*journaledFile, *[]string, error) {
+	t.Helper()
+	items := &[]string{}
+	f, err := openJournaledFile(path, items, func(op string, data json.RawMessage) error {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*items = append(*items, s)
+		return nil
+	})
+	return f, items, err
+}
+
+func TestJournalReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		journal string
+		want    []string
+		wantErr string
+	}{
+		{"empty", "", []string{"a"}, ""},
+		{"replayed over snapshot", `{"op":"add","data":"b"}` + "\n" + `{"op":"add","data":"c"}` + "\n", []string{"a", "b", "c"}, ""},
+		{"blank lines", "\n" + `{"op":"add","data":"b"}` + "\n\n", []string{"a", "b"}, ""},
+		{"torn last line dropped", `{"op":"add","data":"b"}` + "\n" + `{"op":"add","da`, []string{"a", "b"}, ""},
+		{"complete last line without newline", `{"op":"add","data":"b"}`, []string{"a", "b"}, ""},
+		{"corrupt line in the middle", `{"op":"add","da` + "\n" + `{"op":"add","data":"c"}` + "\n", nil, "повреждён в строке 1"},
+		{"apply error", `{"op":"add","data":1}` + "\n", nil, "строка 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "items.json")
+			if err := os.WriteFile(path, []byte(`["a"]`), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path+".journal", []byte(tt.journal), 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, items, err := openTestJournal(t, path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.close(items)
+			if strings.Join(*items, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("items = %v, want %v", *items, tt.want)
+			}
+			// после открытия журнал уплотнён в снимок
+			var snapshot []string
+			if err := readJSONFile(path, &snapshot); err != nil || strings.Join(snapshot, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("snapshot = %v, %v", snapshot, err)
+			}
+			if info, err := os.Stat(path + ".journal"); err != nil || info.Size() != 0 {
+				t.Fatalf("journal not truncated: %v, %v", info, err)
+			}
+		})
+	}
+}
+
+func TestJournalMutateSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.json")
+	f, items, err := openTestJournal(t, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"x", "y"} {
+		if err := f.mutate("add", s, items); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// без close: снимок не переписан, операции только в журнале
+	f.journal.Close()
+	_, reopened, err := openTestJournal(t, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(*reopened, ",") != "x,y" {
+		t.Fatalf("items after reopen = %v", *reopened)
+	}
+}
+
+func TestJournalMutateApplyErrorNotJournaled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.json")
+	f, items, err := openTestJournal(t, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// число не разбирается как строка: apply падает
+	if err := f.mutate("add", 42, items); err == nil {
+		t.Fatal("mutate with bad data: want error")
+	}
+	if err := f.mutate("add", "x", items); err != nil {
+		t.Fatal(err)
+	}
+	f.journal.Close()
+	_, reopened, err := openTestJournal(t, path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if strings.Join(*reopened, ",") != "x" {
+		t.Fatalf("items after reopen = %v", *reopened)
+	}
+}
+
+func TestJSONStateStoreNullSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("null"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".journal", []byte(`{"op":"set","data":["k","v"]}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := openJSONStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if v, ok, _ := s.get("k"); !ok || v != "v" {
+		t.Fatalf("get(k) = %q, %v", v, ok)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/resend/resend-go/v2"
+)
+
+// mailer — отправка письма от имени сайта. Адрес отправителя задаётся при создании.
+type mailer interface {
+	send(to, subject, html string) error
+}
+
+// Провайдеры почты (MAIL_PROVIDER).
+const (
+	mailProviderResend = "resend"
+	mailProviderSMTP   = "smtp"
+	mailProviderFile   = "file"
+	mailProviderNone   = "none"
+)
+
+// Защита SMTP-соединения (SMTP_TLS): STARTTLS после подключения, TLS сразу (порт 465) или без шифрования.
+const (
+	smtpStartTLS = "starttls"
+	smtpTLS      = "tls"
+	smtpPlain    = "none"
+)
+
+const smtpTimeout = 30 * time.Second
+
+// mailerFromEnv выбирает провайдера по MAIL_PROVIDER: resend (RESEND_API_KEY), smtp (SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME, SMTP_PASSWORD, SMTP_TLS), file (.eml в MAIL_DIR, по умолчанию mail рядом с данными) или none.
+// Без MAIL_PROVIDER — resend, если задан RESEND_API_KEY, иначе почта выключена. Второе значение — описание для лога.
+func mailerFromEnv(dataPath string) (mailer, string, error) {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_PROVIDER")))
+	resendKey := strings.TrimSpace(os.Getenv("RESEND_API_KEY"))
+	if provider == "" {
+		provider = mailProviderNone
+		if resendKey != "" {
+			provider = mailProviderResend
+		}
+	}
+	from := strings.TrimSpace(os.Getenv("RSVP_FROM_EMAIL"))
+
+	switch provider {
+	case mailProviderNone:
+		return nil, "", nil
+	case mailProviderResend:
+		if resendKey == "" {
+			return nil, "", errors.New("MAIL_PROVIDER=resend: нужен RESEND_API_KEY")
+		}
+		if from == "" {
+			// для теста Resend разрешает отправку с onboarding@resend.dev
+			from = "Свадьба <onboarding@resend.dev>"
+		}
+		return &resendMailer{client: resend.NewClient(resendKey), from: from}, "Resend от " + from, nil
+	case mailProviderSMTP:
+		m, err := smtpMailerFromEnv(from)
+		if err != nil {
+			return nil, "", err
+		}
+		return m, "SMTP " + m.addr + " (" + m.security + ") от " + m.from.Address, nil
+	case mailProviderFile:
+		if from == "" {
+			from = "Свадьба <rsvp@localhost>"
+		}
+		addr, err := mail.ParseAddress(from)
+		if err != nil {
+			return nil, "", fmt.Errorf("RSVP_FROM_EMAIL: %v", err)
+		}
+		dir := strings.TrimSpace(os.Getenv("MAIL_DIR"))
+		if dir == "" {
+			dir = filepath.Join(filepath.Dir(dataPath), "mail")
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, "", fmt.Errorf("MAIL_DIR: %v", err)
+		}
+		return &fileMailer{dir: dir, from: addr}, "файлы .eml в " + dir, nil
+	}
+	return nil, "", fmt.Errorf("MAIL_PROVIDER: нужен resend, smtp, file или none, получено %q", provider)
+}
+
+// resendMailer — отправка через API Resend.
+type resendMailer struct {
+	client *resend.Client
+	from   string
+}
+
+func (m *resendMailer) send(to, subject, html string) error {
+	_, err := m.client.Emails.Send(&resend.SendEmailRequest{
+		From:    m.from,
+		To:      []string{to},
+		Subject: subject,
+		Html:    html,
+	})
+	return err
+}
+
+// smtpMailer — отправка через обычный SMTP-сервер, по соединению на письмо.
+type smtpMailer struct {
+	addr     string
+	host     string
+	security string
+	// auth — nil, если SMTP_USERNAME не задан
+	auth smtp.Auth
+	from *mail.Address
+}
+
+func smtpMailerFromEnv(from string) (*smtpMailer, error) {
+	host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
+	if host == "" {
+		return nil, errors.New("MAIL_PROVIDER=smtp: нужен SMTP_HOST")
+	}
+	if from == "" {
+		return nil, errors.New("MAIL_PROVIDER=smtp: нужен RSVP_FROM_EMAIL")
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("RSVP_FROM_EMAIL: %v", err)
+	}
+	port := 587
+	if v := strings.TrimSpace(os.Getenv("SMTP_PORT")); v != "" {
+		if port, err = strconv.Atoi(v); err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("SMTP_PORT: неверный порт %q", v)
+		}
+	}
+	security := strings.ToLower(strings.TrimSpace(os.Getenv("SMTP_TLS")))
+	if security == "" {
+		security = smtpStartTLS
+		if port == 465 {
+			security = smtpTLS
+		}
+	}
+	if security != smtpStartTLS && security != smtpTLS && security != smtpPlain {
+		return nil, fmt.Errorf("SMTP_TLS: нужен starttls, tls или none, получено %q", security)
+	}
+	m := &smtpMailer{addr: net.JoinHostPort(host, strconv.Itoa(port)), host: host, security: security, from: addr}
+	// net/smtp не отдаст пароль по незашифрованному соединению, кроме как на localhost
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		m.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return m, nil
+}
+
+func (m *smtpMailer) send(to, subject, html string) error {
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("bad recipient %q: %v", to, err)
+	}
+	msg, err := buildMail(m.from, rcpt, subject, html, time.Now())
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	if m.security == smtpTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", m.addr, &tls.Config{ServerName: m.host})
+	} else {
+		conn, err = dialer.Dial("tcp", m.addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.security == smtpStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS (set SMTP_TLS=none to send unencrypted)")
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.auth != nil {
+		if err := c.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(rcpt.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// fileMailer — для разработки: каждое письмо сохраняется в dir отдельным .eml, ничего не отправляется.
+type fileMailer struct {
+	dir  string
+	from *mail.Address
+}
+
+func (m *fileMailer) send(to, subject, html string) error {
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("bad recipient %q: %v", to, err)
+	}
+	now := time.Now()
+	msg, err := buildMail(m.from, rcpt, subject, html, now)
+	if err != nil {
+		return err
+	}
+	name := now.UTC().Format("20060102-150405") + "-" + newID() + ".eml"
+	return os.WriteFile(filepath.Join(m.dir, name), msg, 0o644)
+}
+
+// buildMail собирает письмо в формате RFC 5322: HTML в quoted-printable, тема в кодировке MIME.
+func buildMail(from, to *mail.Address, subject, html string, at time.Time) ([]byte, error) {
+	domain := "localhost"
+	if i := strings.LastIndex(from.Address, "@"); i >= 0 {
+		domain = from.Address[i+1:]
+	}
+	var b bytes.Buffer
+	header := func(k, v string) {
+		b.WriteString(k + ": " + v + "\r\n")
+	}
+	header("From", from.String())
+	header("To", to.String())
+	// переводы строк в теме кодируются, поэтому лишний заголовок через неё не подставить
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", at.Format(time.RFC1123Z))
+	header("Message-ID", "<"+newID()+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/html; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(html)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
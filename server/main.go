@@ -1,218 +1,29 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
-
-	"github.com/resend/resend-go/v2"
-	"github.com/xuri/excelize/v2"
+	// база часовых поясов для WEDDING_TIMEZONE, если в образе нет tzdata
+	_ "time/tzdata"
 )
 
 const (
-	maxBodySize     = 4 << 10     // 4 KB
+	maxBodySize     = 16 << 10    // 16 KB, со списком спутников
+	maxTgUpdateSize = 256 << 10   // 256 KB: текст сообщения до 4096 символов плюс служебные поля
 	rateLimitNum    = 5           // запросов
 	rateLimitWindow = time.Minute // в минуту с одного IP
 )
 
-// Telegram user store
-type tgUserStore struct {
-	mu   sync.Mutex
-	path string
-}
-
-type tgUser struct {
-	ChatID int64  `json:"chat_id"`
-	Phone  string `json:"phone"` // нормализованный (только цифры)
-	Name   string `json:"name"`
-}
-
-func (s *tgUserStore) get(phone string) (*tgUser, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	users, err := s.load()
-	if err != nil {
-		return nil, false
-	}
-	phoneNorm := normalizePhone(phone)
-	for _, u := range users {
-		if normalizePhone(u.Phone) == phoneNorm {
-			return &u, true
-		}
-	}
-	return nil, false
-}
-
-func (s *tgUserStore) save(user tgUser) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	users, err := s.load()
-	if err != nil {
-		return err
-	}
-	phoneNorm := normalizePhone(user.Phone)
-	// Обновляем или добавляем
-	found := false
-	for i, u := range users {
-		if u.Phone == phoneNorm {
-			users[i] = user
-			found = true
-			break
-		}
-	}
-	if !found {
-		users = append(users, user)
-	}
-	return s.saveUsers(users)
-}
-
-func (s *tgUserStore) load() ([]tgUser, error) {
-	data, err := os.ReadFile(s.path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, err
-	}
-	var users []tgUser
-	if err := json.Unmarshal(data, &users); err != nil {
-		return nil, err
-	}
-	return users, nil
-}
-
-func (s *tgUserStore) saveUsers(users []tgUser) error {
-	dir := filepath.Dir(s.path)
-	_ = os.MkdirAll(dir, 0755)
-	data, err := json.MarshalIndent(users, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(s.path, data, 0644)
-}
-
-func (s *tgUserStore) list() ([]tgUser, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.load()
-}
-
-// Telegram client
-type tgClient struct {
-	token  string
-	apiURL string
-}
-
-func newTelegramClient(token string) *tgClient {
-	return &tgClient{
-		token:  token,
-		apiURL: "https://api.telegram.org/bot" + token,
-	}
-}
-
-func (t *tgClient) sendMessage(chatID int64, text, parseMode string) error {
-	url := t.apiURL + "/sendMessage"
-	payload := map[string]interface{}{
-		"chat_id": chatID,
-		"text":    text,
-	}
-	if parseMode != "" {
-		payload["parse_mode"] = parseMode
-	}
-	data, _ := json.Marshal(payload)
-	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("telegram API error: %s", string(body))
-	}
-	return nil
-}
-
-func (t *tgClient) sendWebApp(chatID int64, text, url, buttonText string) error {
-	apiURL := t.apiURL + "/sendMessage"
-
-	// Keyboard с Web App кнопкой
-	keyboard := map[string]interface{}{
-		"inline_keyboard": [][]map[string]interface{}{
-			{
-				{
-					"text": buttonText,
-					"web_app": map[string]string{
-						"url": url,
-					},
-				},
-			},
-		},
-	}
-
-	payload := map[string]interface{}{
-		"chat_id":      chatID,
-		"text":         text,
-		"parse_mode":   "Markdown",
-		"reply_markup": keyboard,
-	}
-
-	data, _ := json.Marshal(payload)
-	resp, err := http.Post(apiURL, "application/json", bytes.NewReader(data))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("telegram API error: %s", string(body))
-	}
-	return nil
-}
-
-func (t *tgClient) sendMessageWithCancel(chatID int64, text, cancelText string) error {
-	apiURL := t.apiURL + "/sendMessage"
-
-	// Keyboard с кнопкой отмены
-	keyboard := map[string]interface{}{
-		"inline_keyboard": [][]map[string]interface{}{
-			{
-				{
-					"text": cancelText,
-					"callback_data": "cancel_rsvp",
-				},
-			},
-		},
-	}
-
-	payload := map[string]interface{}{
-		"chat_id":      chatID,
-		"text":         text,
-		"parse_mode":   "Markdown",
-		"reply_markup": keyboard,
-	}
-
-	data, _ := json.Marshal(payload)
-	resp, err := http.Post(apiURL, "application/json", bytes.NewReader(data))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("telegram API error: %s", string(body))
-	}
-	return nil
-}
-
 func normalizePhone(phone string) string {
 	var result strings.Builder
 	for _, r := range phone {
@@ -223,21 +34,14 @@ func normalizePhone(phone string) string {
 	return result.String()
 }
 
-type RSVPRequest struct {
-	Name           string `json:"name"`
-	Phone          string `json:"phone"`
-	Email          string `json:"email"`
-	TelegramChatID *int64 `json:"telegram_chat_id,omitempty"`
-	GuestCount     int    `json:"guest_count"`
-}
-
-type storedRSVP struct {
-	Name           string `json:"name"`
-	Phone          string `json:"phone"`
-	Email          string `json:"email"`
-	TelegramChatID *int64 `json:"telegram_chat_id,omitempty"`
-	GuestCount     int    `json:"guest_count"`
-	At             string `json:"at"`
+// canonicalPhone — телефон в том виде, в каком он хранится в приглашениях: только цифры и «+» в начале,
+// если он был. Цифры те же, что у normalizePhone, поэтому поиск по телефону от формы записи не зависит.
+func canonicalPhone(phone string) string {
+	digits := normalizePhone(phone)
+	if digits != "" && strings.HasPrefix(strings.TrimSpace(phone), "+") {
+		return "+" + digits
+	}
+	return digits
 }
 
 type rsvpLimiter struct {
@@ -264,151 +68,93 @@ func (r *rsvpLimiter) allow(ip string) bool {
 	return true
 }
 
-type rsvpStore struct {
-	mu   sync.Mutex
-	path string
-}
-
-func (s *rsvpStore) append(entry storedRSVP) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	var list []storedRSVP
-	data, err := os.ReadFile(s.path)
-	if err == nil {
-		_ = json.Unmarshal(data, &list)
+// dataPathFromEnv — RSVP_DATA_PATH; рядом с ним лежат остальные файлы данных.
+func dataPathFromEnv() string {
+	if p := os.Getenv("RSVP_DATA_PATH"); p != "" {
+		return p
 	}
-	list = append(list, entry)
-	data, err = json.MarshalIndent(list, "", "  ")
-	if err != nil {
-		return err
-	}
-	dir := filepath.Dir(s.path)
-	_ = os.MkdirAll(dir, 0755)
-	return os.WriteFile(s.path, data, 0644)
+	return "data/rsvps.json"
 }
 
-func (s *rsvpStore) list() ([]storedRSVP, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	data, err := os.ReadFile(s.path)
+// tokensFromEnv — подпись ссылок из писем: TOKEN_SECRET или случайный ключ, сохранённый в token_secret
+// рядом с данными, и срок жизни ссылок CANCEL_TOKEN_TTL.
+func tokensFromEnv(dataPath string) (*tokenSigner, time.Duration) {
+	tokenKey, err := loadTokenSecret(strings.TrimSpace(os.Getenv("TOKEN_SECRET")), filepath.Join(filepath.Dir(dataPath), "token_secret"))
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
-		return nil, err
+		log.Fatalf("ключ токенов: %v", err)
 	}
-	var list []storedRSVP
-	if err := json.Unmarshal(data, &list); err != nil {
-		return nil, err
-	}
-	return list, nil
-}
-
-type reminderSentStore struct {
-	mu   sync.Mutex
-	path string
-}
-
-func (s *reminderSentStore) list() (map[string]bool, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	data, err := os.ReadFile(s.path)
-	out := make(map[string]bool)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return out, nil
+	cancelTTL := 180 * 24 * time.Hour
+	if v := strings.TrimSpace(os.Getenv("CANCEL_TOKEN_TTL")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("CANCEL_TOKEN_TTL неверный формат (например, 720h): %q", v)
 		}
-		return nil, err
-	}
-	var list []string
-	if err := json.Unmarshal(data, &list); err != nil {
-		return nil, err
+		cancelTTL = d
 	}
-	for _, e := range list {
-		out[strings.TrimSpace(strings.ToLower(e))] = true
-	}
-	return out, nil
+	return &tokenSigner{key: tokenKey}, cancelTTL
 }
 
-func (s *reminderSentStore) add(emails []string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	data, _ := os.ReadFile(s.path)
-	var list []string
-	_ = json.Unmarshal(data, &list)
-	seen := make(map[string]bool)
-	for _, e := range list {
-		seen[strings.TrimSpace(strings.ToLower(e))] = true
-	}
-	for _, e := range emails {
-		e = strings.TrimSpace(strings.ToLower(e))
-		if e != "" && !seen[e] {
-			seen[e] = true
-			list = append(list, e)
-		}
-	}
-	data, err := json.MarshalIndent(list, "", "  ")
-	if err != nil {
-		return err
+func siteURLFromEnv() string {
+	siteURL := strings.TrimRight(strings.TrimSpace(os.Getenv("SITE_URL")), "/")
+	if siteURL == "" {
+		siteURL = "https://alexandr-i-daria.ru"
 	}
-	dir := filepath.Dir(s.path)
-	_ = os.MkdirAll(dir, 0755)
-	return os.WriteFile(s.path, data, 0644)
+	return siteURL
 }
 
-func main() {
-	resendKey := os.Getenv("RESEND_API_KEY")
-	toEmail := strings.TrimSpace(os.Getenv("RSVP_TO_EMAIL"))
-	fromEmail := strings.TrimSpace(os.Getenv("RSVP_FROM_EMAIL"))
-	staticDir := os.Getenv("STATIC_DIR")
-	if staticDir == "" {
-		staticDir = ".."
-	}
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	if resendKey == "" || toEmail == "" {
-		log.Fatal("нужны переменные: RESEND_API_KEY, RSVP_TO_EMAIL. Для теста RSVP_FROM_EMAIL можно не задавать (используется onboarding@resend.dev)")
+// telegramClientFromEnv — клиент бота из TELEGRAM_BOT_TOKEN; nil, если токен не задан.
+func telegramClientFromEnv() *tgClient {
+	tgToken := strings.TrimSpace(os.Getenv("TELEGRAM_BOT_TOKEN"))
+	if tgToken == "" {
+		return nil
 	}
-	if fromEmail == "" {
-		fromEmail = "Свадьба <onboarding@resend.dev>"
+	tg := newTelegramClient(tgToken)
+	// Локальный Bot API сервер вместо api.telegram.org
+	if base := strings.TrimRight(strings.TrimSpace(os.Getenv("TELEGRAM_API_URL")), "/"); base != "" {
+		tg.apiURL = base + "/bot" + tgToken
 	}
+	return tg
+}
 
-	client := resend.NewClient(resendKey)
-	limiter := &rsvpLimiter{counts: make(map[string][]time.Time)}
-	exportSecret := strings.TrimSpace(os.Getenv("EXPORT_SECRET"))
-	dataPath := os.Getenv("RSVP_DATA_PATH")
-	if dataPath == "" {
-		dataPath = "data/rsvps.json"
+// weddingScheduleFromEnv — дата свадьбы (нулевая, если WEDDING_DATE не задана) и окно досылки напоминаний.
+func weddingScheduleFromEnv() (time.Time, time.Duration) {
+	// Часовой пояс, в котором считается время напоминаний: WEDDING_TIMEZONE (например, Europe/Moscow)
+	weddingTZ := time.Local
+	if v := strings.TrimSpace(os.Getenv("WEDDING_TIMEZONE")); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			log.Fatalf("WEDDING_TIMEZONE: %v", err)
+		}
+		weddingTZ = loc
 	}
-	store := &rsvpStore{path: dataPath}
-	reminderSentPath := filepath.Join(filepath.Dir(dataPath), "reminder_sent.json")
-	reminderSent := &reminderSentStore{path: reminderSentPath}
-
-	// Telegram
-	tgToken := strings.TrimSpace(os.Getenv("TELEGRAM_BOT_TOKEN"))
-	tgEnabled := tgToken != ""
-	var tg *tgClient
-	var tgStore *tgUserStore
-	if tgEnabled {
-		tg = newTelegramClient(tgToken)
-		tgStore = &tgUserStore{path: filepath.Join(filepath.Dir(dataPath), "tg_users.json")}
-		log.Printf("Telegram бот инициализирован")
+	// Сколько после времени напоминания его ещё можно отправить, если сервер не работал
+	reminderGrace := defaultReminderGrace
+	if v := strings.TrimSpace(os.Getenv("REMINDER_GRACE")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("REMINDER_GRACE неверный формат (например, 12h): %q", v)
+		}
+		reminderGrace = d
 	}
 
+	var weddingDate time.Time
 	weddingDateStr := strings.TrimSpace(os.Getenv("WEDDING_DATE"))
 	if weddingDateStr != "" {
-		weddingDate, err := time.ParseInLocation("2006-01-02", weddingDateStr, time.Local)
+		d, err := time.ParseInLocation("2006-01-02", weddingDateStr, weddingTZ)
 		if err != nil {
 			log.Printf("WEDDING_DATE неверный формат (нужен 2006-01-02), напоминания отключены: %v", err)
 		} else {
-			go runReminderLoop(client, fromEmail, store, reminderSent, weddingDate, tg, tgStore)
+			weddingDate = d
+			if os.Getenv("WEDDING_TIMEZONE") == "" {
+				log.Printf("WEDDING_TIMEZONE не задан, напоминания по часовому поясу сервера (%s)", weddingTZ)
+			}
 		}
 	}
+	return weddingDate, reminderGrace
+}
 
-	// Переменные для подстановки в шаблоны
+// weddingInfoFromEnv — место и время свадьбы для страницы и писем.
+func weddingInfoFromEnv() weddingInfo {
 	placeName := strings.TrimSpace(os.Getenv("WEDDING_PLACE_NAME"))
 	if placeName == "" {
 		placeName = "Название места, город"
@@ -425,250 +171,272 @@ func main() {
 	if weddingTimeDisplay == "" {
 		weddingTimeDisplay = "16:30"
 	}
-
-	mux := http.NewServeMux()
-
-	// Telegram webhook для регистрации пользователей
-	if tgEnabled {
-		mux.HandleFunc("/api/tg/webhook", handleTelegramWebhook(tg, tgStore, placeURL, store))
-		mux.HandleFunc("/api/tg/init", handleTelegramInit(tg, tgStore))
+	return weddingInfo{
+		placeName:   placeName,
+		placeURL:    placeURL,
+		dateDisplay: weddingDateDisplay,
+		timeDisplay: weddingTimeDisplay,
 	}
+}
 
-	mux.HandleFunc("/api/rsvp", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			runImportCommand(os.Args[2:])
 			return
-		}
-		if ct := r.Header.Get("Content-Type"); !strings.Contains(ct, "application/json") {
-			http.Error(w, `{"error":"content-type must be application/json"}`, http.StatusUnsupportedMediaType)
+		case "admin":
+			runAdminCommand(os.Args[2:])
 			return
-		}
-		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
-		dec := json.NewDecoder(r.Body)
-		var body RSVPRequest
-		if err := dec.Decode(&body); err != nil {
-			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		case "reminders":
+			runRemindersCommand(os.Args[2:])
 			return
 		}
+	}
 
-		name := strings.TrimSpace(body.Name)
-		phone := strings.TrimSpace(body.Phone)
-		email := strings.TrimSpace(body.Email)
-		guestCount := body.GuestCount
-		if guestCount < 1 {
-			guestCount = 1
-		}
-		if guestCount > 20 {
-			guestCount = 20
-		}
+	toEmail := strings.TrimSpace(os.Getenv("RSVP_TO_EMAIL"))
+	staticDir := os.Getenv("STATIC_DIR")
+	if staticDir == "" {
+		staticDir = ".."
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
 
-		if name == "" || len(name) > 200 {
-			http.Error(w, `{"error":"name required, max 200 chars"}`, http.StatusBadRequest)
-			return
-		}
-		phoneDigits := strings.Map(func(r rune) rune {
-			if r >= '0' && r <= '9' {
-				return r
-			}
-			return -1
-		}, phone)
-		if len(phoneDigits) < 10 {
-			http.Error(w, `{"error":"phone required, at least 10 digits"}`, http.StatusBadRequest)
-			return
-		}
-		if email != "" && (len(email) > 254 || !strings.Contains(email, "@")) {
-			http.Error(w, `{"error":"invalid email"}`, http.StatusBadRequest)
-			return
-		}
+	limiter := &rsvpLimiter{counts: make(map[string][]time.Time)}
+	exportSecret := strings.TrimSpace(os.Getenv("EXPORT_SECRET"))
+	dataPath := dataPathFromEnv()
 
-		ip := r.RemoteAddr
-		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-			ip = strings.TrimSpace(strings.Split(xff, ",")[0])
-		}
-		if !limiter.allow(ip) {
-			http.Error(w, `{"error":"too many requests"}`, http.StatusTooManyRequests)
-			return
+	// Почта: Resend, SMTP или .eml-файлы (см. mailerFromEnv); без настроек сервер работает без писем
+	mail, mailInfo, err := mailerFromEnv(dataPath)
+	if err != nil {
+		log.Fatalf("почта: %v", err)
+	}
+	if mail == nil {
+		log.Printf("почта выключена: задайте MAIL_PROVIDER или RESEND_API_KEY")
+	} else {
+		log.Printf("почта: %s", mailInfo)
+		if toEmail == "" {
+			log.Printf("RSVP_TO_EMAIL не задан, письма о новых ответах не отправляются")
 		}
+	}
+	// Хранилище: json (файлы рядом с RSVP_DATA_PATH) или sqlite (SQLITE_PATH, по умолчанию wedding.db там же)
+	storageDriver := strings.TrimSpace(os.Getenv("STORAGE_DRIVER"))
+	st, err := openStorage(storageDriver, dataPath, strings.TrimSpace(os.Getenv("SQLITE_PATH")))
+	if err != nil {
+		log.Fatalf("хранилище: %v", err)
+	}
+	defer st.close()
+	store := st.rsvps
+	reminderSent := st.reminders
 
-		subjectName := strings.ReplaceAll(name, "\n", " ")
-		subjectName = strings.ReplaceAll(subjectName, "\r", " ")
+	tokens, cancelTTL := tokensFromEnv(dataPath)
+	siteURL := siteURLFromEnv()
+	// Прокси перед сервером (nginx, Caddy): без TRUSTED_PROXIES X-Forwarded-For не учитывается
+	if trustedProxies, err = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		log.Fatalf("TRUSTED_PROXIES: %v", err)
+	}
 
-		// Вам — одна строка: кто ответил и контакты (без формальных подписей)
-		noticeHTML := "<p>" + escapeHTML(name) + " — " + escapeHTML(phone)
-		if email != "" {
-			noticeHTML += ", " + escapeHTML(email)
+	// Telegram
+	tgToken := strings.TrimSpace(os.Getenv("TELEGRAM_BOT_TOKEN"))
+	tgEnabled := tgToken != ""
+	tg := telegramClientFromEnv()
+	var tgStore tgUserStore
+	if tgEnabled {
+		tgStore = st.tgUsers
+		log.Printf("Telegram бот инициализирован")
+	}
+	// Секрет вебхука: Telegram присылает его в X-Telegram-Bot-Api-Secret-Token
+	tgWebhookSecret := strings.TrimSpace(os.Getenv("TELEGRAM_WEBHOOK_SECRET"))
+	if tgWebhookSecret != "" && !validWebhookSecret(tgWebhookSecret) {
+		log.Fatal("TELEGRAM_WEBHOOK_SECRET: 1–256 символов A-Z, a-z, 0-9, _ и -")
+	}
+	tgAllowedUpdates := []string{"message", "callback_query"}
+	if v := strings.TrimSpace(os.Getenv("TELEGRAM_ALLOWED_UPDATES")); v != "" {
+		tgAllowedUpdates = nil
+		for _, u := range strings.Split(v, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				tgAllowedUpdates = append(tgAllowedUpdates, u)
+			}
 		}
-		noticeHTML += "</p>"
-		_, err := client.Emails.Send(&resend.SendEmailRequest{
-			From:    fromEmail,
-			To:      []string{toEmail},
-			Subject: "Ответил(а) " + subjectName,
-			Html:    noticeHTML,
-		})
-		if err != nil {
-			log.Printf("resend send: %v", err)
-			http.Error(w, `{"error":"failed to send"}`, http.StatusInternalServerError)
-			return
+	}
+	// Режим получения обновлений: webhook (по умолчанию) или polling — для локальной разработки и серверов за NAT
+	tgMode := strings.ToLower(strings.TrimSpace(os.Getenv("TELEGRAM_MODE")))
+	if tgMode == "" {
+		tgMode = "webhook"
+	}
+	if tgMode != "webhook" && tgMode != "polling" {
+		log.Fatalf("TELEGRAM_MODE: нужен webhook или polling, получено %q", tgMode)
+	}
+	var bot *tgBot
+	if tgEnabled {
+		bot = &tgBot{tg: tg, users: tgStore, rsvps: store, audit: st.audit, siteURL: siteURL}
+		if tgMode == "webhook" {
+			if tgWebhookSecret == "" {
+				log.Printf("ВНИМАНИЕ: TELEGRAM_WEBHOOK_SECRET не задан — /api/tg/webhook примет обновление от кого угодно, в том числе нажатие «Отменить» от имени любого chat_id")
+			}
+			go registerWebhook(tg, strings.TrimSpace(os.Getenv("TELEGRAM_WEBHOOK_URL")), tgWebhookSecret, tgAllowedUpdates)
 		}
-
-		// Гостю — тёплое короткое письмо (если указал почту)
-		if email != "" {
-			cancelURL := "https://alexandr-i-daria.ru/cancel?email=" + email
-			
-			thankHTML := `<p>Привет!</p><p>Мы получили ваш ответ и очень рады, что вы будете с нами.</p><p>Ждём встречи, обнимаем.</p>`
-			thankHTML += `<p style="margin-top: 1.5rem;">Если ваши планы изменятся, вы можете <a href="` + cancelURL + `" style="color: #d08888; text-decoration: underline;">отменить здесь</a>.</p>`
-			
-			_, _ = client.Emails.Send(&resend.SendEmailRequest{
-				From:    fromEmail,
-				To:      []string{email},
-				Subject: "Рады, что придёте!",
-				Html:    thankHTML,
-			})
+	}
+	// Сколько живёт initData из Web App (auth_date), по умолчанию сутки
+	tgInitMaxAge := 24 * time.Hour
+	if v := strings.TrimSpace(os.Getenv("TELEGRAM_INIT_MAX_AGE")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("TELEGRAM_INIT_MAX_AGE неверный формат (например, 1h): %q", v)
 		}
+		tgInitMaxAge = d
+	}
 
-		// Отправка приглашения в Telegram (если пользователь зарегистрирован)
-		if tgEnabled && tg != nil && tgStore != nil && body.TelegramChatID != nil {
-			// Сначала сохраняем/обновляем пользователя
-			_ = tgStore.save(tgUser{
-				ChatID: *body.TelegramChatID,
-				Phone:  phone,
-				Name:   name,
-			})
-			log.Printf("TG: сохранён пользователь chat_id=%d, phone=%s", *body.TelegramChatID, phone)
-			
-			// Теперь ищем и отправляем
-			if user, found := tgStore.get(phone); found {
-				log.Printf("RSVP: пользователь найден, chat_id=%d, отправка в Telegram", user.ChatID)
-				
-				// Сообщение с кнопкой отмены
-				reply := fmt.Sprintf("✨ *Спасибо, %s!*\n\nМы так рады, что вы будете с нами! 💕\n\n📍 *Детали:*\nДата: %s\nВремя: %s\nМесто: %s\n\nДо встречи на празднике!\n\n_Если ваши планы изменятся, пожалуйста, сообщите нам об этом — просто нажмите на кнопку ниже._",
-					escapeMarkdown(name),
-					weddingDateDisplay,
-					weddingTimeDisplay,
-					placeName)
-				
-				// Отправляем с кнопкой отмены
-				go func() {
-					if err := tg.sendMessageWithCancel(user.ChatID, reply, "❌ Отменить"); err != nil {
-						log.Printf("telegram send to %s: %v", name, err)
-					} else {
-						log.Printf("telegram отправлено %s (chat_id=%d)", name, user.ChatID)
-					}
-				}()
-			}
-		} else {
-			// Отправка приглашения в Telegram (если пользователь уже был в базе)
-			if tgEnabled && tg != nil && tgStore != nil {
-				log.Printf("RSVP: поиск пользователя по телефону: %s", phone)
-				if user, found := tgStore.get(phone); found {
-					log.Printf("RSVP: пользователь найден, chat_id=%d, отправка в Telegram", user.ChatID)
-					
-					// Сообщение с кнопкой отмены
-					reply := fmt.Sprintf("✨ *Спасибо, %s!*\n\nМы так рады, что вы будете с нами! 💕\n\n📍 *Детали:*\nДата: %s\nВремя: %s\nМесто: %s\n\nДо встречи на празднике!\n\n_Если ваши планы изменятся, пожалуйста, сообщите нам об этом — просто нажмите на кнопку ниже._",
-						escapeMarkdown(name),
-						weddingDateDisplay,
-						weddingTimeDisplay,
-						placeName)
-					
-					go func() {
-						if err := tg.sendMessageWithCancel(user.ChatID, reply, "❌ Отменить"); err != nil {
-							log.Printf("telegram send to %s: %v", name, err)
-						} else {
-							log.Printf("telegram отправлено %s (chat_id=%d)", name, user.ChatID)
-						}
-					}()
-				} else {
-					log.Printf("RSVP: пользователь НЕ найден в tg_users.json")
-				}
-			}
-		}
+	weddingDate, reminderGrace := weddingScheduleFromEnv()
+	// Переменные для подстановки в шаблоны
+	wedding := weddingInfoFromEnv()
 
-		// Проверка на дубликат (по телефону)
-		phoneNorm := normalizePhone(phone)
-		existingList, _ := store.list()
-		for _, r := range existingList {
-			if normalizePhone(r.Phone) == phoneNorm {
-				// Уже есть такая запись — не добавляем дубликат
-				log.Printf("RSVP: дубликат телефона %s, пропускаем", phone)
-				w.Header().Set("Content-Type", "application/json; charset=utf-8")
-				w.WriteHeader(http.StatusOK)
-				w.Write([]byte(`{"ok":true,"duplicate":true}`))
-				return
-			}
-		}
+	// Дополнительные вопросы анкеты: JSON-файл со списком, см. question
+	questions, err := loadQuestions(strings.TrimSpace(os.Getenv("RSVP_QUESTIONS_PATH")))
+	if err != nil {
+		log.Fatalf("RSVP_QUESTIONS_PATH: %v", err)
+	}
+	if len(questions) > 0 {
+		log.Printf("дополнительных вопросов в анкете: %d", len(questions))
+	}
 
-		_ = store.append(storedRSVP{
-			Name:           name,
-			Phone:          phone,
-			Email:          email,
-			GuestCount:     body.GuestCount,
-			TelegramChatID: body.TelegramChatID,
-			At:             time.Now().UTC().Format(time.RFC3339),
-		})
+	// Напоминания: правила из REMINDERS_PATH (JSON-список, см. reminderRule) или одно за 10 дней
+	reminderRules, err := loadReminderRules(strings.TrimSpace(os.Getenv("REMINDERS_PATH")), questions)
+	if err != nil {
+		log.Fatalf("REMINDERS_PATH: %v", err)
+	}
 
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"ok":true}`))
-	})
+	// Учётные записи панели управления: ADMIN_USERS (логин:роль:bcrypt-хеш) и созданные командой «admin»
+	configAdmins, err := parseAdminUsers(os.Getenv("ADMIN_USERS"))
+	if err != nil {
+		log.Fatalf("ADMIN_USERS: %v", err)
+	}
+	if stored, err := st.admins.list(); err == nil && len(configAdmins)+len(stored) == 0 {
+		log.Printf("учётных записей админки нет, /admin недоступна; создайте: wedding-rsvp admin add <логин> owner")
+	}
+
+	// RSVP_REQUIRE_INVITE=1 — новые ответы только по персональным кодам приглашений
+	requireInvite, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("RSVP_REQUIRE_INVITE")))
+
+	a := &app{
+		mail:          mail,
+		toEmail:       toEmail,
+		rsvps:         store,
+		limiter:       limiter,
+		tokens:        tokens,
+		cancelTTL:     cancelTTL,
+		siteURL:       siteURL,
+		wedding:       wedding,
+		questions:     questions,
+		invitations:   st.invitations,
+		requireInvite: requireInvite,
+		exportSecret:  exportSecret,
+		configAdmins:  configAdmins,
+		admins:        st.admins,
+		audit:         st.audit,
+		loginLimiter:  &rsvpLimiter{counts: make(map[string][]time.Time)},
+		loginFailures: newLoginFailures(),
+		weddingDate:   weddingDate,
+		reminders:     reminderSent,
+		reminderRules: reminderRules,
+		reminderGrace: reminderGrace,
+		state:         st.state,
+		tg:            tg,
+		// без бота пользователи Telegram нужны только админке
+		tgUsers:      st.tgUsers,
+		tgToken:      tgToken,
+		tgInitMaxAge: tgInitMaxAge,
+	}
+	// доставка уведомлений шлёт письма через a.mail и сообщения через a.tg, поэтому очередь создаётся после app
+	a.outbox = newOutbox(st.outbox, a.deliverNotification)
 
-	mux.HandleFunc("/api/export", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "", http.StatusMethodNotAllowed)
-			return
-		}
-		key := r.Header.Get("X-Export-Key")
-		if key == "" {
-			key = r.URL.Query().Get("key")
-		}
-		if exportSecret == "" || key != exportSecret {
-			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
-			return
-		}
-		list, err := store.list()
-		if err != nil {
-			log.Printf("export list: %v", err)
-			http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
-			return
-		}
-		f := excelize.NewFile()
-		sheet := "Ответы"
-		idx, _ := f.NewSheet(sheet)
-		f.SetActiveSheet(idx)
-		f.DeleteSheet("Sheet1")
-		headers := []string{"ФИО", "Телефон", "Почта", "Гостей", "Дата"}
-		for i, h := range headers {
-			cell, _ := excelize.CoordinatesToCellName(i+1, 1)
-			_ = f.SetCellValue(sheet, cell, h)
-		}
-		for row, entry := range list {
-			r := strconv.Itoa(row + 2)
-			_ = f.SetCellValue(sheet, "A"+r, entry.Name)
-			_ = f.SetCellValue(sheet, "B"+r, entry.Phone)
-			_ = f.SetCellValue(sheet, "C"+r, entry.Email)
-			_ = f.SetCellValue(sheet, "D"+r, entry.GuestCount)
-			_ = f.SetCellValue(sheet, "E"+r, formatExportDate(entry.At))
-		}
-		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-		w.Header().Set("Content-Disposition", `attachment; filename="rsvp.xlsx"`)
-		if err := f.Write(w); err != nil {
-			log.Printf("export write: %v", err)
-		}
-	})
+	mux := http.NewServeMux()
+
+	// Telegram webhook для регистрации пользователей
+	if tgEnabled {
+		if tgMode == "webhook" {
+			mux.HandleFunc("/api/tg/webhook", handleTelegramWebhook(bot, tgWebhookSecret))
+		}
+		mux.HandleFunc("/api/tg/init", handleTelegramInit(tgToken, tgInitMaxAge, tgStore))
+	}
+
+	mux.HandleFunc("/api/rsvp", a.handleRSVP())
+	mux.HandleFunc("/api/questions", a.handleQuestions())
+	mux.HandleFunc("/api/invitation", a.handleInvitation())
+	mux.HandleFunc("/api/admin/invitations", a.handleAdminInvitations())
+	mux.HandleFunc("/api/admin/import", a.handleAdminImport())
+	mux.HandleFunc("/api/admin/rsvps", a.handleAdminRSVPs())
+	mux.HandleFunc("/api/admin/rsvps/", a.handleAdminRSVPs())
+	mux.HandleFunc("/api/admin/tg-users", a.handleAdminTgUsers())
+	mux.HandleFunc("/api/admin/tg-users/", a.handleAdminTgUsers())
+	mux.HandleFunc("/api/admin/stats", a.handleAdminStats())
+	mux.HandleFunc("/api/admin/audit", a.handleAdminAudit())
+	mux.HandleFunc("/api/admin/outbox", a.handleAdminOutbox())
+	mux.HandleFunc("/api/admin/outbox/", a.handleAdminOutbox())
+	mux.HandleFunc("/api/admin/reminders", a.handleAdminReminders())
+	mux.HandleFunc("/api/admin/reminders/", a.handleAdminReminders())
+	mux.HandleFunc("/api/admin/broadcasts", a.handleAdminBroadcasts())
+	mux.HandleFunc("/api/admin/broadcasts/", a.handleAdminBroadcasts())
+	mux.HandleFunc("/api/admin/users", a.handleAdminUsers())
+	mux.HandleFunc("/api/admin/users/", a.handleAdminUsers())
+	mux.HandleFunc("/admin", a.handleAdminPage())
+	mux.HandleFunc("/admin/", a.handleAdminPage())
+	mux.HandleFunc("/admin/login", a.handleAdminLogin())
+	mux.HandleFunc("/admin/logout", a.handleAdminLogout())
+
+	mux.HandleFunc("/api/export", a.handleExport())
 
 	// API для отмены RSVP
-	mux.HandleFunc("/api/cancel", handleCancel(store))
+	mux.HandleFunc("/api/cancel", handleCancel(store, tokens, cancelTTL, st.audit))
 
 	fs := http.FileServer(http.Dir(staticDir))
-	mux.Handle("/", indexWithPlace(staticDir, placeName, placeURL, weddingDateDisplay, weddingTimeDisplay, fs))
+	mux.Handle("/", indexWithPlace(staticDir, wedding.placeName, wedding.placeURL, wedding.dateDisplay, wedding.timeDisplay, fs))
 	mux.Handle("/cancel", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, staticDir+"/cancel.html")
 	}))
 
+	// SIGINT/SIGTERM: перестаём принимать запросы, дожидаемся фоновых задач и закрываем хранилище
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.outbox.run(ctx)
+	}()
+	if !weddingDate.IsZero() && len(reminderRules) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.runReminders(ctx)
+		}()
+	}
+	if tgEnabled && tgMode == "polling" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runTelegramPolling(ctx, bot, st.state, tgAllowedUpdates)
+		}()
+	}
+
 	addr := ":" + port
+	srv := &http.Server{Addr: addr, Handler: cors(mux)}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
 	log.Printf("слушаем %s, статика: %s", addr, staticDir)
-	if err := http.ListenAndServe(addr, cors(mux)); err != nil {
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+	wg.Wait()
+	log.Printf("остановлен")
 }
 
 // indexWithPlace отдаёт главную страницу с подстановкой WEDDING_PLACE_* и WEDDING_* из env, остальное — через fs.
@@ -723,222 +491,9 @@ func escapeMarkdown(s string) string {
 	return s
 }
 
-// formatExportDate переводит RFC3339 (2026-02-13T18:55:36Z) в вид "13.02.2026 18:55"
-func formatExportDate(s string) string {
-	t, err := time.Parse(time.RFC3339, s)
-	if err != nil {
-		return s
-	}
-	return t.Format("02.01.2006 15:04")
-}
-
-// runReminderLoop раз в сутки проверяет: если сегодня «дата свадьбы − 10 дней», шлёт напоминание гостям с почтой и Telegram.
-func runReminderLoop(client *resend.Client, fromEmail string, store *rsvpStore, sent *reminderSentStore, weddingDate time.Time, tg *tgClient, tgStore *tgUserStore) {
-	reminderDay := weddingDate.AddDate(0, 0, -10)
-	reminderYear, reminderMonth, reminderDayNum := reminderDay.Date()
-
-	sleepUntilNextCheck := func() {
-		now := time.Now()
-		next := time.Date(now.Year(), now.Month(), now.Day(), 9, 0, 0, 0, time.Local)
-		if now.After(next) || now.Equal(next) {
-			next = next.AddDate(0, 0, 1)
-		}
-		d := next.Sub(now)
-		if d < time.Minute {
-			d = time.Minute
-		}
-		time.Sleep(d)
-	}
-
-	// первый запуск через минуту, чтобы не мешать старту
-	time.Sleep(time.Minute)
-
-	for {
-		now := time.Now()
-		y, m, d := now.Date()
-		if y == reminderYear && m == reminderMonth && d == reminderDayNum {
-			list, err := store.list()
-			if err != nil {
-				log.Printf("напоминания: не загрузить список: %v", err)
-				sleepUntilNextCheck()
-				continue
-			}
-			already, err := sent.list()
-			if err != nil {
-				log.Printf("напоминания: не загрузить sent: %v", err)
-				sleepUntilNextCheck()
-				continue
-			}
-			var toSendEmail []string
-			for _, r := range list {
-				e := strings.TrimSpace(strings.ToLower(r.Email))
-				if e != "" && !already[e] {
-					toSendEmail = append(toSendEmail, r.Email)
-				}
-			}
-			emailBody := `<p>Привет!</p><p>Напоминаем: через 10 дней наша свадьба.</p><p>Очень ждём вас!</p>`
-			for _, to := range toSendEmail {
-				_, err := client.Emails.Send(&resend.SendEmailRequest{
-					From:    fromEmail,
-					To:      []string{to},
-					Subject: "Через 10 дней — ждём вас!",
-					Html:    emailBody,
-				})
-				if err != nil {
-					log.Printf("напоминание email %s: %v", to, err)
-				}
-			}
-			if len(toSendEmail) > 0 {
-				_ = sent.add(toSendEmail)
-				log.Printf("напоминания email: отправлено %d гостям", len(toSendEmail))
-			}
-
-			// Telegram напоминания
-			if tg != nil && tgStore != nil {
-				tgUsers, err := tgStore.list()
-				if err != nil {
-					log.Printf("напоминания TG: не загрузить пользователей: %v", err)
-				} else {
-					tgMessage := "💌 *Напоминание о свадьбе!*\n\nПривет! Напоминаем, что через 10 дней наша свадьба.\n\nОчень ждём вас на празднике!\n\n💕 Александр & Дарья"
-					sentCount := 0
-					for _, user := range tgUsers {
-						if err := tg.sendMessage(user.ChatID, tgMessage, "Markdown"); err != nil {
-							log.Printf("напоминание TG %s: %v", user.Name, err)
-						} else {
-							sentCount++
-						}
-					}
-					if sentCount > 0 {
-						log.Printf("напоминания TG: отправлено %d гостям", sentCount)
-					}
-				}
-			}
-		}
-		sleepUntilNextCheck()
-	}
-}
-
-// Telegram webhook handler
-func handleTelegramWebhook(tg *tgClient, store *tgUserStore, placeURL string, rsvpStore *rsvpStore) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		var update struct {
-			Message *struct {
-				Chat struct {
-					ID   int64  `json:"id"`
-					Type string `json:"type"`
-				} `json:"chat"`
-				From *struct {
-					ID        int64  `json:"id"`
-					FirstName string `json:"first_name"`
-					Username  string `json:"username"`
-				} `json:"from"`
-				Text string `json:"text"`
-			} `json:"message"`
-			CallbackQuery *struct {
-				ID     string `json:"id"`
-				From   *struct {
-					ID int64 `json:"id"`
-				} `json:"from"`
-				Data string `json:"data"`
-			} `json:"callback_query"`
-		}
-
-		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-
-		// Обработка callback query (кнопки)
-		if update.CallbackQuery != nil {
-			chatID := update.CallbackQuery.From.ID
-			data := update.CallbackQuery.Data
-			
-			if data == "cancel_rsvp" {
-				// Удаляем RSVP пользователя
-				_ = cancelRSVPByChatID(rsvpStore, store, chatID)
-				
-				// Отвечаем на callback
-				answerCallback(tg, update.CallbackQuery.ID)
-				
-				// Отправляем подтверждение отмены
-				_ = tg.sendMessage(chatID, "✅ Отменено.\n\nЕсли передумаете — заполните форму снова, мы будем рады! 💕", "")
-			}
-			
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		if update.Message == nil {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		chatID := update.Message.Chat.ID
-		userName := ""
-		if update.Message.From != nil {
-			if update.Message.From.Username != "" {
-				userName = "@" + update.Message.From.Username
-			} else {
-				userName = update.Message.From.FirstName
-			}
-		}
-
-		text := update.Message.Text
-
-		// Обработка /start
-		if text == "/start" {
-			// URL для Web App — всегда сайт, а не карта
-			webAppURL := "https://alexandr-i-daria.ru"
-			
-			reply := "🎉 *Привет!*\n\nМы очень рады, что вы с нами! 💕\n\nПожалуйста, заполните небольшую форму — это поможет нам всё организовать наилучшим образом.\n\nНажмите на кнопку ниже."
-			
-			// Отправляем текст с кнопкой Web App
-			tg.sendWebApp(chatID, reply, webAppURL, "🎊 Я приду!")
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// Обработка /phone +79990000000
-		if strings.HasPrefix(text, "/phone ") {
-			phone := strings.TrimSpace(strings.TrimPrefix(text, "/phone "))
-			if phone != "" {
-				_ = store.save(tgUser{
-					ChatID: chatID,
-					Phone:  phone,
-					Name:   userName,
-				})
-				reply := fmt.Sprintf("✅ *Отлично!*\n\nВаш номер %s сохранён.\n\nТеперь, когда вы заполните форму RSVP, мы отправим вам приглашение здесь!", phone)
-				_ = tg.sendMessage(chatID, reply, "Markdown")
-			} else {
-				_ = tg.sendMessage(chatID, "❌ Пожалуйста, укажите номер после `/phone`", "")
-			}
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// Обработка номера телефона в любом формате (сохраняем)
-		phoneDigits := normalizePhone(text)
-		if len(phoneDigits) >= 10 {
-			_ = store.save(tgUser{
-				ChatID: chatID,
-				Phone:  text,
-				Name:   userName,
-			})
-			reply := fmt.Sprintf("✅ *Отлично!*\n\nВаш номер %s сохранён.\n\nТеперь, когда вы заполните форму RSVP, мы отправим вам приглашение здесь!", text)
-			_ = tg.sendMessage(chatID, reply, "Markdown")
-		}
-
-		w.WriteHeader(http.StatusOK)
-	}
-}
-
-// handleTelegramInit — сохранение chat_id при открытии сайта из Telegram
-func handleTelegramInit(tg *tgClient, store *tgUserStore) http.HandlerFunc {
+// handleTelegramInit — сохранение chat_id при открытии сайта из Telegram.
+// chat_id и имя берутся только из initData с проверенной подписью бота.
+func handleTelegramInit(botToken string, maxAge time.Duration, store tgUserStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
@@ -946,34 +501,34 @@ func handleTelegramInit(tg *tgClient, store *tgUserStore) http.HandlerFunc {
 		}
 
 		var req struct {
-			ChatID    int64  `json:"chat_id"`
-			FirstName string `json:"first_name"`
-			Username  string `json:"username"`
-			Phone     string `json:"phone"`
+			InitData string `json:"init_data"`
+			Phone    string `json:"phone"`
 		}
 
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
 			return
 		}
 
-		if req.ChatID == 0 {
-			http.Error(w, `{"error":"chat_id required"}`, http.StatusBadRequest)
+		if req.InitData == "" {
+			http.Error(w, `{"error":"init_data required"}`, http.StatusBadRequest)
 			return
 		}
-
-		name := req.FirstName
-		if req.Username != "" {
-			name = "@" + req.Username
+		initData, err := verifyTelegramInitData(botToken, req.InitData, maxAge)
+		if err == errInitDataStale {
+			http.Error(w, `{"error":"init_data expired"}`, http.StatusUnauthorized)
+			return
 		}
-		if name == "" {
-			name = "Telegram User"
+		if err != nil {
+			http.Error(w, `{"error":"invalid init_data"}`, http.StatusUnauthorized)
+			return
 		}
 
 		if err := store.save(tgUser{
-			ChatID: req.ChatID,
+			ChatID: initData.User.ID,
 			Phone:  req.Phone,
-			Name:   name,
+			Name:   initData.displayName(),
 		}); err != nil {
 			log.Printf("tg init save: %v", err)
 			http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
@@ -985,121 +540,78 @@ func handleTelegramInit(tg *tgClient, store *tgUserStore) http.HandlerFunc {
 	}
 }
 
-// answerCallback отвечает на callback query
-func answerCallback(tg *tgClient, callbackID string) {
-	apiURL := tg.apiURL + "/answerCallbackQuery"
-	payload := map[string]interface{}{
-		"callback_query_id": callbackID,
-	}
-	data, _ := json.Marshal(payload)
-	_, _ = http.Post(apiURL, "application/json", bytes.NewReader(data))
-}
-
-// cancelRSVPByChatID удаляет RSVP пользователя по chat_id
-func cancelRSVPByChatID(rsvpStore *rsvpStore, tgStore *tgUserStore, chatID int64) error {
-	// Находим пользователя
-	users, err := tgStore.list()
-	if err != nil {
-		return err
-	}
-	
-	var userPhone string
-	for _, u := range users {
-		if u.ChatID == chatID {
-			userPhone = u.Phone
-			break
-		}
-	}
-
-	// Удаляем RSVP из списка
-	rsvpStore.mu.Lock()
-	defer rsvpStore.mu.Unlock()
-
-	var list []storedRSVP
-	data, err := os.ReadFile(rsvpStore.path)
-	if err == nil {
-		_ = json.Unmarshal(data, &list)
-	}
-
-	// Фильтруем - удаляем записи с этим телефоном ИЛИ этим chat_id
-	var newList []storedRSVP
-	for _, r := range list {
-		// Удаляем если совпадает телефон или chat_id
-		shouldRemove := false
-		if userPhone != "" && normalizePhone(r.Phone) == normalizePhone(userPhone) {
-			shouldRemove = true
-		}
-		if r.TelegramChatID != nil && *r.TelegramChatID == chatID {
-			shouldRemove = true
-		}
-		if !shouldRemove {
-			newList = append(newList, r)
-		}
-	}
-
-	// Сохраняем обновлённый список
-	data, err = json.MarshalIndent(newList, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(rsvpStore.path, data, 0644)
-}
-
-// handleCancel обрабатывает отмену RSVP по email
-func handleCancel(store *rsvpStore) http.HandlerFunc {
+// handleCancel — отмена RSVP по подписанному токену из письма.
+// GET ?token= показывает, чей ответ будет отменён (и даёт токен для «передумал — изменить ответ»);
+// POST {"token":...} отмечает его как «не придёт».
+func handleCancel(store rsvpStore, tokens *tokenSigner, editTTL time.Duration, audit auditStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+		var token string
+		switch r.Method {
+		case http.MethodGet:
+			token = r.URL.Query().Get("token")
+		case http.MethodPost:
+			var req struct {
+				Token string `json:"token"`
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+				return
+			}
+			token = req.Token
+		default:
 			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
 			return
 		}
 
-		var req struct {
-			Email string `json:"email"`
+		id, err := tokens.verify(tokenPurposeCancel, token)
+		if err == errTokenExpired {
+			http.Error(w, `{"error":"link expired"}`, http.StatusGone)
+			return
 		}
-
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		if err != nil {
+			http.Error(w, `{"error":"invalid link"}`, http.StatusForbidden)
 			return
 		}
-
-		email := strings.TrimSpace(strings.ToLower(req.Email))
-		if email == "" {
-			http.Error(w, `{"error":"email required"}`, http.StatusBadRequest)
+		entry, found, err := store.get(id)
+		if err != nil {
+			log.Printf("cancel get %s: %v", id, err)
+			http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
 			return
 		}
-
-		// Находим и удаляем RSVP по email
-		store.mu.Lock()
-		defer store.mu.Unlock()
-
-		var list []storedRSVP
-		data, err := os.ReadFile(store.path)
-		if err == nil {
-			_ = json.Unmarshal(data, &list)
+		if !found {
+			http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+			return
 		}
 
-		// Фильтруем - удаляем записи с этим email
-		var newList []storedRSVP
-		for _, r := range list {
-			if strings.ToLower(strings.TrimSpace(r.Email)) != email {
-				newList = append(newList, r)
-			}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"ok":          true,
+				"name":        entry.Name,
+				"guest_count": entry.headcount(),
+				"status":      entry.attendance(),
+				"edit_token":  tokens.sign(tokenPurposeEdit, entry.ID, time.Now().Add(editTTL)),
+			})
+			return
 		}
 
-		// Сохраняем обновлённый список
-		data, err = json.MarshalIndent(newList, "", "  ")
-		if err != nil {
-			http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+		// Повторное нажатие ничего не меняет
+		if entry.attendance() == statusDeclined {
+			w.Write([]byte(`{"ok":true}`))
 			return
 		}
-
-		if err := os.WriteFile(store.path, data, 0644); err != nil {
+		now := time.Now()
+		old := *entry
+		entry.markDeclined(now)
+		entry.recordRevision(revisionSourceCancelLink, diffRSVP(old, *entry, nil), now)
+		if err := store.update(*entry); err != nil {
+			log.Printf("cancel update %s: %v", entry.ID, err)
 			http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
+		recordAudit(audit, auditEntry{Action: auditCancel, Channel: auditChannelEmail, Actor: auditActorGuest, IP: clientIP(r), Before: &old, After: entry})
+		log.Printf("RSVP: отменён по ссылке: %s (%s)", entry.Name, entry.Phone)
 		w.Write([]byte(`{"ok":true}`))
 	}
 }
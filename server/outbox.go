@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Виды сообщений в очереди.
+const (
+	outboxEmail    = "email"
+	outboxTelegram = "telegram"
+)
+
+// Состояния сообщения: ждёт отправки (в том числе повтора), отправлено, брошено после outboxMaxAttempts попыток.
+const (
+	outboxPending = "pending"
+	outboxSent    = "sent"
+	outboxDead    = "dead"
+)
+
+const (
+	outboxMaxAttempts = 8
+	// повтор через outboxBaseDelay·2^(попытка−1), но не реже чем раз в outboxMaxDelay
+	outboxBaseDelay = 30 * time.Second
+	outboxMaxDelay  = 2 * time.Hour
+	// outboxPollEvery — как часто проверять очередь, если никто не разбудил воркер
+	outboxPollEvery = 15 * time.Second
+	outboxBatch     = 20
+	// outboxRetention — сколько хранятся отправленные и брошенные сообщения; старше удаляются раз в outboxPruneEvery.
+	// Вместе с ними пропадают и следы старых рассылок, поэтому рассылку с тем же id после этого можно отправить снова.
+	outboxRetention  = 30 * 24 * time.Hour
+	outboxPruneEvery = time.Hour
+)
+
+// outboxMessage — уведомление, которое нужно доставить: письмо или сообщение в Telegram.
+type outboxMessage struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// RSVPID — ответ, о котором уведомление (пусто у служебных писем)
+	RSVPID string `json:"rsvp_id,omitempty"`
+	// Broadcast — id рассылки, если сообщение из неё (см. handleAdminBroadcasts)
+	Broadcast string `json:"broadcast,omitempty"`
+
+	To      string `json:"to,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	HTML    string `json:"html,omitempty"`
+
+	ChatID    int64  `json:"chat_id,omitempty"`
+	Text      string `json:"text,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+	// CancelButton — текст кнопки «отменить ответ» под сообщением, пусто — без кнопки
+	CancelButton string `json:"cancel_button,omitempty"`
+
+	Status      string `json:"status"`
+	Attempts    int    `json:"attempts"`
+	NextAttempt string `json:"next_attempt"`
+	LastError   string `json:"last_error,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	SentAt      string `json:"sent_at,omitempty"`
+}
+
+// outboxStore — очередь уведомлений. due — ждущие отправки, у которых подошло время, в порядке постановки;
+// prune удаляет отправленные и брошенные сообщения, поставленные раньше before, и возвращает, сколько удалено.
+type outboxStore interface {
+	enqueue(m outboxMessage) error
+	due(now time.Time, limit int) ([]outboxMessage, error)
+	get(id string) (*outboxMessage, bool, error)
+	update(m outboxMessage) error
+	list() ([]outboxMessage, error)
+	prune(before time.Time) (int, error)
+}
+
+// outbox — очередь с воркером: уведомления ставятся в очередь после сохранения ответа,
+// а отправляются отдельно, с повторами, поэтому сбой почты или Telegram не ломает ответ гостю.
+type outbox struct {
+	store   outboxStore
+	deliver func(ctx context.Context, m outboxMessage) error
+	wake    chan struct{}
+	// mu — чтобы два enqueueOnce с одним ключом не поставили два сообщения
+	mu sync.Mutex
+}
+
+func newOutbox(store outboxStore, deliver func(ctx context.Context, m outboxMessage) error) *outbox {
+	return &outbox{store: store, deliver: deliver, wake: make(chan struct{}, 1)}
+}
+
+// enqueue сохраняет сообщение и будит воркер.
+func (o *outbox) enqueue(m outboxMessage) error {
+	return o.put(newID(), m)
+}
+
+// enqueueOnce — как enqueue, но id сообщения выводится из key: если сообщение с этим ключом уже было
+// поставлено (в любом состоянии), второе не ставится.
+func (o *outbox) enqueueOnce(key string, m outboxMessage) error {
+	id := outboxKeyID(key)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, found, err := o.store.get(id); err != nil || found {
+		return err
+	}
+	return o.put(id, m)
+}
+
+// outboxKeyID — id сообщения, поставленного через enqueueOnce с ключом key.
+func outboxKeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:12])
+}
+
+func (o *outbox) put(id string, m outboxMessage) error {
+	if err := o.store.enqueue(pendingMessage(id, m)); err != nil {
+		return err
+	}
+	o.notify()
+	return nil
+}
+
+// pendingMessage — новое сообщение с id, готовое к первой попытке.
+func pendingMessage(id string, m outboxMessage) outboxMessage {
+	m.ID = id
+	m.Status = outboxPending
+	m.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	m.NextAttempt = m.CreatedAt
+	return m
+}
+
+// notify будит воркер, не дожидаясь очередной проверки.
+func (o *outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// outboxBackoff — пауза перед следующей попыткой после attempts неудачных.
+func outboxBackoff(attempts int) time.Duration {
+	d := outboxBaseDelay
+	for i := 1; i < attempts && d < outboxMaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, outboxMaxDelay)
+}
+
+// run отправляет сообщения, пока не отменён ctx.
+func (o *outbox) run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollEvery)
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		if time.Since(pruned) >= outboxPruneEvery {
+			o.prune(time.Now().UTC())
+			pruned = time.Now()
+		}
+		o.flush(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// prune удаляет отправленные и брошенные сообщения старше outboxRetention.
+func (o *outbox) prune(now time.Time) {
+	n, err := o.store.prune(now.Add(-outboxRetention))
+	if err != nil {
+		log.Printf("очередь: удаление старых сообщений: %v", err)
+	} else if n > 0 {
+		log.Printf("очередь: удалено старых сообщений: %d", n)
+	}
+}
+
+// flush отправляет всё, что пора отправить.
+func (o *outbox) flush(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch, err := o.store.due(time.Now().UTC(), outboxBatch)
+		if err != nil {
+			log.Printf("очередь: %v", err)
+			return
+		}
+		if len(batch) == 0 {
+			return
+		}
+		for _, m := range batch {
+			if ctx.Err() != nil {
+				return
+			}
+			o.attempt(ctx, m)
+		}
+	}
+}
+
+func (o *outbox) attempt(ctx context.Context, m outboxMessage) {
+	err := o.deliver(ctx, m)
+	if ctx.Err() != nil {
+		// остановка сервера во время ожидания отправки — не попытка, сообщение остаётся в очереди как было
+		return
+	}
+	now := time.Now().UTC()
+	m.Attempts++
+	if err != nil {
+		m.LastError = err.Error()
+		if m.Attempts >= outboxMaxAttempts {
+			m.Status = outboxDead
+			log.Printf("очередь: %s %s не доставлено после %d попыток: %v", m.Kind, outboxRecipient(m), m.Attempts, err)
+		} else {
+			m.NextAttempt = now.Add(outboxBackoff(m.Attempts)).Format(time.RFC3339)
+			log.Printf("очередь: %s %s, попытка %d: %v", m.Kind, outboxRecipient(m), m.Attempts, err)
+		}
+	} else {
+		m.Status = outboxSent
+		m.SentAt = now.Format(time.RFC3339)
+		m.LastError = ""
+	}
+	if err := o.store.update(m); err != nil {
+		log.Printf("очередь: сохранить %s: %v", m.ID, err)
+	}
+}
+
+func outboxRecipient(m outboxMessage) string {
+	if m.Kind == outboxTelegram {
+		return auditTelegramActor(m.ChatID)
+	}
+	return m.To
+}
+
+// deliverNotification — отправка одного сообщения из очереди; сообщения в Telegram идут в темпе a.tgPace.
+func (a *app) deliverNotification(ctx context.Context, m outboxMessage) error {
+	switch m.Kind {
+	case outboxEmail:
+		if a.mail == nil {
+			return errors.New("email is not configured")
+		}
+		return a.mail.send(m.To, m.Subject, m.HTML)
+	case outboxTelegram:
+		if a.tg == nil {
+			return errors.New("telegram bot is not configured")
+		}
+		if err := a.tgPace.wait(ctx); err != nil {
+			return err
+		}
+		var err error
+		if m.CancelButton != "" {
+			err = a.tg.sendMessageWithCancel(m.ChatID, m.Text, m.CancelButton)
+		} else {
+			err = a.tg.sendMessage(m.ChatID, m.Text, m.ParseMode)
+		}
+		var retry *tgRetryAfterError
+		if errors.As(err, &retry) {
+			a.tgPace.pause(retry.after)
+		}
+		return err
+	}
+	return errors.New("unknown message kind " + m.Kind)
+}
+
+// emailMessage — письмо для очереди; без почты или адреса письма нет и возвращается false.
+func (a *app) emailMessage(rsvpID, to, subject, html string) (outboxMessage, bool) {
+	if a.mail == nil || to == "" {
+		return outboxMessage{}, false
+	}
+	return pendingMessage(newID(), outboxMessage{Kind: outboxEmail, RSVPID: rsvpID, To: to, Subject: subject, HTML: html}), true
+}
+
+// telegramMessage — сообщение в Telegram для очереди; cancelButton — текст кнопки отмены или пусто.
+func telegramMessage(rsvpID string, chatID int64, text, parseMode, cancelButton string) outboxMessage {
+	return pendingMessage(newID(), outboxMessage{Kind: outboxTelegram, RSVPID: rsvpID, ChatID: chatID, Text: text, ParseMode: parseMode, CancelButton: cancelButton})
+}
+
+// queueEmail ставит письмо в очередь отдельно от сохранения ответа, поэтому ошибка только в лог.
+// Без почты или адреса письмо не ставится и возвращается false.
+func (a *app) queueEmail(rsvpID, to, subject, html string) bool {
+	m, ok := a.emailMessage(rsvpID, to, subject, html)
+	if !ok {
+		return false
+	}
+	if err := a.outbox.store.enqueue(m); err != nil {
+		log.Printf("очередь: письмо %s: %v", to, err)
+		return false
+	}
+	a.outbox.notify()
+	return true
+}
+
+// handleAdminOutbox — /api/admin/outbox: GET — очередь, по умолчанию недоставленные (?status=dead|pending|sent|all,
+// ?rsvp_id=, ?broadcast=, page, per_page), новые первыми; POST /api/admin/outbox/{id}/retry — отправить брошенное сообщение заново.
+// Только для owner и planner: в письмах гостям — ссылки с токенами для правки и отмены ответа.
+func (a *app) handleAdminOutbox() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := a.adminAccess(w, r, rolePlanner); !ok {
+			return
+		}
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/outbox"), "/")
+		switch {
+		case rest == "" && r.Method == http.MethodGet:
+			a.adminListOutbox(w, r)
+		case strings.HasSuffix(rest, "/retry") && r.Method == http.MethodPost:
+			a.adminRetryOutbox(w, strings.TrimSuffix(rest, "/retry"))
+		default:
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func (a *app) adminListOutbox(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status := strings.TrimSpace(q.Get("status"))
+	switch status {
+	case "":
+		status = outboxDead
+	case outboxDead, outboxPending, outboxSent, "all":
+	default:
+		http.Error(w, `{"error":"status must be dead, pending, sent or all"}`, http.StatusBadRequest)
+		return
+	}
+	page, perPage, err := parsePage(q)
+	if err != nil {
+		httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := a.outbox.store.list()
+	if err != nil {
+		log.Printf("очередь: %v", err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	}
+	rsvpID := strings.TrimSpace(q.Get("rsvp_id"))
+	broadcast := strings.TrimSpace(q.Get("broadcast"))
+	counts := map[string]int{outboxPending: 0, outboxSent: 0, outboxDead: 0}
+	matched := make([]outboxMessage, 0)
+	for i := len(list) - 1; i >= 0; i-- {
+		m := list[i]
+		counts[m.Status]++
+		if (status == "all" || m.Status == status) && (rsvpID == "" || m.RSVPID == rsvpID) &&
+			(broadcast == "" || m.Broadcast == broadcast) {
+			matched = append(matched, m)
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":       true,
+		"counts":   counts,
+		"total":    len(matched),
+		"page":     page,
+		"per_page": perPage,
+		"messages": paginate(matched, page, perPage),
+	})
+}
+
+func (a *app) adminRetryOutbox(w http.ResponseWriter, id string) {
+	m, found, err := a.outbox.store.get(id)
+	if err != nil {
+		log.Printf("очередь: %s: %v", id, err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	if m.Status != outboxDead {
+		http.Error(w, `{"error":"only dead messages can be retried"}`, http.StatusConflict)
+		return
+	}
+	m.Status = outboxPending
+	m.Attempts = 0
+	m.NextAttempt = time.Now().UTC().Format(time.RFC3339)
+	if err := a.outbox.store.update(*m); err != nil {
+		log.Printf("очередь: %s: %v", id, err)
+		http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+		return
+	}
+	a.outbox.notify()
+	writeAdminJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "message": m})
+}
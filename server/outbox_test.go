@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, 64 * time.Minute},
+		{9, outboxMaxDelay},
+		{50, outboxMaxDelay},
+	}
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// openTestOutbox — очередь в JSON-файле во временном каталоге; deliver возвращает err.
+func openTestOutbox(t *testing.T, err *error) (*outbox, *jsonOutboxStore) {
+	t.Helper()
+	store, openErr := openJSONOutboxStore(filepath.Join(t.TempDir(), "outbox.json"))
+	if openErr != nil {
+		t.Fatal(openErr)
+	}
+	t.Cleanup(func() { store.close() })
+	return newOutbox(store, func(ctx context.Context, m outboxMessage) error { return *err }), store
+}
+
+func TestOutboxAttemptRetriesThenDeadLetters(t *testing.T) {
+	deliverErr := errors.New("smtp: connection refused")
+	o, store := openTestOutbox(t, &deliverErr)
+	if err := o.enqueue(outboxMessage{Kind: outboxEmail, To: "anna@example.com", Subject: "s", HTML: "h"}); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := store.list()
+	id := list[0].ID
+
+	for attempt := 1; attempt <= outboxMaxAttempts; attempt++ {
+		m, _, _ := store.get(id)
+		before := time.Now().UTC().Truncate(time.Second)
+		o.attempt(context.Background(), *m)
+		m, _, _ = store.get(id)
+		if m.Attempts != attempt || m.LastError != deliverErr.Error() {
+			t.Fatalf("attempt %d: attempts = %d, last_error = %q", attempt, m.Attempts, m.LastError)
+		}
+		if attempt == outboxMaxAttempts {
+			if m.Status != outboxDead {
+				t.Fatalf("attempt %d: status = %s, want dead", attempt, m.Status)
+			}
+			break
+		}
+		next, _ := time.Parse(time.RFC3339, m.NextAttempt)
+		if wait := next.Sub(before); m.Status != outboxPending || wait < outboxBackoff(attempt) || wait > outboxBackoff(attempt)+2*time.Second {
+			t.Fatalf("attempt %d: status = %s, next attempt in %v, want %v", attempt, m.Status, wait, outboxBackoff(attempt))
+		}
+		if due, _ := store.due(time.Now().UTC(), outboxBatch); len(due) != 0 {
+			t.Fatalf("attempt %d: message is due again before its backoff", attempt)
+		}
+		if due, _ := store.due(next, outboxBatch); len(due) != 1 {
+			t.Fatalf("attempt %d: message is not due after its backoff", attempt)
+		}
+	}
+	if due, _ := store.due(time.Now().Add(24*time.Hour), outboxBatch); len(due) != 0 {
+		t.Fatal("dead message is still due")
+	}
+}
+
+func TestOutboxAttemptSent(t *testing.T) {
+	var deliverErr error
+	o, store := openTestOutbox(t, &deliverErr)
+	o.enqueue(outboxMessage{Kind: outboxTelegram, ChatID: 42, Text: "привет"})
+	o.flush(context.Background())
+	list, _ := store.list()
+	if m := list[0]; m.Status != outboxSent || m.Attempts != 1 || m.SentAt == "" || m.LastError != "" {
+		t.Fatalf("message = %+v", m)
+	}
+}
+
+func TestOutboxAttemptCancelledIsNotCounted(t *testing.T) {
+	deliverErr := error(context.Canceled)
+	o, store := openTestOutbox(t, &deliverErr)
+	o.enqueue(outboxMessage{Kind: outboxTelegram, ChatID: 42, Text: "привет"})
+	list, _ := store.list()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	o.attempt(ctx, list[0])
+	m, _, _ := store.get(list[0].ID)
+	if m.Status != outboxPending || m.Attempts != 0 || m.LastError != "" {
+		t.Fatalf("message after shutdown = %+v", m)
+	}
+}
+
+func TestOutboxEnqueueOnce(t *testing.T) {
+	var deliverErr error
+	o, store := openTestOutbox(t, &deliverErr)
+	for i := 0; i < 2; i++ {
+		if err := o.enqueueOnce("10d:r1:email", outboxMessage{Kind: outboxEmail, To: "anna@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// и после отправки ключ не ставится снова
+	o.flush(context.Background())
+	o.enqueueOnce("10d:r1:email", outboxMessage{Kind: outboxEmail, To: "anna@example.com"})
+	o.enqueueOnce("10d:r2:email", outboxMessage{Kind: outboxEmail, To: "boris@example.com"})
+	list, _ := store.list()
+	if len(list) != 2 || list[0].Status != outboxSent || list[1].To != "boris@example.com" {
+		t.Fatalf("queue = %+v", list)
+	}
+}
+
+func TestOutboxPrune(t *testing.T) {
+	now := time.Now().UTC()
+	old := now.Add(-outboxRetention - time.Hour).Format(time.RFC3339)
+	fresh := now.Add(-time.Hour).Format(time.RFC3339)
+	for _, driver := range []string{"json", "sqlite"} {
+		t.Run(driver, func(t *testing.T) {
+			dir := t.TempDir()
+			st, err := openStorage(driver, filepath.Join(dir, "rsvps.json"), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer st.close()
+			for _, m := range []outboxMessage{
+				{ID: "old-sent", Status: outboxSent, CreatedAt: old},
+				{ID: "old-dead", Status: outboxDead, CreatedAt: old},
+				{ID: "old-pending", Status: outboxPending, CreatedAt: old},
+				{ID: "fresh-sent", Status: outboxSent, CreatedAt: fresh},
+			} {
+				m.Kind, m.NextAttempt = outboxEmail, m.CreatedAt
+				if err := st.outbox.enqueue(m); err != nil {
+					t.Fatal(err)
+				}
+			}
+			n, err := st.outbox.prune(now.Add(-outboxRetention))
+			if err != nil || n != 2 {
+				t.Fatalf("prune = %d, %v; want 2", n, err)
+			}
+			list, _ := st.outbox.list()
+			var ids []string
+			for _, m := range list {
+				ids = append(ids, m.ID)
+			}
+			if strings.Join(ids, ",") != "old-pending,fresh-sent" {
+				t.Fatalf("left after prune: %v", ids)
+			}
+		})
+	}
+}
+
+func TestRSVPCreateNotify(t *testing.T) {
+	for _, driver := range []string{"json", "sqlite"} {
+		t.Run(driver, func(t *testing.T) {
+			st, err := openStorage(driver, filepath.Join(t.TempDir(), "rsvps.json"), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer st.close()
+			msg := pendingMessage("m1", outboxMessage{Kind: outboxEmail, RSVPID: "r1", To: "anna@example.com"})
+			if _, err := st.rsvps.createNotify(storedRSVP{ID: "r1", Name: "Анна"}, []outboxMessage{msg}); err != nil {
+				t.Fatal(err)
+			}
+			// в SQLite повтор id сообщения — ошибка вставки, и ответ откатывается вместе с ним
+			dup := pendingMessage("m1", outboxMessage{Kind: outboxEmail, RSVPID: "r2", To: "boris@example.com"})
+			if driver == "sqlite" {
+				if _, err := st.rsvps.createNotify(storedRSVP{ID: "r2", Name: "Борис"}, []outboxMessage{dup}); err == nil {
+					t.Fatal("duplicate message id: want error")
+				}
+				if _, found, _ := st.rsvps.get("r2"); found {
+					t.Fatal("rsvp saved without its messages")
+				}
+			}
+			msg2 := pendingMessage("m2", outboxMessage{Kind: outboxEmail, RSVPID: "r1", To: "anna@example.com"})
+			if err := st.rsvps.updateNotify(storedRSVP{ID: "r1", Name: "Анна Б."}, []outboxMessage{msg2}); err != nil {
+				t.Fatal(err)
+			}
+			if e, _, _ := st.rsvps.get("r1"); e == nil || e.Name != "Анна Б." {
+				t.Fatalf("rsvp = %+v", e)
+			}
+			list, _ := st.outbox.list()
+			if len(list) != 2 || list[0].ID != "m1" || list[1].ID != "m2" {
+				t.Fatalf("outbox = %+v", list)
+			}
+			if err := st.rsvps.updateNotify(storedRSVP{ID: "missing"}, nil); err != errNotFound {
+				t.Fatalf("update missing = %v", err)
+			}
+		})
+	}
+}
+
+// Сбой между записью ответа в журнал и записью уведомлений в очередь: при открытии уведомления
+// доставляются в очередь из журнала ответов, кроме тех, что старше outboxRetention.
+func TestJSONRSVPJournalRelaysMessages(t *testing.T) {
+	dir := t.TempDir()
+	fresh := pendingMessage("fresh", outboxMessage{Kind: outboxEmail, RSVPID: "r1", To: "anna@example.com"})
+	stale := pendingMessage("stale", outboxMessage{Kind: outboxEmail, RSVPID: "r1", To: "anna@example.com"})
+	stale.CreatedAt = time.Now().UTC().Add(-outboxRetention - time.Hour).Format(time.RFC3339)
+	data, err := json.Marshal(rsvpWithMessages{Entry: storedRSVP{ID: "r1", Name: "Анна"}, Messages: []outboxMessage{fresh, stale}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, _ := json.Marshal(journalRecord{Op: "put_notify", Data: data})
+	if err := os.WriteFile(filepath.Join(dir, "rsvps.json.journal"), append(line, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		st, err := openJSONStorage(filepath.Join(dir, "rsvps.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, found, _ := st.rsvps.get("r1"); !found {
+			t.Fatalf("open %d: rsvp is lost", i+1)
+		}
+		list, _ := st.outbox.list()
+		if len(list) != 1 || list[0].ID != "fresh" {
+			t.Fatalf("open %d: outbox = %+v", i+1, list)
+		}
+		st.close()
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Типы дополнительных вопросов анкеты
+const (
+	questionText   = "text"
+	questionChoice = "choice"
+	questionMulti  = "multi"
+	questionBool   = "bool"
+	questionNumber = "number"
+)
+
+// question — дополнительный вопрос анкеты из файла RSVP_QUESTIONS_PATH.
+type question struct {
+	ID       string   `json:"id"`
+	Label    string   `json:"label"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required,omitempty"`
+	Options  []string `json:"options,omitempty"`
+	// MaxLength — для text, по умолчанию 500 символов
+	MaxLength int `json:"max_length,omitempty"`
+	// MinChoices, MaxChoices — сколько вариантов можно отметить в multi (0 — без ограничения)
+	MinChoices int `json:"min_choices,omitempty"`
+	MaxChoices int `json:"max_choices,omitempty"`
+	// Min, Max — границы для number
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+const defaultAnswerMaxLength = 500
+
+var questionIDRe = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// loadQuestions читает и проверяет список вопросов. Пустой путь — вопросов нет.
+func loadQuestions(path string) ([]question, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var qs []question
+	if err := json.Unmarshal(data, &qs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	seen := make(map[string]bool)
+	for i := range qs {
+		q := &qs[i]
+		q.Label = strings.TrimSpace(q.Label)
+		if !questionIDRe.MatchString(q.ID) {
+			return nil, fmt.Errorf("вопрос %d: id — латиница в нижнем регистре, цифры и _", i+1)
+		}
+		if seen[q.ID] {
+			return nil, fmt.Errorf("вопрос %q: id повторяется", q.ID)
+		}
+		seen[q.ID] = true
+		if q.Label == "" {
+			q.Label = q.ID
+		}
+		switch q.Type {
+		case questionText:
+			if q.MaxLength <= 0 {
+				q.MaxLength = defaultAnswerMaxLength
+			}
+		case questionChoice, questionMulti:
+			if len(q.Options) == 0 {
+				return nil, fmt.Errorf("вопрос %q: нужны options", q.ID)
+			}
+			if q.MaxChoices > 0 && q.MinChoices > q.MaxChoices {
+				return nil, fmt.Errorf("вопрос %q: min_choices больше max_choices", q.ID)
+			}
+		case questionBool:
+		case questionNumber:
+			if q.Min != nil && q.Max != nil && *q.Min > *q.Max {
+				return nil, fmt.Errorf("вопрос %q: min больше max", q.ID)
+			}
+		default:
+			return nil, fmt.Errorf("вопрос %q: неизвестный type %q (text, choice, multi, bool, number)", q.ID, q.Type)
+		}
+	}
+	return qs, nil
+}
+
+// validateAnswers проверяет ответы по схеме и возвращает их в нормализованном виде:
+// text и choice — string, multi — []string, bool — bool, number — float64.
+// requireAll=false отключает проверку обязательных вопросов (например, для отказавшихся гостей).
+// Текст ошибки уходит клиенту как есть.
+func validateAnswers(qs []question, raw map[string]json.RawMessage, requireAll bool) (map[string]interface{}, error) {
+	byID := make(map[string]*question, len(qs))
+	for i := range qs {
+		byID[qs[i].ID] = &qs[i]
+	}
+	for id := range raw {
+		if byID[id] == nil {
+			return nil, fmt.Errorf("unknown question %s", id)
+		}
+	}
+
+	out := make(map[string]interface{})
+	for _, q := range qs {
+		v, err := parseAnswer(q, raw[q.ID])
+		if err != nil {
+			return nil, fmt.Errorf("answers.%s: %v", q.ID, err)
+		}
+		if v == nil {
+			if q.Required && requireAll {
+				return nil, fmt.Errorf("answers.%s: required", q.ID)
+			}
+			continue
+		}
+		out[q.ID] = v
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// parseAnswer разбирает один ответ; nil без ошибки — ответа нет.
+func parseAnswer(q question, raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	switch q.Type {
+	case questionText:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("must be a string")
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, nil
+		}
+		if len([]rune(s)) > q.MaxLength {
+			return nil, fmt.Errorf("max %d chars", q.MaxLength)
+		}
+		return s, nil
+	case questionChoice:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("must be a string")
+		}
+		if s == "" {
+			return nil, nil
+		}
+		if !q.hasOption(s) {
+			return nil, errors.New("unknown option")
+		}
+		return s, nil
+	case questionMulti:
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, errors.New("must be an array of strings")
+		}
+		seen := make(map[string]bool)
+		var picked []string
+		for _, s := range list {
+			if !q.hasOption(s) {
+				return nil, errors.New("unknown option")
+			}
+			if !seen[s] {
+				seen[s] = true
+				picked = append(picked, s)
+			}
+		}
+		if len(picked) == 0 {
+			return nil, nil
+		}
+		if len(picked) < q.MinChoices {
+			return nil, fmt.Errorf("pick at least %d", q.MinChoices)
+		}
+		if q.MaxChoices > 0 && len(picked) > q.MaxChoices {
+			return nil, fmt.Errorf("pick at most %d", q.MaxChoices)
+		}
+		// Порядок как в options, чтобы выгрузка была единообразной
+		sort.SliceStable(picked, func(i, j int) bool { return q.optionIndex(picked[i]) < q.optionIndex(picked[j]) })
+		return picked, nil
+	case questionBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		return b, nil
+	case questionNumber:
+		var n float64
+		if err := json.Unmarshal(raw, &n); err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, errors.New("must be a number")
+		}
+		if q.Min != nil && n < *q.Min {
+			return nil, fmt.Errorf("min %s", formatNumber(*q.Min))
+		}
+		if q.Max != nil && n > *q.Max {
+			return nil, fmt.Errorf("max %s", formatNumber(*q.Max))
+		}
+		return n, nil
+	}
+	return nil, errors.New("unsupported question type")
+}
+
+func (q question) hasOption(s string) bool {
+	return q.optionIndex(s) >= 0
+}
+
+func (q question) optionIndex(s string) int {
+	for i, o := range q.Options {
+		if o == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// formatAnswer — ответ в виде текста для писем и выгрузки.
+func formatAnswer(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "да"
+		}
+		return "нет"
+	case float64:
+		return formatNumber(v)
+	case []string:
+		return strings.Join(v, ", ")
+	case []interface{}:
+		// так multi читается обратно из JSON
+		parts := make([]string, 0, len(v))
+		for _, p := range v {
+			parts = append(parts, formatAnswer(p))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(v)
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// handleQuestions отдаёт форме список дополнительных вопросов.
+func (a *app) handleQuestions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		qs := a.questions
+		if qs == nil {
+			qs = []question{}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(map[string]interface{}{"questions": qs})
+	}
+}
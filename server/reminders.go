@@ -0,0 +1,765 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Кому напоминать (поле audience правила).
+const (
+	// audienceAttending — ответившие «приду» или «не уверен(а)»
+	audienceAttending = "attending"
+	// audienceUnanswered — приглашения из списка гостей, по которым ещё нет ответа
+	audienceUnanswered = "unanswered"
+	// audienceMissingAnswer — придут, но не ответили на вопрос анкеты question (например, не выбрали блюдо)
+	audienceMissingAnswer = "missing_answer"
+)
+
+// reminderCheckEvery — как часто проверять правила, если до следующего напоминания дольше.
+const reminderCheckEvery = 10 * time.Minute
+
+// stateKeyRemindersLastRun — ключ в stateStore со временем последней проверки напоминаний.
+const stateKeyRemindersLastRun = "reminders_last_run"
+
+// defaultReminderGrace — сколько после времени напоминания его ещё можно отправить (REMINDER_GRACE),
+// если сервер в это время не работал.
+const defaultReminderGrace = 24 * time.Hour
+
+var reminderIDRe = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// reminderRule — одно напоминание из REMINDERS_PATH. Пример файла:
+//
+//	[
+//	  {"id": "month", "offset": "30d", "channels": ["email"], "audience": "unanswered",
+//	   "subject": "Ждём ваш ответ", "html": "<p>{{.Name}}, ответьте, пожалуйста: <a href=\"{{.InviteURL}}\">анкета</a></p>"},
+//	  {"id": "meal", "offset": "14d", "channels": ["email", "telegram"], "audience": "missing_answer", "question": "meal",
+//	   "subject": "Выберите блюдо", "html": "<p><a href=\"{{.EditURL}}\">Выбрать</a></p>", "text": "Выберите блюдо: {{.EditURL}}"},
+//	  {"id": "day", "offset": "0d", "at": "08:00", "channels": ["telegram"], "audience": "attending",
+//	   "text": "{{.Name}}, сегодня в {{.Time}} ждём вас: {{.Place}}"}
+//	]
+//
+// В шаблонах доступны поля reminderData. html — шаблон html/template, subject и text — text/template;
+// для text с parse_mode Markdown значения экранируются функцией md: {{md .Name}}.
+type reminderRule struct {
+	ID string `json:"id"`
+	// Offset — за сколько дней до свадьбы: "30d", "1d"; "0d" — в сам день
+	Offset string `json:"offset"`
+	// At — время отправки ЧЧ:ММ, по умолчанию 09:00
+	At       string   `json:"at,omitempty"`
+	Channels []string `json:"channels"`
+	Audience string   `json:"audience"`
+	// Question — id вопроса анкеты для audience missing_answer
+	Question  string `json:"question,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	HTML      string `json:"html,omitempty"`
+	Text      string `json:"text,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+
+	days        int
+	at          time.Duration
+	email       bool
+	telegram    bool
+	subjectTmpl *texttemplate.Template
+	htmlTmpl    *htmltemplate.Template
+	textTmpl    *texttemplate.Template
+	// legacyKeys — отметки прежнего напоминания за 10 дней (просто адрес почты) тоже считаются отправкой
+	legacyKeys bool
+}
+
+// reminderData — значения для шаблонов напоминаний.
+type reminderData struct {
+	Name     string
+	Days     int
+	Date     string
+	Time     string
+	Place    string
+	PlaceURL string
+	// EditURL и CancelURL — у ответивших, InviteURL — у приглашений без ответа
+	EditURL   string
+	CancelURL string
+	InviteURL string
+}
+
+// defaultReminderRules — без REMINDERS_PATH: как раньше, одно напоминание за 10 дней всем, кто не отказался.
+func defaultReminderRules() []reminderRule {
+	rules := []reminderRule{{
+		ID:        "10d",
+		Offset:    "10d",
+		Channels:  []string{outboxEmail, outboxTelegram},
+		Audience:  audienceAttending,
+		Subject:   "Через 10 дней — ждём вас!",
+		HTML:      `<p>Привет!</p><p>Напоминаем: через 10 дней наша свадьба.</p><p>Очень ждём вас!</p>`,
+		Text:      "💌 *Напоминание о свадьбе!*\n\nПривет! Напоминаем, что через 10 дней наша свадьба.\n\nОчень ждём вас на празднике!\n\n💕 Александр & Дарья",
+		ParseMode: "Markdown",
+	}}
+	if err := prepareReminderRules(rules, nil); err != nil {
+		panic(err)
+	}
+	rules[0].legacyKeys = true
+	return rules
+}
+
+// loadReminderRules читает и проверяет правила напоминаний. Пустой путь — правила по умолчанию.
+func loadReminderRules(path string, questions []question) ([]reminderRule, error) {
+	if path == "" {
+		return defaultReminderRules(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []reminderRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := prepareReminderRules(rules, questions); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func prepareReminderRules(rules []reminderRule, questions []question) error {
+	seen := make(map[string]bool)
+	for i := range rules {
+		r := &rules[i]
+		if !reminderIDRe.MatchString(r.ID) {
+			return fmt.Errorf("напоминание %d: id — латиница в нижнем регистре, цифры, _ и -", i+1)
+		}
+		if seen[r.ID] {
+			return fmt.Errorf("напоминание %q: id повторяется", r.ID)
+		}
+		seen[r.ID] = true
+		days, err := parseReminderOffset(r.Offset)
+		if err != nil {
+			return fmt.Errorf("напоминание %q: %v", r.ID, err)
+		}
+		r.days = days
+		r.at = 9 * time.Hour
+		if r.At != "" {
+			t, err := time.Parse("15:04", r.At)
+			if err != nil {
+				return fmt.Errorf("напоминание %q: at — время ЧЧ:ММ, получено %q", r.ID, r.At)
+			}
+			r.at = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		}
+		for _, c := range r.Channels {
+			switch c {
+			case outboxEmail:
+				r.email = true
+			case outboxTelegram:
+				r.telegram = true
+			default:
+				return fmt.Errorf("напоминание %q: неизвестный канал %q (email, telegram)", r.ID, c)
+			}
+		}
+		if !r.email && !r.telegram {
+			return fmt.Errorf("напоминание %q: нужны channels", r.ID)
+		}
+		switch r.Audience {
+		case audienceAttending:
+		case audienceUnanswered:
+			// у приглашения нет чата: ответа из Telegram по нему ещё не было
+			if r.telegram {
+				return fmt.Errorf("напоминание %q: для audience unanswered доступен только канал email", r.ID)
+			}
+		case audienceMissingAnswer:
+			if !questionExists(questions, r.Question) {
+				return fmt.Errorf("напоминание %q: нет вопроса анкеты %q", r.ID, r.Question)
+			}
+		default:
+			return fmt.Errorf("напоминание %q: audience — attending, unanswered или missing_answer", r.ID)
+		}
+		if err := r.parseTemplates(); err != nil {
+			return fmt.Errorf("напоминание %q: %v", r.ID, err)
+		}
+	}
+	return nil
+}
+
+// parseReminderOffset — «30d» → 30.
+func parseReminderOffset(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s), "d"))
+	if err != nil || n < 0 || !strings.HasSuffix(s, "d") {
+		return 0, fmt.Errorf("offset — число дней до свадьбы, например 10d, получено %q", s)
+	}
+	return n, nil
+}
+
+func questionExists(questions []question, id string) bool {
+	for _, q := range questions {
+		if q.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTemplates разбирает шаблоны и сразу пробует их на пустых данных, чтобы опечатка в имени поля
+// обнаружилась при старте, а не в день отправки.
+func (r *reminderRule) parseTemplates() error {
+	funcs := texttemplate.FuncMap{"md": escapeMarkdown}
+	var err error
+	if r.email {
+		if r.Subject == "" || r.HTML == "" {
+			return fmt.Errorf("для email нужны subject и html")
+		}
+		if r.subjectTmpl, err = texttemplate.New("subject").Parse(r.Subject); err != nil {
+			return err
+		}
+		if r.htmlTmpl, err = htmltemplate.New("html").Parse(r.HTML); err != nil {
+			return err
+		}
+	}
+	if r.telegram {
+		if r.Text == "" {
+			return fmt.Errorf("для telegram нужен text")
+		}
+		if r.textTmpl, err = texttemplate.New("text").Funcs(funcs).Parse(r.Text); err != nil {
+			return err
+		}
+	}
+	_, _, _, err = r.render(reminderData{})
+	return err
+}
+
+// render — тема и текст письма и текст сообщения в Telegram для одного получателя.
+func (r *reminderRule) render(d reminderData) (subject, html, text string, err error) {
+	var b bytes.Buffer
+	if r.subjectTmpl != nil {
+		if err = r.subjectTmpl.Execute(&b, d); err != nil {
+			return
+		}
+		subject = strings.TrimSpace(b.String())
+		b.Reset()
+	}
+	if r.htmlTmpl != nil {
+		if err = r.htmlTmpl.Execute(&b, d); err != nil {
+			return
+		}
+		html = b.String()
+		b.Reset()
+	}
+	if r.textTmpl != nil {
+		if err = r.textTmpl.Execute(&b, d); err != nil {
+			return
+		}
+		text = b.String()
+	}
+	return
+}
+
+// fireAt — когда отправлять напоминание для свадьбы в день weddingDate: время at по часовому поясу weddingDate
+// (через time.Date, чтобы переход на летнее время не сдвинул его на час).
+func (r *reminderRule) fireAt(weddingDate time.Time) time.Time {
+	d := weddingDate.AddDate(0, 0, -r.days)
+	return time.Date(d.Year(), d.Month(), d.Day(), int(r.at/time.Hour), int(r.at%time.Hour/time.Minute), 0, 0, d.Location())
+}
+
+// reminderKey — отметка об отправке правилом rule гостю guest по каналу channel.
+func reminderKey(rule, guest, channel string) string {
+	return rule + ":" + guest + ":" + channel
+}
+
+// sentKey — отметка для этого получателя: письма отмечаются по гостю, Telegram — по чату,
+// чтобы чат, к которому привязано несколько ответов, получил напоминание один раз.
+func (rcpt reminderRecipient) sentKey(rule, channel string) string {
+	if channel == outboxTelegram {
+		return reminderKey(rule, "tg"+strconv.FormatInt(rcpt.ChatID, 10), channel)
+	}
+	return reminderKey(rule, rcpt.Guest, channel)
+}
+
+// reminderRecipient — кому напомнить: ответ гостя или приглашение без ответа.
+type reminderRecipient struct {
+	// Guest — id ответа или «inv-» и id приглашения
+	Guest  string
+	Name   string
+	Email  string
+	ChatID int64
+	Data   reminderData
+}
+
+// reminderRecipients — получатели правила: подходящие под audience ответы или приглашения.
+func (a *app) reminderRecipients(rule *reminderRule, rsvps []storedRSVP, invitations []invitation) []reminderRecipient {
+	base := reminderData{
+		Date:     a.wedding.dateDisplay,
+		Time:     a.wedding.timeDisplay,
+		Place:    a.wedding.placeName,
+		PlaceURL: a.wedding.placeURL,
+		Days:     rule.days,
+	}
+	var out []reminderRecipient
+	if rule.Audience == audienceUnanswered {
+		for _, inv := range invitations {
+			if findInvitationRSVP(inv, rsvps) != nil {
+				continue
+			}
+			rcpt := reminderRecipient{Guest: "inv-" + inv.ID, Name: inv.Name, Email: strings.TrimSpace(inv.Email), Data: base}
+			rcpt.Data.Name = inv.Name
+			rcpt.Data.InviteURL = a.inviteURL(inv.Code)
+			out = append(out, rcpt)
+		}
+		return out
+	}
+	for _, entry := range rsvps {
+		if !reminderMatches(rule, entry) {
+			continue
+		}
+		rcpt := reminderRecipient{Guest: entry.ID, Name: entry.Name, Email: strings.TrimSpace(entry.Email), ChatID: a.guestChatID(entry), Data: base}
+		rcpt.Data.Name = entry.Name
+		rcpt.Data.EditURL, rcpt.Data.CancelURL = a.guestLinks(entry.ID)
+		out = append(out, rcpt)
+	}
+	return out
+}
+
+// reminderMatches — подходит ли ответ под audience правила (кроме unanswered — там приглашения).
+func reminderMatches(rule *reminderRule, entry storedRSVP) bool {
+	if entry.attendance() == statusDeclined {
+		return false
+	}
+	switch rule.Audience {
+	case audienceAttending:
+		return true
+	case audienceMissingAnswer:
+		return strings.TrimSpace(formatAnswer(entry.Answers[rule.Question])) == ""
+	}
+	return false
+}
+
+// guestChatID — чат Telegram, из которого отправлен ответ; 0 — ответ не из Telegram. Телефон из tg_users
+// не в счёт: его гость вводит сам, а в напоминаниях ссылки, которыми можно изменить или отменить ответ.
+func (a *app) guestChatID(entry storedRSVP) int64 {
+	if entry.TelegramChatID != nil {
+		return *entry.TelegramChatID
+	}
+	return 0
+}
+
+// reminderSent — отправлено ли уже правилом rule гостю rcpt по каналу channel.
+// Сообщения в Telegram прежде отмечались по гостю, такие отметки тоже учитываются.
+func reminderSent(sent map[string]bool, rule *reminderRule, rcpt reminderRecipient, channel string) bool {
+	if sent[rcpt.sentKey(rule.ID, channel)] || sent[reminderKey(rule.ID, rcpt.Guest, channel)] {
+		return true
+	}
+	return rule.legacyKeys && channel == outboxEmail && rcpt.Email != "" && sent[normalizeEmail(rcpt.Email)]
+}
+
+// runReminders проверяет правила при старте и дальше к времени ближайшего напоминания (но не реже
+// reminderCheckEvery), пока не отменён ctx. Проверка при старте досылает то, что пришлось на время простоя.
+func (a *app) runReminders(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		now := time.Now()
+		a.sendDueReminders(now)
+		timer.Reset(a.nextReminderCheck(now))
+	}
+}
+
+// nextReminderCheck — через сколько проверить снова: к ближайшему будущему напоминанию или через reminderCheckEvery.
+func (a *app) nextReminderCheck(now time.Time) time.Duration {
+	wait := reminderCheckEvery
+	for i := range a.reminderRules {
+		if d := a.reminderRules[i].fireAt(a.weddingDate).Sub(now); d > 0 && d < wait {
+			wait = d
+		}
+	}
+	return max(wait, time.Second)
+}
+
+// sendDueReminders отправляет напоминания, время которых наступило, но не позже чем через reminderGrace.
+// Время проверки сохраняется, чтобы после простоя отличить досылку от напоминания, окно которого закрылось.
+func (a *app) sendDueReminders(now time.Time) {
+	lastRun := a.remindersLastRun()
+	for i := range a.reminderRules {
+		r := &a.reminderRules[i]
+		at := r.fireAt(a.weddingDate)
+		switch {
+		case now.Before(at):
+		case now.Before(at.Add(a.reminderGrace)):
+			if !lastRun.IsZero() && lastRun.Before(at) && now.Sub(at) > reminderCheckEvery {
+				log.Printf("напоминание %s: досылаем, время было %s", r.ID, at.Format("02.01.2006 15:04 MST"))
+			}
+			a.sendReminder(r, false)
+		case lastRun.Before(at):
+			// после пропущенного окна напоминание уже не к месту; пишем в лог один раз
+			log.Printf("напоминание %s пропущено: время было %s, окно %s закрылось, пока сервер не работал",
+				r.ID, at.Format("02.01.2006 15:04 MST"), a.reminderGrace)
+		}
+	}
+	if a.state != nil {
+		if err := a.state.set(stateKeyRemindersLastRun, now.UTC().Format(time.RFC3339)); err != nil {
+			log.Printf("напоминания: сохранить время проверки: %v", err)
+		}
+	}
+}
+
+// remindersLastRun — время прошлой проверки; нулевое, если её не было.
+func (a *app) remindersLastRun() time.Time {
+	if a.state == nil {
+		return time.Time{}
+	}
+	v, ok, err := a.state.get(stateKeyRemindersLastRun)
+	if err != nil {
+		log.Printf("напоминания: время прошлой проверки: %v", err)
+	}
+	if !ok || err != nil {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339, v)
+	return t
+}
+
+// reminderDelivery — одно сообщение напоминания: кому и что уйдёт.
+type reminderDelivery struct {
+	Channel   string `json:"channel"`
+	Guest     string `json:"guest"`
+	Name      string `json:"name"`
+	Email     string `json:"email,omitempty"`
+	ChatID    int64  `json:"chat_id,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	HTML      string `json:"html,omitempty"`
+	Text      string `json:"text,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+	// MessageID — сообщение в очереди (/api/admin/outbox), пусто при предпросмотре и если поставить не удалось
+	MessageID string `json:"message_id,omitempty"`
+
+	key    string
+	rsvpID string
+}
+
+func (d reminderDelivery) message() outboxMessage {
+	if d.Channel == outboxTelegram {
+		return outboxMessage{Kind: outboxTelegram, RSVPID: d.rsvpID, ChatID: d.ChatID, Text: d.Text, ParseMode: d.ParseMode}
+	}
+	return outboxMessage{Kind: outboxEmail, RSVPID: d.rsvpID, To: d.Email, Subject: d.Subject, HTML: d.HTML}
+}
+
+// reminderPlan — что правило отправит сейчас. AlreadySent — получатели, которым это напоминание уже ушло,
+// NoContact — подходящие под audience, до которых не дотянуться каналами правила.
+type reminderPlan struct {
+	Rule        string             `json:"rule"`
+	DryRun      bool               `json:"dry_run"`
+	Deliveries  []reminderDelivery `json:"deliveries"`
+	AlreadySent int                `json:"already_sent"`
+	NoContact   int                `json:"no_contact"`
+}
+
+// planReminder — сообщения правила для всех, кому его ещё не отправляли. Отметки не меняет.
+func (a *app) planReminder(rule *reminderRule) (reminderPlan, error) {
+	plan := reminderPlan{Rule: rule.ID, Deliveries: make([]reminderDelivery, 0)}
+	rsvps, err := a.rsvps.list()
+	if err != nil {
+		return plan, fmt.Errorf("ответы: %w", err)
+	}
+	var invitations []invitation
+	if rule.Audience == audienceUnanswered {
+		if invitations, err = a.invitations.list(); err != nil {
+			return plan, fmt.Errorf("приглашения: %w", err)
+		}
+	}
+	sent, err := a.reminders.list()
+	if err != nil {
+		return plan, fmt.Errorf("отметки: %w", err)
+	}
+	for _, rcpt := range a.reminderRecipients(rule, rsvps, invitations) {
+		canEmail := rule.email && a.mail != nil && rcpt.Email != ""
+		canTelegram := rule.telegram && a.tgEnabled() && rcpt.ChatID != 0
+		wantEmail := canEmail && !reminderSent(sent, rule, rcpt, outboxEmail)
+		wantTelegram := canTelegram && !reminderSent(sent, rule, rcpt, outboxTelegram)
+		switch {
+		case !canEmail && !canTelegram:
+			plan.NoContact++
+			continue
+		case !wantEmail && !wantTelegram:
+			plan.AlreadySent++
+			continue
+		}
+		subject, html, text, err := rule.render(rcpt.Data)
+		if err != nil {
+			log.Printf("напоминание %s для %s: шаблон: %v", rule.ID, rcpt.Name, err)
+			continue
+		}
+		d := reminderDelivery{Guest: rcpt.Guest, Name: rcpt.Name, rsvpID: rcpt.Guest}
+		if strings.HasPrefix(d.rsvpID, "inv-") {
+			d.rsvpID = ""
+		}
+		if wantEmail {
+			e := d
+			e.Channel, e.Email, e.Subject, e.HTML = outboxEmail, rcpt.Email, subject, html
+			e.key = rcpt.sentKey(rule.ID, outboxEmail)
+			plan.Deliveries = append(plan.Deliveries, e)
+		}
+		if wantTelegram {
+			t := d
+			t.Channel, t.ChatID, t.Text, t.ParseMode = outboxTelegram, rcpt.ChatID, text, rule.ParseMode
+			t.key = rcpt.sentKey(rule.ID, outboxTelegram)
+			plan.Deliveries = append(plan.Deliveries, t)
+			// тот же чат у следующего ответа уже не получит это напоминание
+			sent[t.key] = true
+		}
+	}
+	return plan, nil
+}
+
+// sendReminder ставит в очередь сообщения правила всем, кому ещё не отправляли, отмечая каждое сразу,
+// поэтому после падения посреди рассылки следующий проход продолжит с того же места.
+// С dryRun только возвращает, что было бы отправлено.
+func (a *app) sendReminder(rule *reminderRule, dryRun bool) (reminderPlan, error) {
+	plan, err := a.planReminder(rule)
+	if err != nil {
+		log.Printf("напоминание %s: %v", rule.ID, err)
+		return plan, err
+	}
+	plan.DryRun = dryRun
+	if dryRun {
+		return plan, nil
+	}
+	emails, chats := 0, 0
+	for i := range plan.Deliveries {
+		d := &plan.Deliveries[i]
+		if !a.queueReminder(d.key, d.message()) {
+			continue
+		}
+		d.MessageID = outboxKeyID(d.key)
+		if d.Channel == outboxTelegram {
+			chats++
+		} else {
+			emails++
+		}
+	}
+	if emails+chats > 0 {
+		log.Printf("напоминание %s: в очереди %d писем и %d сообщений в Telegram", rule.ID, emails, chats)
+	}
+	return plan, nil
+}
+
+// reminderRule — правило по id, nil — нет такого.
+func (a *app) reminderRule(id string) *reminderRule {
+	for i := range a.reminderRules {
+		if a.reminderRules[i].ID == id {
+			return &a.reminderRules[i]
+		}
+	}
+	return nil
+}
+
+// queueReminder ставит сообщение в очередь один раз на ключ key и отмечает его отправленным. Если процесс упадёт
+// между постановкой и отметкой, на следующем проходе очередь узнает сообщение по ключу и второго не поставит.
+func (a *app) queueReminder(key string, m outboxMessage) bool {
+	if err := a.outbox.enqueueOnce(key, m); err != nil {
+		log.Printf("напоминания: очередь %s: %v", key, err)
+		return false
+	}
+	if err := a.reminders.add([]string{key}); err != nil {
+		log.Printf("напоминания: отметка %s: %v", key, err)
+	}
+	return true
+}
+
+// reminderView — правило в ответе API: расписание и состояние без шаблонов.
+type reminderView struct {
+	ID       string   `json:"id"`
+	Offset   string   `json:"offset"`
+	At       string   `json:"at"`
+	Channels []string `json:"channels"`
+	Audience string   `json:"audience"`
+	Question string   `json:"question,omitempty"`
+	// FireAt — время отправки по WEDDING_TIMEZONE; State — scheduled, due (идёт окно отправки) или closed
+	FireAt string `json:"fire_at,omitempty"`
+	State  string `json:"state,omitempty"`
+}
+
+// handleAdminReminders — /api/admin/reminders: GET — правила и их расписание;
+// GET /{id}/preview — кому и что правило отправило бы сейчас, ничего не отправляя;
+// POST /{id}/send — отправить сейчас, не дожидаясь расписания (с теми же отметками, что и по расписанию).
+func (a *app) handleAdminReminders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		who, ok := a.adminAccess(w, r, "")
+		if !ok {
+			return
+		}
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/reminders"), "/")
+		if rest == "" {
+			if r.Method != http.MethodGet {
+				http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+				return
+			}
+			a.adminListReminders(w)
+			return
+		}
+		id, action, _ := strings.Cut(rest, "/")
+		var dryRun bool
+		switch {
+		case action == "preview" && r.Method == http.MethodGet:
+			dryRun = true
+		case action == "send" && r.Method == http.MethodPost:
+		default:
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		rule := a.reminderRule(id)
+		if rule == nil {
+			http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+			return
+		}
+		if !dryRun {
+			log.Printf("напоминание %s: отправка вручную (%s)", rule.ID, who.Login)
+		}
+		plan, err := a.sendReminder(rule, dryRun)
+		if err != nil {
+			http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "plan": plan})
+	}
+}
+
+func (a *app) adminListReminders(w http.ResponseWriter) {
+	now := time.Now()
+	out := make([]reminderView, 0, len(a.reminderRules))
+	for i := range a.reminderRules {
+		out = append(out, a.viewReminder(&a.reminderRules[i], now))
+	}
+	resp := map[string]interface{}{"ok": true, "reminders": out, "grace": a.reminderGrace.String()}
+	if !a.weddingDate.IsZero() {
+		resp["wedding_date"] = a.weddingDate.Format("2006-01-02")
+		resp["timezone"] = a.weddingDate.Location().String()
+	}
+	writeAdminJSON(w, http.StatusOK, resp)
+}
+
+func (a *app) viewReminder(rule *reminderRule, now time.Time) reminderView {
+	v := reminderView{
+		ID:       rule.ID,
+		Offset:   rule.Offset,
+		At:       fmt.Sprintf("%02d:%02d", int(rule.at/time.Hour), int(rule.at%time.Hour/time.Minute)),
+		Channels: rule.Channels,
+		Audience: rule.Audience,
+		Question: rule.Question,
+	}
+	if a.weddingDate.IsZero() {
+		return v
+	}
+	at := rule.fireAt(a.weddingDate)
+	v.FireAt = at.Format(time.RFC3339)
+	switch {
+	case now.Before(at):
+		v.State = "scheduled"
+	case now.Before(at.Add(a.reminderGrace)):
+		v.State = "due"
+	default:
+		v.State = "closed"
+	}
+	return v
+}
+
+// runRemindersCommand — подкоманда «reminders»: список правил, предпросмотр и отправка напоминания сейчас.
+// send только ставит сообщения в очередь, доставляет их сервер: иначе команда и воркер очереди сервера
+// могли бы отправить одно и то же сообщение дважды. С json-хранилищем очередь прочитается при запуске
+// сервера (пока он работает, команда не откроет данные), с sqlite — при очередной проверке очереди.
+func runRemindersCommand(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, `использование:
+  wedding-rsvp reminders list            правила и когда они сработают
+  wedding-rsvp reminders preview <id>    кому и что уйдёт, ничего не отправляя
+  wedding-rsvp reminders send <id>       отправить сейчас, не дожидаясь расписания`)
+		os.Exit(2)
+	}
+	if len(args) == 0 || (args[0] == "list") != (len(args) == 1) || len(args) > 2 {
+		usage()
+	}
+	cmd := args[0]
+	if cmd != "list" && cmd != "preview" && cmd != "send" {
+		usage()
+	}
+
+	dataPath := dataPathFromEnv()
+	questions, err := loadQuestions(strings.TrimSpace(os.Getenv("RSVP_QUESTIONS_PATH")))
+	if err != nil {
+		log.Fatalf("RSVP_QUESTIONS_PATH: %v", err)
+	}
+	rules, err := loadReminderRules(strings.TrimSpace(os.Getenv("REMINDERS_PATH")), questions)
+	if err != nil {
+		log.Fatalf("REMINDERS_PATH: %v", err)
+	}
+	mail, _, err := mailerFromEnv(dataPath)
+	if err != nil {
+		log.Fatalf("почта: %v", err)
+	}
+	st, err := openStorage(os.Getenv("STORAGE_DRIVER"), dataPath, strings.TrimSpace(os.Getenv("SQLITE_PATH")))
+	if err != nil {
+		log.Fatalf("хранилище: %v", err)
+	}
+	defer st.close()
+	fail := func(format string, v ...interface{}) {
+		st.close()
+		log.Fatalf(format, v...)
+	}
+	tokens, cancelTTL := tokensFromEnv(dataPath)
+	weddingDate, grace := weddingScheduleFromEnv()
+	a := &app{
+		mail:          mail,
+		rsvps:         st.rsvps,
+		tokens:        tokens,
+		cancelTTL:     cancelTTL,
+		siteURL:       siteURLFromEnv(),
+		wedding:       weddingInfoFromEnv(),
+		questions:     questions,
+		invitations:   st.invitations,
+		weddingDate:   weddingDate,
+		reminders:     st.reminders,
+		reminderRules: rules,
+		reminderGrace: grace,
+		state:         st.state,
+		tg:            telegramClientFromEnv(),
+		tgUsers:       st.tgUsers,
+	}
+	a.outbox = newOutbox(st.outbox, a.deliverNotification)
+
+	if cmd == "list" {
+		now := time.Now()
+		for i := range a.reminderRules {
+			v := a.viewReminder(&a.reminderRules[i], now)
+			fmt.Printf("%s\t%s %s\t%s\t%s\t%s %s\n", v.ID, v.Offset, v.At, strings.Join(v.Channels, ","), v.Audience, v.FireAt, v.State)
+		}
+		return
+	}
+	rule := a.reminderRule(args[1])
+	if rule == nil {
+		fail("%s: нет такого напоминания", args[1])
+	}
+	plan, err := a.sendReminder(rule, cmd == "preview")
+	if err != nil {
+		fail("%v", err)
+	}
+	for _, d := range plan.Deliveries {
+		if d.Channel == outboxTelegram {
+			fmt.Printf("telegram → %d (%s)\n%s\n\n", d.ChatID, d.Name, d.Text)
+		} else {
+			fmt.Printf("email → %s (%s)\nТема: %s\n%s\n\n", d.Email, d.Name, d.Subject, d.HTML)
+		}
+	}
+	fmt.Printf("%s: сообщений %d, уже отправлено %d, без контактов %d\n", rule.ID, len(plan.Deliveries), plan.AlreadySent, plan.NoContact)
+	if cmd == "preview" || len(plan.Deliveries) == 0 {
+		return
+	}
+	fmt.Printf("поставлено в очередь %d, отправит сервер (см. /api/admin/outbox)\n", len(plan.Deliveries))
+}
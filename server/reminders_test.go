@@ -0,0 +1,238 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFireAt(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name    string
+		offset  string
+		at      string
+		wedding time.Time
+		want    string
+	}{
+		{"default time", "10d", "", time.Date(2026, 6, 20, 0, 0, 0, 0, moscow), "2026-06-10T09:00:00+03:00"},
+		{"wedding day", "0d", "08:30", time.Date(2026, 6, 20, 0, 0, 0, 0, moscow), "2026-06-20T08:30:00+03:00"},
+		{"across month", "30d", "19:00", time.Date(2026, 3, 15, 0, 0, 0, 0, moscow), "2026-02-13T19:00:00+03:00"},
+		// 29 марта 2026 в Берлине часы переводятся в 02:00; напоминание всё равно в 09:00 по местному
+		{"dst switch on the day", "10d", "09:00", time.Date(2026, 4, 8, 0, 0, 0, 0, berlin), "2026-03-29T09:00:00+02:00"},
+		{"before dst switch", "14d", "09:00", time.Date(2026, 4, 8, 0, 0, 0, 0, berlin), "2026-03-25T09:00:00+01:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := []reminderRule{{ID: "r", Offset: tt.offset, At: tt.at, Channels: []string{outboxTelegram}, Audience: audienceAttending, Text: "t"}}
+			if err := prepareReminderRules(rules, nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := rules[0].fireAt(tt.wedding).Format(time.RFC3339); got != tt.want {
+				t.Fatalf("fireAt = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReminderSent(t *testing.T) {
+	legacy := defaultReminderRules()[0]
+	custom := reminderRule{ID: "meal"}
+	rcpt := reminderRecipient{Guest: "r1", Email: " Anna@Example.com", ChatID: 100}
+	tests := []struct {
+		name    string
+		rule    *reminderRule
+		sent    string
+		channel string
+		want    bool
+	}{
+		{"nothing sent", &legacy, "", outboxEmail, false},
+		{"email by guest", &legacy, "10d:r1:email", outboxEmail, true},
+		{"email mark is not telegram", &legacy, "10d:r1:email", outboxTelegram, false},
+		{"telegram by chat", &legacy, "10d:tg100:telegram", outboxTelegram, true},
+		{"telegram to another chat", &legacy, "10d:tg200:telegram", outboxTelegram, false},
+		{"telegram marked by guest before per-chat keys", &legacy, "10d:r1:telegram", outboxTelegram, true},
+		{"legacy 10-day mark is an email address", &legacy, "anna@example.com", outboxEmail, true},
+		{"legacy mark does not cover telegram", &legacy, "anna@example.com", outboxTelegram, false},
+		{"legacy mark only for the default rule", &custom, "anna@example.com", outboxEmail, false},
+		{"other rule", &custom, "10d:r1:email", outboxEmail, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := map[string]bool{tt.sent: tt.sent != ""}
+			if got := reminderSent(sent, tt.rule, rcpt, tt.channel); got != tt.want {
+				t.Fatalf("reminderSent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type testMailer struct{}
+
+func (testMailer) send(to, subject, html string) error { return nil }
+
+// testReminderApp — приложение с JSON-хранилищем во временном каталоге, почтой и Telegram без отправки
+// (очередь не запущена) и свадьбой 20 июня 2026 по Москве.
+func testReminderApp(t *testing.T, rules []reminderRule) *app {
+	t.Helper()
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip(err)
+	}
+	st, err := openJSONStorage(filepath.Join(t.TempDir(), "rsvps.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.close() })
+	if err := prepareReminderRules(rules, nil); err != nil {
+		t.Fatal(err)
+	}
+	a := &app{
+		mail:          testMailer{},
+		rsvps:         st.rsvps,
+		tokens:        &tokenSigner{key: []byte("test-key")},
+		cancelTTL:     time.Hour,
+		siteURL:       "https://wedding.example",
+		invitations:   st.invitations,
+		weddingDate:   time.Date(2026, 6, 20, 0, 0, 0, 0, moscow),
+		reminders:     st.reminders,
+		reminderRules: rules,
+		reminderGrace: 24 * time.Hour,
+		state:         st.state,
+		tg:            &tgClient{},
+		tgUsers:       st.tgUsers,
+	}
+	a.outbox = newOutbox(st.outbox, a.deliverNotification)
+	return a
+}
+
+func emailReminderRule() []reminderRule {
+	return []reminderRule{{ID: "soon", Offset: "10d", Channels: []string{outboxEmail}, Audience: audienceAttending, Subject: "Скоро", HTML: "<p>{{.Name}}</p>"}}
+}
+
+func queued(t *testing.T, a *app) []outboxMessage {
+	t.Helper()
+	list, err := a.outbox.store.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestSendDueRemindersGraceWindow(t *testing.T) {
+	at := time.Date(2026, 6, 10, 9, 0, 0, 0, time.FixedZone("MSK", 3*3600))
+	tests := []struct {
+		name       string
+		lastRun    time.Time
+		now        time.Time
+		wantQueued int
+	}{
+		{"before the time", time.Time{}, at.Add(-time.Minute), 0},
+		{"on time", at.Add(-reminderCheckEvery), at, 1},
+		{"first run inside the window", time.Time{}, at.Add(3 * time.Hour), 1},
+		{"catch-up after downtime", at.Add(-48 * time.Hour), at.Add(23 * time.Hour), 1},
+		{"window closed during downtime", at.Add(-48 * time.Hour), at.Add(25 * time.Hour), 0},
+		{"window closed long ago", at.Add(48 * time.Hour), at.Add(49 * time.Hour), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testReminderApp(t, emailReminderRule())
+			a.rsvps.create(storedRSVP{ID: "r1", Name: "Анна", Email: "anna@example.com"})
+			if !tt.lastRun.IsZero() {
+				a.state.set(stateKeyRemindersLastRun, tt.lastRun.UTC().Format(time.RFC3339))
+			}
+			a.sendDueReminders(tt.now)
+			if got := len(queued(t, a)); got != tt.wantQueued {
+				t.Fatalf("queued %d, want %d", got, tt.wantQueued)
+			}
+			if last := a.remindersLastRun(); !last.Equal(tt.now.Truncate(time.Second)) {
+				t.Fatalf("last run = %v, want %v", last, tt.now)
+			}
+			// следующая проверка в том же окне ничего не повторяет
+			a.sendDueReminders(tt.now.Add(30 * time.Second))
+			if got := len(queued(t, a)); got != tt.wantQueued {
+				t.Fatalf("after second run queued %d, want %d", got, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestSendDueRemindersOncePerChat(t *testing.T) {
+	rules := []reminderRule{{ID: "day", Offset: "0d", Channels: []string{outboxEmail, outboxTelegram}, Audience: audienceAttending,
+		Subject: "Сегодня", HTML: "<p>{{.Name}}</p>", Text: "{{.Name}}, ждём вас"}}
+	a := testReminderApp(t, rules)
+	chat := int64(100)
+	a.rsvps.create(storedRSVP{ID: "r1", Name: "Анна", Email: "anna@example.com", TelegramChatID: &chat})
+	a.rsvps.create(storedRSVP{ID: "r2", Name: "Анна и Борис", Email: "boris@example.com", TelegramChatID: &chat})
+	a.rsvps.create(storedRSVP{ID: "r3", Name: "Вера", Status: statusDeclined, Email: "vera@example.com"})
+	// телефон гостя назвал боту кто-то другой — ссылки из напоминания в его чат не уходят
+	a.rsvps.create(storedRSVP{ID: "r4", Name: "Глеб", Phone: "+7 999 000-00-04"})
+	a.tgUsers.save(tgUser{ChatID: 666, Phone: "+7 999 000-00-04"})
+	a.sendDueReminders(rules[0].fireAt(a.weddingDate))
+
+	var emails, chats int
+	for _, m := range queued(t, a) {
+		if m.Kind == outboxTelegram {
+			chats++
+		} else {
+			emails++
+		}
+	}
+	if emails != 2 || chats != 1 {
+		t.Fatalf("queued %d emails and %d telegram messages, want 2 and 1", emails, chats)
+	}
+	sent, _ := a.reminders.list()
+	for _, key := range []string{"day:r1:email", "day:r2:email", "day:tg100:telegram"} {
+		if !sent[key] {
+			t.Errorf("no mark %s in %v", key, sent)
+		}
+	}
+}
+
+func TestSendReminderDryRun(t *testing.T) {
+	a := testReminderApp(t, emailReminderRule())
+	a.rsvps.create(storedRSVP{ID: "r1", Name: "Анна", Email: "anna@example.com"})
+	a.rsvps.create(storedRSVP{ID: "r2", Name: "Борис"})
+	rule := a.reminderRule("soon")
+
+	plan, err := a.sendReminder(rule, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.DryRun || len(plan.Deliveries) != 1 || plan.NoContact != 1 || plan.Deliveries[0].HTML != "<p>Анна</p>" {
+		t.Fatalf("preview = %+v", plan)
+	}
+	sent, _ := a.reminders.list()
+	if len(queued(t, a)) != 0 || len(sent) != 0 {
+		t.Fatalf("preview queued or marked something: %v", sent)
+	}
+
+	plan, _ = a.sendReminder(rule, false)
+	if len(plan.Deliveries) != 1 || plan.Deliveries[0].MessageID != outboxKeyID("soon:r1:email") || len(queued(t, a)) != 1 {
+		t.Fatalf("send = %+v", plan)
+	}
+	plan, _ = a.sendReminder(rule, true)
+	if len(plan.Deliveries) != 0 || plan.AlreadySent != 1 {
+		t.Fatalf("preview after send = %+v", plan)
+	}
+}
+
+func TestPrepareReminderRulesUnansweredEmailOnly(t *testing.T) {
+	rule := func(channels ...string) []reminderRule {
+		return []reminderRule{{ID: "ask", Offset: "30d", Channels: channels, Audience: audienceUnanswered,
+			Subject: "Ждём ответ", HTML: "<p>{{.InviteURL}}</p>", Text: "{{.InviteURL}}"}}
+	}
+	if err := prepareReminderRules(rule(outboxEmail, outboxTelegram), nil); err == nil {
+		t.Fatal("telegram accepted for unanswered invitations")
+	}
+	if err := prepareReminderRules(rule(outboxEmail), nil); err != nil {
+		t.Fatal(err)
+	}
+}
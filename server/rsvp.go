@@ -0,0 +1,623 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ответ гостя на приглашение
+const (
+	statusAttending = "attending"
+	statusDeclined  = "declined"
+	statusMaybe     = "maybe"
+)
+
+// parseStatus проверяет статус из запроса; пустой — «придёт», как было до появления поля.
+func parseStatus(s string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", statusAttending:
+		return statusAttending, true
+	case statusDeclined:
+		return statusDeclined, true
+	case statusMaybe:
+		return statusMaybe, true
+	}
+	return "", false
+}
+
+func statusLabel(status string) string {
+	switch status {
+	case statusDeclined:
+		return "не придёт"
+	case statusMaybe:
+		return "пока не уверен(а)"
+	}
+	return "придёт"
+}
+
+type RSVPRequest struct {
+	Name  string `json:"name"`
+	Phone string `json:"phone"`
+	Email string `json:"email"`
+	// Status — attending (по умолчанию), declined или maybe
+	Status string `json:"status"`
+	// TelegramInitData — строка initData из Telegram Web App; chat_id берётся только из неё после проверки подписи
+	TelegramInitData string `json:"telegram_init_data,omitempty"`
+	// Party — кто придёт вместе с ответившим (сам ответивший в список не входит)
+	Party []partyMember `json:"party"`
+	// GuestCount — устаревшее поле: общее число гостей без имён, учитывается, только если Party пуст
+	GuestCount int `json:"guest_count"`
+	// Answers — ответы на дополнительные вопросы (id вопроса → значение)
+	Answers map[string]json.RawMessage `json:"answers,omitempty"`
+	// EditToken — токен из ссылки «изменить ответ»; с ним меняется существующий ответ
+	EditToken string `json:"edit_token,omitempty"`
+	// InviteCode — код персонального приглашения
+	InviteCode string `json:"invite_code,omitempty"`
+}
+
+type storedRSVP struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Phone          string `json:"phone"`
+	Email          string `json:"email"`
+	Status         string `json:"status,omitempty"`
+	TelegramChatID *int64 `json:"telegram_chat_id,omitempty"`
+	// Party — спутники ответившего; у старых записей пуст, есть только GuestCount
+	Party []partyMember `json:"party,omitempty"`
+	// GuestCount — сколько всего придёт, включая ответившего (0, если не придёт)
+	GuestCount int `json:"guest_count"`
+	// Answers — проверенные ответы на дополнительные вопросы, см. validateAnswers
+	Answers map[string]interface{} `json:"answers,omitempty"`
+	At      string                 `json:"at"`
+	// CancelledAt — когда гость отменил ранее данное согласие (статус при этом declined)
+	CancelledAt string `json:"cancelled_at,omitempty"`
+	// UpdatedAt и Revisions — когда и что гость менял после первого ответа
+	UpdatedAt string         `json:"updated_at,omitempty"`
+	Revisions []rsvpRevision `json:"revisions,omitempty"`
+	// InvitationID — приглашение, по которому дан ответ
+	InvitationID string `json:"invitation_id,omitempty"`
+}
+
+// attendance — статус записи; у записей, сохранённых до появления статуса, это «придёт».
+func (e storedRSVP) attendance() string {
+	if e.Status == "" {
+		return statusAttending
+	}
+	return e.Status
+}
+
+// headcount — сколько человек придёт по этому ответу.
+func (e storedRSVP) headcount() int {
+	if e.attendance() == statusDeclined {
+		return 0
+	}
+	if len(e.Party) > 0 {
+		return 1 + len(e.Party)
+	}
+	if e.GuestCount < 1 {
+		return 1
+	}
+	return e.GuestCount
+}
+
+// maxPartySize — сколько человек можно привести с собой (всего в ответе не больше 20).
+const maxPartySize = 19
+
+// partyMember — человек, который придёт вместе с ответившим.
+type partyMember struct {
+	Name  string `json:"name"`
+	Child bool   `json:"child,omitempty"`
+	Notes string `json:"notes,omitempty"`
+}
+
+// validateParty обрезает пробелы и проверяет спутников; текст ошибки уходит клиенту как есть.
+func validateParty(in []partyMember) ([]partyMember, error) {
+	if len(in) > maxPartySize {
+		return nil, fmt.Errorf("party: at most %d members", maxPartySize)
+	}
+	var out []partyMember
+	for i, m := range in {
+		m.Name = strings.TrimSpace(m.Name)
+		m.Notes = strings.TrimSpace(m.Notes)
+		if m.Name == "" || len(m.Name) > 200 {
+			return nil, fmt.Errorf("party[%d]: name required, max 200 chars", i)
+		}
+		if len(m.Notes) > 500 {
+			return nil, fmt.Errorf("party[%d]: notes max 500 chars", i)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// markDeclined переводит запись в «не придёт», запоминая момент отмены.
+func (e *storedRSVP) markDeclined(now time.Time) {
+	e.Status = statusDeclined
+	if e.CancelledAt == "" {
+		e.CancelledAt = now.UTC().Format(time.RFC3339)
+	}
+}
+
+// weddingInfo — то, что подставляется в тексты писем и сообщений.
+type weddingInfo struct {
+	placeName   string
+	placeURL    string
+	dateDisplay string
+	timeDisplay string
+}
+
+// app — общие зависимости HTTP-обработчиков.
+type app struct {
+	// mail — nil, если почта не настроена; toEmail — куда слать уведомления о новых ответах, может быть пустым
+	mail    mailer
+	toEmail string
+
+	rsvps   rsvpStore
+	limiter *rsvpLimiter
+	tokens  *tokenSigner
+	// cancelTTL — срок жизни ссылки отмены из письма
+	cancelTTL time.Duration
+	siteURL   string
+	wedding   weddingInfo
+	// questions — дополнительные вопросы анкеты из RSVP_QUESTIONS_PATH
+	questions []question
+
+	invitations invitationStore
+	// requireInvite — принимать новые ответы только по коду приглашения
+	requireInvite bool
+	// exportSecret — ключ для выгрузки скриптами (заголовок X-Export-Key); люди входят в /admin под учётными записями
+	exportSecret string
+	// configAdmins — учётные записи из ADMIN_USERS, admins — созданные командой «admin» и через API
+	configAdmins []adminUser
+	admins       adminUserStore
+	// audit — журнал изменений ответов, см. recordAudit
+	audit auditStore
+	// outbox — очередь писем и сообщений в Telegram, см. outbox
+	outbox       *outbox
+	loginLimiter *rsvpLimiter
+	// loginFailures — неудачные входы по логину и адресу, см. adminLoginMaxFailures
+	loginFailures *loginFailures
+	// weddingDate — дата из WEDDING_DATE в часовом поясе WEDDING_TIMEZONE (нулевая, если не задана);
+	// reminders — отметки отправленных напоминаний, reminderGrace — сколько их можно досылать после простоя
+	weddingDate   time.Time
+	reminders     reminderSentStore
+	reminderRules []reminderRule
+	reminderGrace time.Duration
+	// state — служебные значения (время прошлой проверки напоминаний)
+	state stateStore
+
+	tg *tgClient
+	// tgPace — темп отправки в Telegram из очереди уведомлений
+	tgPace       tgPacer
+	tgUsers      tgUserStore
+	tgToken      string
+	tgInitMaxAge time.Duration
+}
+
+// httpErrorJSON — как http.Error с {"error":...}, но для текста, который нужно экранировать.
+func httpErrorJSON(w http.ResponseWriter, msg string, code int) {
+	data, _ := json.Marshal(map[string]string{"error": msg})
+	http.Error(w, string(data), code)
+}
+
+func (a *app) tgEnabled() bool {
+	return a.tg != nil && a.tgUsers != nil
+}
+
+// rsvpInput — проверенные поля анкеты.
+type rsvpInput struct {
+	name, phone, email, status string
+	party                      []partyMember
+	guestCount                 int
+	answers                    map[string]interface{}
+}
+
+// validateRSVP проверяет анкету — и из формы, и из админки. Текст ошибки уходит клиенту как есть.
+func (a *app) validateRSVP(body RSVPRequest) (rsvpInput, error) {
+	in := rsvpInput{
+		name:  strings.TrimSpace(body.Name),
+		phone: strings.TrimSpace(body.Phone),
+		email: strings.TrimSpace(body.Email),
+	}
+	if in.name == "" || len(in.name) > 200 {
+		return in, errors.New("name required, max 200 chars")
+	}
+	if len(normalizePhone(in.phone)) < 10 {
+		return in, errors.New("phone required, at least 10 digits")
+	}
+	if in.email != "" && (len(in.email) > 254 || !strings.Contains(in.email, "@")) {
+		return in, errors.New("invalid email")
+	}
+	status, ok := parseStatus(body.Status)
+	if !ok {
+		return in, errors.New("status must be attending, declined or maybe")
+	}
+	in.status = status
+	party, err := validateParty(body.Party)
+	if err != nil {
+		return in, err
+	}
+	// Обязательные вопросы (меню, трансфер) не нужны тем, кто не придёт
+	if in.answers, err = validateAnswers(a.questions, body.Answers, status != statusDeclined); err != nil {
+		return in, err
+	}
+	in.party, in.guestCount = party, 1+len(party)
+	// Старые клиенты присылают только число гостей без имён
+	if len(party) == 0 && body.GuestCount > 1 {
+		in.guestCount = min(body.GuestCount, maxPartySize+1)
+	}
+	if status == statusDeclined {
+		in.party, in.guestCount = nil, 0
+	}
+	return in, nil
+}
+
+func (a *app) handleRSVP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			a.handleRSVPLookup(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); !strings.Contains(ct, "application/json") {
+			http.Error(w, `{"error":"content-type must be application/json"}`, http.StatusUnsupportedMediaType)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		dec := json.NewDecoder(r.Body)
+		var body RSVPRequest
+		if err := dec.Decode(&body); err != nil {
+			http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+			return
+		}
+
+		in, err := a.validateRSVP(body)
+		if err != nil {
+			httpErrorJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name, phone, email, status := in.name, in.phone, in.email, in.status
+		party, guestCount, answers := in.party, in.guestCount, in.answers
+
+		// chat_id берём только из проверенного initData. Если подпись не сошлась или initData устарел,
+		// ответ всё равно принимаем, просто без привязки к Telegram.
+		var tgChatID *int64
+		if a.tgEnabled() && body.TelegramInitData != "" {
+			initData, err := verifyTelegramInitData(a.tgToken, body.TelegramInitData, a.tgInitMaxAge)
+			if err != nil {
+				log.Printf("RSVP: initData отклонён, без привязки к Telegram: %v", err)
+			} else {
+				chatID := initData.User.ID
+				tgChatID = &chatID
+			}
+		}
+		channel, actor := auditChannelWeb, auditActorGuest
+		if tgChatID != nil {
+			channel, actor = auditChannelTelegram, auditTelegramActor(*tgChatID)
+		}
+		audit := func(action string, before, after *storedRSVP) {
+			recordAudit(a.audit, auditEntry{Action: action, Channel: channel, Actor: actor, IP: clientIP(r), Before: before, After: after})
+		}
+
+		if !a.limiter.allow(clientIP(r)) {
+			http.Error(w, `{"error":"too many requests"}`, http.StatusTooManyRequests)
+			return
+		}
+
+		// Приглашение: по коду узнаём семью и её лимит гостей
+		var inv *invitation
+		if code := normalizeInviteCode(body.InviteCode); code != "" {
+			found := false
+			inv, found, err = a.invitations.getByCode(code)
+			if err != nil {
+				log.Printf("RSVP: приглашение %s: %v", code, err)
+				http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, `{"error":"invalid invitation"}`, http.StatusForbidden)
+				return
+			}
+		}
+
+		// Существующий ответ меняем только по ссылке из письма (edit_token), по коду приглашения,
+		// на которое он дан, или из того же Telegram-аккаунта, с которого он был отправлен.
+		var existing *storedRSVP
+		var source string
+		if body.EditToken != "" {
+			id, err := a.tokens.verify(tokenPurposeEdit, body.EditToken)
+			if err == errTokenExpired {
+				http.Error(w, `{"error":"link expired"}`, http.StatusGone)
+				return
+			}
+			if err != nil {
+				http.Error(w, `{"error":"invalid link"}`, http.StatusForbidden)
+				return
+			}
+			entry, found, err := a.rsvps.get(id)
+			if err != nil {
+				log.Printf("RSVP: загрузка %s: %v", id, err)
+				http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+				return
+			}
+			if other, taken, err := a.rsvps.findByPhone(phone); err == nil && taken && other.ID != entry.ID {
+				http.Error(w, `{"error":"phone already used"}`, http.StatusConflict)
+				return
+			}
+			existing, source = entry, revisionSourceLink
+		}
+		if body.EditToken == "" && inv != nil && inv.RSVPID != "" {
+			entry, found, err := a.rsvps.get(inv.RSVPID)
+			if err != nil {
+				log.Printf("RSVP: загрузка %s: %v", inv.RSVPID, err)
+				http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+				return
+			}
+			if found {
+				if other, taken, err := a.rsvps.findByPhone(phone); err == nil && taken && other.ID != entry.ID {
+					http.Error(w, `{"error":"phone already used"}`, http.StatusConflict)
+					return
+				}
+				existing, source = entry, revisionSourceInvitation
+			}
+		}
+		if existing == nil && body.EditToken == "" {
+			entry, found, err := a.rsvps.findByPhone(phone)
+			if err != nil {
+				log.Printf("RSVP: поиск по телефону: %v", err)
+				http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+				return
+			}
+			if found && inv != nil && sameInvitation(inv, entry) {
+				existing, source = entry, revisionSourceInvitation
+			} else if found {
+				if !canEditByTelegram(entry, tgChatID) {
+					// Телефон уже ответил, а подтверждения нет — ничего не меняем и никого не уведомляем
+					log.Printf("RSVP: повторная анкета с телефоном %s без подтверждения", phone)
+					audit(auditDuplicate, entry, &storedRSVP{Name: name, Phone: phone, Email: email, Status: status,
+						Party: party, GuestCount: guestCount, Answers: answers, TelegramChatID: tgChatID})
+					sent := a.sendEditLink(entry)
+					w.Header().Set("Content-Type", "application/json; charset=utf-8")
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(map[string]interface{}{"error": "already answered", "edit_link_sent": sent})
+					return
+				}
+				existing, source = entry, revisionSourceTelegram
+			}
+		}
+
+		// Ответ, уже привязанный к приглашению, остаётся за ним
+		if existing != nil && existing.InvitationID != "" && (inv == nil || inv.ID != existing.InvitationID) {
+			if linked, found, err := a.invitations.get(existing.InvitationID); err == nil && found {
+				inv = linked
+			}
+		}
+		if existing == nil && inv == nil && a.requireInvite {
+			http.Error(w, `{"error":"invitation required"}`, http.StatusForbidden)
+			return
+		}
+		if inv != nil && inv.MaxParty > 0 && guestCount > inv.MaxParty {
+			httpErrorJSON(w, fmt.Sprintf("party too large, max %d", inv.MaxParty), http.StatusBadRequest)
+			return
+		}
+		invitationID := ""
+		if inv != nil {
+			invitationID = inv.ID
+		}
+
+		now := time.Now()
+		var saved storedRSVP
+		var changes []fieldChange
+		if existing == nil {
+			saved = storedRSVP{
+				ID:             newID(),
+				Name:           name,
+				Phone:          phone,
+				Email:          email,
+				Status:         status,
+				Party:          party,
+				GuestCount:     guestCount,
+				Answers:        answers,
+				TelegramChatID: tgChatID,
+				InvitationID:   invitationID,
+				At:             now.UTC().Format(time.RFC3339),
+			}
+			// Уведомления сохраняются вместе с ответом (см. rsvpStore.createNotify)
+			saved, err = a.rsvps.createNotify(saved, a.rsvpCreatedMessages(saved))
+			if err != nil {
+				log.Printf("RSVP: сохранение: %v", err)
+				http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+				return
+			}
+			audit(auditCreate, nil, &saved)
+		} else {
+			saved = *existing
+			saved.Name = name
+			saved.Phone = phone
+			saved.Email = email
+			saved.Status = status
+			saved.Party = party
+			saved.GuestCount = guestCount
+			saved.Answers = answers
+			if saved.TelegramChatID == nil {
+				saved.TelegramChatID = tgChatID
+			}
+			if invitationID != "" {
+				saved.InvitationID = invitationID
+			}
+			if status == statusDeclined {
+				saved.markDeclined(now)
+			} else {
+				saved.CancelledAt = ""
+			}
+			changes = diffRSVP(*existing, saved, a.questions)
+			if len(changes) > 0 {
+				saved.recordRevision(source, changes, now)
+			}
+			if len(changes) > 0 || saved.InvitationID != existing.InvitationID {
+				var messages []outboxMessage
+				if len(changes) > 0 {
+					messages = a.rsvpUpdatedMessages(saved, changes)
+				}
+				if err := a.rsvps.updateNotify(saved, messages); err != nil {
+					log.Printf("RSVP: обновление %s: %v", saved.ID, err)
+					http.Error(w, `{"error":"failed to save"}`, http.StatusInternalServerError)
+					return
+				}
+				audit(auditUpdate, existing, &saved)
+			} else {
+				audit(auditUnchanged, existing, &saved)
+			}
+			if len(changes) > 0 {
+				log.Printf("RSVP: %s (%s) изменил ответ (%s), полей: %d", name, phone, source, len(changes))
+			}
+		}
+		if inv != nil && inv.RSVPID != saved.ID {
+			inv.RSVPID = saved.ID
+			if err := a.invitations.update(*inv); err != nil {
+				log.Printf("RSVP: привязка приглашения %s: %v", inv.ID, err)
+			}
+		}
+
+		if tgChatID != nil {
+			_ = a.tgUsers.save(tgUser{
+				ChatID: *tgChatID,
+				Phone:  phone,
+				Name:   name,
+			})
+			log.Printf("TG: сохранён пользователь chat_id=%d, phone=%s", *tgChatID, phone)
+		}
+
+		// Уведомления уже в очереди вместе с ответом — будим воркер
+		a.outbox.notify()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":         true,
+			"updated":    existing != nil && len(changes) > 0,
+			"edit_token": a.tokens.sign(tokenPurposeEdit, saved.ID, now.Add(a.cancelTTL)),
+		})
+	}
+}
+
+// rsvpCreatedMessages — уведомления о новом ответе: письмо вам, письмо гостю (если указал почту) и сообщение в Telegram.
+func (a *app) rsvpCreatedMessages(entry storedRSVP) []outboxMessage {
+	var messages []outboxMessage
+	status := entry.attendance()
+	subjectName := strings.NewReplacer("\n", " ", "\r", " ").Replace(entry.Name)
+
+	// Вам — кто ответил, контакты и сам ответ (без формальных подписей)
+	noticeHTML := "<p>" + escapeHTML(entry.Name) + " — " + escapeHTML(entry.Phone)
+	if entry.Email != "" {
+		noticeHTML += ", " + escapeHTML(entry.Email)
+	}
+	noticeHTML += "</p><p>Ответ: <b>" + statusLabel(status) + "</b>"
+	if status != statusDeclined {
+		noticeHTML += ", гостей: " + strconv.Itoa(entry.headcount())
+	}
+	noticeHTML += "</p>"
+	if len(entry.Party) > 0 {
+		noticeHTML += "<p>С собой:</p><ul>"
+		for _, m := range entry.Party {
+			noticeHTML += "<li>" + escapeHTML(m.Name)
+			if m.Child {
+				noticeHTML += " (ребёнок)"
+			}
+			if m.Notes != "" {
+				noticeHTML += " — " + escapeHTML(m.Notes)
+			}
+			noticeHTML += "</li>"
+		}
+		noticeHTML += "</ul>"
+	}
+	for _, q := range a.questions {
+		if v, ok := entry.Answers[q.ID]; ok {
+			noticeHTML += "<p>" + escapeHTML(q.Label) + ": " + escapeHTML(formatAnswer(v)) + "</p>"
+		}
+	}
+	if m, ok := a.emailMessage(entry.ID, a.toEmail, "Ответил(а) "+subjectName+" — "+statusLabel(status), noticeHTML); ok {
+		messages = append(messages, m)
+	}
+
+	// Гостю — тёплое короткое письмо (если указал почту)
+	if entry.Email != "" {
+		subject, thankHTML := a.guestThanksEmail(entry.ID, status)
+		if m, ok := a.emailMessage(entry.ID, entry.Email, subject, thankHTML); ok {
+			messages = append(messages, m)
+		}
+	}
+
+	// Сообщение в Telegram: в чат, из которого отправлен ответ, или тому, кто назвал боту этот телефон.
+	// Во втором случае без кнопки отмены: телефон боту никто не подтверждал, и отменить по нему нельзя
+	// (см. cancelRSVPByChatID).
+	if a.tgEnabled() {
+		text, cancelButton := a.telegramThanks(entry.Name, status)
+		if entry.TelegramChatID != nil {
+			messages = append(messages, telegramMessage(entry.ID, *entry.TelegramChatID, text, "Markdown", cancelButton))
+		} else if user, found := a.tgUsers.get(entry.Phone); found {
+			log.Printf("RSVP: пользователь найден, chat_id=%d, сообщение в Telegram", user.ChatID)
+			messages = append(messages, telegramMessage(entry.ID, user.ChatID, text, "Markdown", ""))
+		} else {
+			log.Printf("RSVP: пользователь НЕ найден в tg_users")
+		}
+	}
+	return messages
+}
+
+// guestThanksEmail — тема и текст письма гостю в зависимости от ответа.
+func (a *app) guestThanksEmail(entryID, status string) (string, string) {
+	editURL, cancelURL := a.guestLinks(entryID)
+	editLink := `<a href="` + editURL + `" style="color: #d08888; text-decoration: underline;">изменить ответ</a>`
+	cancelLink := `<a href="` + cancelURL + `" style="color: #d08888; text-decoration: underline;">отменить здесь</a>`
+
+	if status == statusDeclined {
+		html := `<p>Привет!</p><p>Очень жаль, что у вас не получится прийти. Спасибо, что предупредили.</p><p>Обнимаем!</p>`
+		html += `<p style="margin-top: 1.5rem;">Если планы поменяются, вы можете ` + editLink + `.</p>`
+		return "Спасибо, что ответили", html
+	}
+	if status == statusMaybe {
+		html := `<p>Привет!</p><p>Спасибо за ответ! Будем очень рады, если всё-таки получится прийти.</p>`
+		html += `<p style="margin-top: 1.5rem;">Когда станет ясно, вы можете ` + editLink + `, а если не получится — ` + cancelLink + `.</p>`
+		return "Спасибо за ответ!", html
+	}
+	html := `<p>Привет!</p><p>Мы получили ваш ответ и очень рады, что вы будете с нами.</p><p>Ждём встречи, обнимаем.</p>`
+	html += `<p style="margin-top: 1.5rem;">Если ваши планы изменятся, вы можете ` + editLink + ` или ` + cancelLink + `.</p>`
+	return "Рады, что придёте!", html
+}
+
+// telegramThanks — ответ гостю в Telegram: с деталями и кнопкой отмены (её текст — второе значение),
+// если он собирается прийти.
+func (a *app) telegramThanks(name, status string) (string, string) {
+	switch status {
+	case statusDeclined:
+		return fmt.Sprintf("💌 *Спасибо, %s!*\n\nОчень жаль, что не получится прийти. Спасибо, что предупредили!", escapeMarkdown(name)), ""
+	case statusMaybe:
+		reply := fmt.Sprintf("✨ *Спасибо, %s!*\n\nБудем рады, если всё-таки получится прийти! 💕\n\n📍 *Детали:*\nДата: %s\nВремя: %s\nМесто: %s\n\n_Если станет ясно, что не получится, — просто нажмите на кнопку ниже._",
+			escapeMarkdown(name),
+			a.wedding.dateDisplay,
+			a.wedding.timeDisplay,
+			a.wedding.placeName)
+		return reply, "❌ Не смогу"
+	default:
+		// Сообщение с кнопкой отмены
+		reply := fmt.Sprintf("✨ *Спасибо, %s!*\n\nМы так рады, что вы будете с нами! 💕\n\n📍 *Детали:*\nДата: %s\nВремя: %s\nМесто: %s\n\nДо встречи на празднике!\n\n_Если ваши планы изменятся, пожалуйста, сообщите нам об этом — просто нажмите на кнопку ниже._",
+			escapeMarkdown(name),
+			a.wedding.dateDisplay,
+			a.wedding.timeDisplay,
+			a.wedding.placeName)
+		return reply, "❌ Отменить"
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Кто изменил ответ — пишется в историю правок
+const (
+	revisionSourceLink           = "edit_link"
+	revisionSourceTelegram       = "telegram"
+	revisionSourceInvitation     = "invitation"
+	revisionSourceCancelLink     = "cancel_link"
+	revisionSourceCancelTelegram = "cancel_telegram"
+)
+
+// maxRevisions — сколько последних правок хранить в записи.
+const maxRevisions = 50
+
+// fieldChange — одно изменённое поле ответа, значения в том виде, в каком их видят люди.
+type fieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// rsvpRevision — запись в истории правок ответа.
+type rsvpRevision struct {
+	At      string        `json:"at"`
+	Source  string        `json:"source"`
+	Changes []fieldChange `json:"changes"`
+}
+
+// recordRevision добавляет правку в историю; самые старые правки сверх maxRevisions отбрасываются.
+func (e *storedRSVP) recordRevision(source string, changes []fieldChange, now time.Time) {
+	at := now.UTC().Format(time.RFC3339)
+	e.UpdatedAt = at
+	e.Revisions = append(e.Revisions, rsvpRevision{At: at, Source: source, Changes: changes})
+	if len(e.Revisions) > maxRevisions {
+		e.Revisions = append([]rsvpRevision(nil), e.Revisions[len(e.Revisions)-maxRevisions:]...)
+	}
+}
+
+// diffRSVP — что изменилось между двумя версиями ответа. qs нужны, чтобы подписать ответы на вопросы;
+// без них сравниваются только основные поля.
+func diffRSVP(old, cur storedRSVP, qs []question) []fieldChange {
+	var out []fieldChange
+	add := func(field, o, n string) {
+		if o != n {
+			out = append(out, fieldChange{Field: field, Old: o, New: n})
+		}
+	}
+	add("Имя", old.Name, cur.Name)
+	add("Телефон", old.Phone, cur.Phone)
+	add("Почта", old.Email, cur.Email)
+	add("Ответ", statusLabel(old.attendance()), statusLabel(cur.attendance()))
+	add("Гостей", strconv.Itoa(old.headcount()), strconv.Itoa(cur.headcount()))
+	add("Спутники", formatParty(old.Party), formatParty(cur.Party))
+	for _, q := range qs {
+		add(q.Label, formatAnswer(old.Answers[q.ID]), formatAnswer(cur.Answers[q.ID]))
+	}
+	return out
+}
+
+// formatParty — спутники одной строкой: «Анна (ребёнок, без орехов); Пётр».
+func formatParty(party []partyMember) string {
+	parts := make([]string, 0, len(party))
+	for _, m := range party {
+		var extra []string
+		if m.Child {
+			extra = append(extra, "ребёнок")
+		}
+		if m.Notes != "" {
+			extra = append(extra, m.Notes)
+		}
+		s := m.Name
+		if len(extra) > 0 {
+			s += " (" + strings.Join(extra, ", ") + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// guestLinks — ссылки «изменить ответ» и «отменить» для писем гостю.
+func (a *app) guestLinks(entryID string) (editURL, cancelURL string) {
+	exp := time.Now().Add(a.cancelTTL)
+	editURL = a.siteURL + "/?edit=" + url.QueryEscape(a.tokens.sign(tokenPurposeEdit, entryID, exp)) + "#rsvp"
+	cancelURL = a.siteURL + "/cancel?token=" + url.QueryEscape(a.tokens.sign(tokenPurposeCancel, entryID, exp))
+	return editURL, cancelURL
+}
+
+// canEditByTelegram — ответ, отправленный из Telegram, можно менять из того же аккаунта.
+// Телефон из tg_users подтверждением не считается: его гость вводит сам.
+func canEditByTelegram(entry *storedRSVP, tgChatID *int64) bool {
+	return tgChatID != nil && entry.TelegramChatID != nil && *entry.TelegramChatID == *tgChatID
+}
+
+// sameInvitation — ответ дан по этому приглашению (или ещё ни к какому не привязан, но с телефоном из него).
+func sameInvitation(inv *invitation, entry *storedRSVP) bool {
+	if entry.InvitationID != "" {
+		return entry.InvitationID == inv.ID
+	}
+	phoneNorm := normalizePhone(inv.Phone)
+	return phoneNorm != "" && normalizePhone(entry.Phone) == phoneNorm
+}
+
+// handleRSVPLookup — GET /api/rsvp?token=: текущий ответ по ссылке «изменить», чтобы заполнить форму.
+func (a *app) handleRSVPLookup(w http.ResponseWriter, r *http.Request) {
+	id, err := a.tokens.verify(tokenPurposeEdit, r.URL.Query().Get("token"))
+	if err == errTokenExpired {
+		http.Error(w, `{"error":"link expired"}`, http.StatusGone)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"invalid link"}`, http.StatusForbidden)
+		return
+	}
+	entry, found, err := a.rsvps.get(id)
+	if err != nil {
+		log.Printf("RSVP: загрузка %s: %v", id, err)
+		http.Error(w, `{"error":"failed to load data"}`, http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":          true,
+		"name":        entry.Name,
+		"phone":       entry.Phone,
+		"email":       entry.Email,
+		"status":      entry.attendance(),
+		"party":       entry.Party,
+		"guest_count": entry.headcount(),
+		"answers":     entry.Answers,
+	})
+}
+
+// sendEditLink — повторная анкета с уже известным телефоном без подтверждения: данные не трогаем,
+// а ссылку для правки отправляем на почту из сохранённого ответа. Возвращает, встало ли письмо в очередь.
+func (a *app) sendEditLink(entry *storedRSVP) bool {
+	if entry.Email == "" {
+		return false
+	}
+	editURL, _ := a.guestLinks(entry.ID)
+	html := `<p>Привет!</p><p>Кто-то (возможно, вы) снова заполнил анкету с вашим номером телефона. Ваш прежний ответ не изменился.</p>`
+	html += `<p>Чтобы изменить ответ, перейдите <a href="` + editURL + `" style="color: #d08888; text-decoration: underline;">по этой ссылке</a>.</p>`
+	return a.queueEmail(entry.ID, entry.Email, "Ссылка, чтобы изменить ответ", html)
+}
+
+// rsvpUpdatedMessages — уведомления о правке ответа вам, гостю на почту и в Telegram — только о том, что изменилось.
+func (a *app) rsvpUpdatedMessages(entry storedRSVP, changes []fieldChange) []outboxMessage {
+	var messages []outboxMessage
+	subjectName := strings.NewReplacer("\n", " ", "\r", " ").Replace(entry.Name)
+
+	var list strings.Builder
+	list.WriteString("<ul>")
+	for _, c := range changes {
+		list.WriteString("<li>" + escapeHTML(c.Field) + ": " + escapeHTML(orDash(c.Old)) + " → <b>" + escapeHTML(orDash(c.New)) + "</b></li>")
+	}
+	list.WriteString("</ul>")
+
+	if m, ok := a.emailMessage(entry.ID, a.toEmail, "Изменил(а) ответ: "+subjectName,
+		"<p>"+escapeHTML(entry.Name)+" — "+escapeHTML(entry.Phone)+"</p>"+list.String()); ok {
+		messages = append(messages, m)
+	}
+
+	if entry.Email != "" {
+		editURL, cancelURL := a.guestLinks(entry.ID)
+		html := `<p>Привет!</p><p>Мы обновили ваш ответ:</p>` + list.String()
+		html += `<p style="margin-top: 1.5rem;">Изменить ответ ещё раз можно <a href="` + editURL + `" style="color: #d08888; text-decoration: underline;">здесь</a>`
+		if entry.attendance() != statusDeclined {
+			html += `, а отменить — <a href="` + cancelURL + `" style="color: #d08888; text-decoration: underline;">здесь</a>`
+		}
+		html += `.</p>`
+		if m, ok := a.emailMessage(entry.ID, entry.Email, "Ваш ответ обновлён", html); ok {
+			messages = append(messages, m)
+		}
+	}
+
+	// В Telegram — только в чат, из которого отправлен ответ: телефон из tg_users гость вводит сам,
+	// и по нему список изменений с телефоном и почтой ушёл бы тому, кто этот телефон назвал.
+	if a.tgEnabled() && entry.TelegramChatID != nil {
+		reply := "✏️ *Ваш ответ обновлён*\n"
+		for _, c := range changes {
+			reply += fmt.Sprintf("\n• %s: %s → %s", escapeMarkdown(c.Field), escapeMarkdown(orDash(c.Old)), escapeMarkdown(orDash(c.New)))
+		}
+		cancelButton := ""
+		if entry.attendance() != statusDeclined {
+			cancelButton = "❌ Отменить"
+		}
+		messages = append(messages, telegramMessage(entry.ID, *entry.TelegramChatID, reply, "Markdown", cancelButton))
+	}
+	return messages
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
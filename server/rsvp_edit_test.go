@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestRSVPUpdatedMessagesTelegramOnlyToRSVPChat(t *testing.T) {
+	a := testReminderApp(t, nil)
+	a.tgUsers.save(tgUser{ChatID: 666, Phone: "+7 999 000-00-01"})
+	changes := []fieldChange{{Field: "Телефон", Old: "+7 999 000-00-01", New: "+7 999 000-00-09"}}
+
+	for _, m := range a.rsvpUpdatedMessages(storedRSVP{ID: "r1", Name: "Анна", Phone: "+7 999 000-00-01"}, changes) {
+		if m.Kind == outboxTelegram {
+			t.Fatalf("changes sent to chat %d that only claimed the phone", m.ChatID)
+		}
+	}
+
+	chat := int64(100)
+	var chats []int64
+	for _, m := range a.rsvpUpdatedMessages(storedRSVP{ID: "r1", Name: "Анна", Phone: "+7 999 000-00-01", TelegramChatID: &chat}, changes) {
+		if m.Kind == outboxTelegram {
+			chats = append(chats, m.ChatID)
+		}
+	}
+	if len(chats) != 1 || chats[0] != chat {
+		t.Fatalf("telegram messages to %v, want [%d]", chats, chat)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// errNotFound возвращают хранилища, если записи с таким ключом нет.
+var errNotFound = errors.New("not found")
+
+// errCodeTaken — код приглашения уже занят другим приглашением.
+var errCodeTaken = errors.New("invitation code already exists")
+
+// rsvpStore — хранилище ответов гостей. createNotify и updateNotify — то же, что create и update,
+// но вместе с уведомлениями об ответе в очереди (messages уже с id, см. pendingMessage): сохраняется
+// либо всё, либо ничего, и после сбоя не бывает ни ответа без уведомлений, ни уведомлений о несохранённом ответе.
+type rsvpStore interface {
+	create(entry storedRSVP) (storedRSVP, error)
+	createNotify(entry storedRSVP, messages []outboxMessage) (storedRSVP, error)
+	list() ([]storedRSVP, error)
+	get(id string) (*storedRSVP, bool, error)
+	findByPhone(phone string) (*storedRSVP, bool, error)
+	update(entry storedRSVP) error
+	updateNotify(entry storedRSVP, messages []outboxMessage) error
+	delete(id string) error
+}
+
+// tgUserStore — хранилище пользователей Telegram (chat_id ↔ телефон).
+type tgUserStore interface {
+	get(phone string) (*tgUser, bool)
+	getByChatID(chatID int64) (*tgUser, bool)
+	save(user tgUser) error
+	list() ([]tgUser, error)
+	delete(chatID int64) error
+}
+
+// reminderSentStore — отметки об уже отправленных напоминаниях.
+type reminderSentStore interface {
+	list() (map[string]bool, error)
+	add(keys []string) error
+	remove(keys []string) error
+}
+
+// invitationStore — приглашения (семьи из списка гостей) с персональными кодами.
+// create возвращает errCodeTaken, если такой код уже есть.
+type invitationStore interface {
+	create(inv invitation) (invitation, error)
+	list() ([]invitation, error)
+	get(id string) (*invitation, bool, error)
+	getByCode(code string) (*invitation, bool, error)
+	update(inv invitation) error
+	delete(id string) error
+}
+
+// adminUserStore — учётные записи панели управления, созданные командой «admin» или через API.
+type adminUserStore interface {
+	get(login string) (*adminUser, bool, error)
+	list() ([]adminUser, error)
+	save(u adminUser) error
+	delete(login string) error
+}
+
+// stateStore — служебные значения по ключу (offset бота и т. п.).
+type stateStore interface {
+	get(key string) (string, bool, error)
+	set(key, value string) error
+}
+
+// storage объединяет все хранилища одного бэкенда.
+type storage struct {
+	rsvps       rsvpStore
+	tgUsers     tgUserStore
+	reminders   reminderSentStore
+	invitations invitationStore
+	admins      adminUserStore
+	audit       auditStore
+	outbox      outboxStore
+	state       stateStore
+	closeFn     func() error
+}
+
+func (s *storage) close() error {
+	if s.closeFn == nil {
+		return nil
+	}
+	return s.closeFn()
+}
+
+// openStorage открывает хранилище выбранного типа: "json" (файлы рядом с dataPath) или "sqlite".
+func openStorage(driver, dataPath, sqlitePath string) (*storage, error) {
+	dir := filepath.Dir(dataPath)
+	switch strings.ToLower(strings.TrimSpace(driver)) {
+	case "", "json":
+		return openJSONStorage(dataPath)
+	case "sqlite", "sqlite3":
+		if sqlitePath == "" {
+			sqlitePath = filepath.Join(dir, "wedding.db")
+		}
+		return openSQLiteStorage(sqlitePath, dataPath)
+	default:
+		return nil, fmt.Errorf("неизвестный STORAGE_DRIVER %q (нужен json или sqlite)", driver)
+	}
+}
+
+// newID возвращает случайный идентификатор записи.
+func newID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func normalizeEmail(email string) string {
+	return strings.TrimSpace(strings.ToLower(email))
+}
@@ -0,0 +1,966 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// openJSONStorage хранит всё в JSON-файлах в каталоге rsvpPath: rsvps.json (или как названо в
+// RSVP_DATA_PATH), tg_users.json, reminder_sent.json, invitations.json, admin_users.json, audit.json, outbox.json
+// и state.json.
+func openJSONStorage(rsvpPath string) (st *storage, err error) {
+	dir := filepath.Dir(rsvpPath)
+	unlock, err := lockDataDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	// closers — уже открытые хранилища; если следующее не откроется, закрываем их и снимаем блокировку
+	closers := []func() error{unlock}
+	closeAll := func() error {
+		var err error
+		for i := len(closers) - 1; i >= 0; i-- {
+			if e := closers[i](); err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+	defer func() {
+		if err != nil {
+			closeAll()
+		}
+	}()
+	// Очередь открывается раньше ответов: при проигрывании журнала ответов в неё доставляются уведомления
+	outbox, err := openJSONOutboxStore(filepath.Join(dir, "outbox.json"))
+	if err != nil {
+		return nil, err
+	}
+	closers = append(closers, outbox.close)
+	rsvps, err := openJSONRSVPStore(rsvpPath, outbox)
+	if err != nil {
+		return nil, err
+	}
+	closers = append(closers, rsvps.close)
+	tgUsers, err := openJSONTgUserStore(filepath.Join(dir, "tg_users.json"))
+	if err != nil {
+		return nil, err
+	}
+	closers = append(closers, tgUsers.close)
+	reminders, err := openJSONReminderSentStore(filepath.Join(dir, "reminder_sent.json"))
+	if err != nil {
+		return nil, err
+	}
+	closers = append(closers, reminders.close)
+	invitations, err := openJSONInvitationStore(filepath.Join(dir, "invitations.json"))
+	if err != nil {
+		return nil, err
+	}
+	closers = append(closers, invitations.close)
+	admins, err := openJSONAdminUserStore(filepath.Join(dir, "admin_users.json"))
+	if err != nil {
+		return nil, err
+	}
+	closers = append(closers, admins.close)
+	audit, err := openJSONAuditStore(filepath.Join(dir, "audit.json"))
+	if err != nil {
+		return nil, err
+	}
+	closers = append(closers, audit.close)
+	state, err := openJSONStateStore(filepath.Join(dir, "state.json"))
+	if err != nil {
+		return nil, err
+	}
+	closers = append(closers, state.close)
+	return &storage{
+		rsvps:       rsvps,
+		tgUsers:     tgUsers,
+		reminders:   reminders,
+		invitations: invitations,
+		admins:      admins,
+		audit:       audit,
+		outbox:      outbox,
+		state:       state,
+		closeFn:     closeAll,
+	}, nil
+}
+
+// jsonRSVPStore держит список в памяти; изменения идут через журнал (см. journaledFile).
+// Ответ с уведомлениями — одна операция журнала "put_notify": уведомления из неё применение
+// передаёт в outbox, в том числе при проигрывании журнала после сбоя.
+type jsonRSVPStore struct {
+	mu      sync.Mutex
+	file    *journaledFile
+	entries []storedRSVP
+	// outbox — куда передавать уведомления; nil — только при переносе в SQLite без outbox.json
+	outbox *jsonOutboxStore
+}
+
+// rsvpWithMessages — данные операции "put_notify".
+type rsvpWithMessages struct {
+	Entry    storedRSVP      `json:"entry"`
+	Messages []outboxMessage `json:"messages"`
+}
+
+func openJSONRSVPStore(path string, outbox *jsonOutboxStore) (*jsonRSVPStore, error) {
+	s := &jsonRSVPStore{outbox: outbox}
+	f, err := openJournaledFile(path, &s.entries, s.apply)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	// Старые записи без id получают его при первом открытии
+	migrated := false
+	for i := range s.entries {
+		if s.entries[i].ID == "" {
+			s.entries[i].ID = newID()
+			migrated = true
+		}
+	}
+	if migrated {
+		if err := f.compact(s.entries); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *jsonRSVPStore) apply(op string, data json.RawMessage) error {
+	switch op {
+	case "put":
+		var e storedRSVP
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		s.putLocked(e)
+	case "put_notify":
+		var n rsvpWithMessages
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		// Сначала очередь: если она не сохранит уведомления, ответ тоже не сохранится (см. journaledFile.mutate)
+		if s.outbox != nil {
+			if err := s.outbox.relay(n.Messages); err != nil {
+				return err
+			}
+		}
+		s.putLocked(n.Entry)
+	case "delete":
+		var id string
+		if err := json.Unmarshal(data, &id); err != nil {
+			return err
+		}
+		for i := range s.entries {
+			if s.entries[i].ID == id {
+				s.entries = append(s.entries[:i:i], s.entries[i+1:]...)
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("неизвестная операция %q", op)
+	}
+	return nil
+}
+
+func (s *jsonRSVPStore) putLocked(e storedRSVP) {
+	if i := s.indexLocked(e.ID); i >= 0 {
+		s.entries[i] = e
+	} else {
+		s.entries = append(s.entries, e)
+	}
+}
+
+func (s *jsonRSVPStore) indexLocked(id string) int {
+	for i := range s.entries {
+		if s.entries[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *jsonRSVPStore) create(entry storedRSVP) (storedRSVP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry.ID == "" {
+		entry.ID = newID()
+	}
+	if err := s.file.mutate("put", entry, &s.entries); err != nil {
+		return storedRSVP{}, err
+	}
+	return entry, nil
+}
+
+func (s *jsonRSVPStore) createNotify(entry storedRSVP, messages []outboxMessage) (storedRSVP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry.ID == "" {
+		entry.ID = newID()
+	}
+	if err := s.file.mutate("put_notify", rsvpWithMessages{Entry: entry, Messages: messages}, &s.entries); err != nil {
+		return storedRSVP{}, err
+	}
+	return entry, nil
+}
+
+func (s *jsonRSVPStore) list() ([]storedRSVP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]storedRSVP(nil), s.entries...), nil
+}
+
+func (s *jsonRSVPStore) get(id string) (*storedRSVP, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.indexLocked(id); i >= 0 {
+		e := s.entries[i]
+		return &e, true, nil
+	}
+	return nil, false, nil
+}
+
+func (s *jsonRSVPStore) findByPhone(phone string) (*storedRSVP, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	phoneNorm := normalizePhone(phone)
+	for _, e := range s.entries {
+		if normalizePhone(e.Phone) == phoneNorm {
+			return &e, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (s *jsonRSVPStore) update(entry storedRSVP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexLocked(entry.ID) < 0 {
+		return errNotFound
+	}
+	return s.file.mutate("put", entry, &s.entries)
+}
+
+func (s *jsonRSVPStore) updateNotify(entry storedRSVP, messages []outboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexLocked(entry.ID) < 0 {
+		return errNotFound
+	}
+	return s.file.mutate("put_notify", rsvpWithMessages{Entry: entry, Messages: messages}, &s.entries)
+}
+
+func (s *jsonRSVPStore) delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexLocked(id) < 0 {
+		return errNotFound
+	}
+	return s.file.mutate("delete", id, &s.entries)
+}
+
+func (s *jsonRSVPStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.close(&s.entries)
+}
+
+type jsonTgUserStore struct {
+	mu    sync.Mutex
+	file  *journaledFile
+	users []tgUser
+}
+
+func openJSONTgUserStore(path string) (*jsonTgUserStore, error) {
+	s := &jsonTgUserStore{}
+	f, err := openJournaledFile(path, &s.users, s.apply)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+func (s *jsonTgUserStore) apply(op string, data json.RawMessage) error {
+	switch op {
+	case "save":
+		var user tgUser
+		if err := json.Unmarshal(data, &user); err != nil {
+			return err
+		}
+		s.saveLocked(user)
+	case "delete":
+		var chatID int64
+		if err := json.Unmarshal(data, &chatID); err != nil {
+			return err
+		}
+		for i := range s.users {
+			if s.users[i].ChatID == chatID {
+				s.users = append(s.users[:i:i], s.users[i+1:]...)
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("неизвестная операция %q", op)
+	}
+	return nil
+}
+
+// saveLocked обновляет запись с тем же chat_id или телефоном (на месте первой из них), иначе добавляет.
+func (s *jsonTgUserStore) saveLocked(user tgUser) {
+	phoneNorm := normalizePhone(user.Phone)
+	if phoneNorm == "" {
+		// Без телефона не затираем уже известный номер этого chat_id
+		for _, u := range s.users {
+			if u.ChatID == user.ChatID {
+				user.Phone = u.Phone
+				break
+			}
+		}
+	}
+	var next []tgUser
+	replaced := false
+	for _, u := range s.users {
+		if u.ChatID == user.ChatID || (phoneNorm != "" && normalizePhone(u.Phone) == phoneNorm) {
+			if !replaced {
+				next = append(next, user)
+				replaced = true
+			}
+			continue
+		}
+		next = append(next, u)
+	}
+	if !replaced {
+		next = append(next, user)
+	}
+	s.users = next
+}
+
+func (s *jsonTgUserStore) get(phone string) (*tgUser, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	phoneNorm := normalizePhone(phone)
+	if phoneNorm == "" {
+		return nil, false
+	}
+	for _, u := range s.users {
+		if normalizePhone(u.Phone) == phoneNorm {
+			return &u, true
+		}
+	}
+	return nil, false
+}
+
+func (s *jsonTgUserStore) getByChatID(chatID int64) (*tgUser, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.ChatID == chatID {
+			return &u, true
+		}
+	}
+	return nil, false
+}
+
+func (s *jsonTgUserStore) save(user tgUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.mutate("save", user, &s.users)
+}
+
+func (s *jsonTgUserStore) list() ([]tgUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]tgUser(nil), s.users...), nil
+}
+
+func (s *jsonTgUserStore) delete(chatID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.ChatID == chatID {
+			return s.file.mutate("delete", chatID, &s.users)
+		}
+	}
+	return errNotFound
+}
+
+func (s *jsonTgUserStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.close(&s.users)
+}
+
+type jsonReminderSentStore struct {
+	mu   sync.Mutex
+	file *journaledFile
+	keys []string
+}
+
+func openJSONReminderSentStore(path string) (*jsonReminderSentStore, error) {
+	s := &jsonReminderSentStore{}
+	f, err := openJournaledFile(path, &s.keys, s.apply)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+func (s *jsonReminderSentStore) apply(op string, data json.RawMessage) error {
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	switch op {
+	case "add":
+		seen := make(map[string]bool, len(s.keys))
+		for _, k := range s.keys {
+			seen[normalizeEmail(k)] = true
+		}
+		for _, k := range keys {
+			k = normalizeEmail(k)
+			if k != "" && !seen[k] {
+				seen[k] = true
+				s.keys = append(s.keys, k)
+			}
+		}
+	case "remove":
+		drop := make(map[string]bool, len(keys))
+		for _, k := range keys {
+			drop[normalizeEmail(k)] = true
+		}
+		var next []string
+		for _, k := range s.keys {
+			if !drop[normalizeEmail(k)] {
+				next = append(next, k)
+			}
+		}
+		s.keys = next
+	default:
+		return fmt.Errorf("неизвестная операция %q", op)
+	}
+	return nil
+}
+
+func (s *jsonReminderSentStore) list() (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]bool, len(s.keys))
+	for _, k := range s.keys {
+		out[normalizeEmail(k)] = true
+	}
+	return out, nil
+}
+
+func (s *jsonReminderSentStore) add(keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.mutate("add", keys, &s.keys)
+}
+
+func (s *jsonReminderSentStore) remove(keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.mutate("remove", keys, &s.keys)
+}
+
+func (s *jsonReminderSentStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.close(&s.keys)
+}
+
+type jsonInvitationStore struct {
+	mu      sync.Mutex
+	file    *journaledFile
+	entries []invitation
+}
+
+func openJSONInvitationStore(path string) (*jsonInvitationStore, error) {
+	s := &jsonInvitationStore{}
+	f, err := openJournaledFile(path, &s.entries, s.apply)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+func (s *jsonInvitationStore) apply(op string, data json.RawMessage) error {
+	switch op {
+	case "put":
+		var inv invitation
+		if err := json.Unmarshal(data, &inv); err != nil {
+			return err
+		}
+		if i := s.indexLocked(inv.ID); i >= 0 {
+			s.entries[i] = inv
+		} else {
+			s.entries = append(s.entries, inv)
+		}
+	case "delete":
+		var id string
+		if err := json.Unmarshal(data, &id); err != nil {
+			return err
+		}
+		if i := s.indexLocked(id); i >= 0 {
+			s.entries = append(s.entries[:i:i], s.entries[i+1:]...)
+		}
+	default:
+		return fmt.Errorf("неизвестная операция %q", op)
+	}
+	return nil
+}
+
+func (s *jsonInvitationStore) indexLocked(id string) int {
+	for i := range s.entries {
+		if s.entries[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// codeTakenLocked — код занят другим приглашением (не id).
+func (s *jsonInvitationStore) codeTakenLocked(code, id string) bool {
+	for _, inv := range s.entries {
+		if inv.Code == code && inv.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *jsonInvitationStore) create(inv invitation) (invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if inv.ID == "" {
+		inv.ID = newID()
+	}
+	if s.codeTakenLocked(inv.Code, inv.ID) {
+		return invitation{}, errCodeTaken
+	}
+	if err := s.file.mutate("put", inv, &s.entries); err != nil {
+		return invitation{}, err
+	}
+	return inv, nil
+}
+
+func (s *jsonInvitationStore) list() ([]invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]invitation(nil), s.entries...), nil
+}
+
+func (s *jsonInvitationStore) get(id string) (*invitation, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.indexLocked(id); i >= 0 {
+		inv := s.entries[i]
+		return &inv, true, nil
+	}
+	return nil, false, nil
+}
+
+func (s *jsonInvitationStore) getByCode(code string) (*invitation, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, inv := range s.entries {
+		if inv.Code == code {
+			return &inv, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (s *jsonInvitationStore) update(inv invitation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexLocked(inv.ID) < 0 {
+		return errNotFound
+	}
+	if s.codeTakenLocked(inv.Code, inv.ID) {
+		return errCodeTaken
+	}
+	return s.file.mutate("put", inv, &s.entries)
+}
+
+func (s *jsonInvitationStore) delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexLocked(id) < 0 {
+		return errNotFound
+	}
+	return s.file.mutate("delete", id, &s.entries)
+}
+
+func (s *jsonInvitationStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.close(&s.entries)
+}
+
+type jsonAdminUserStore struct {
+	mu    sync.Mutex
+	file  *journaledFile
+	users []adminUser
+}
+
+func openJSONAdminUserStore(path string) (*jsonAdminUserStore, error) {
+	s := &jsonAdminUserStore{}
+	f, err := openJournaledFile(path, &s.users, s.apply)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+func (s *jsonAdminUserStore) apply(op string, data json.RawMessage) error {
+	switch op {
+	case "put":
+		var u adminUser
+		if err := json.Unmarshal(data, &u); err != nil {
+			return err
+		}
+		if i := s.indexLocked(u.Login); i >= 0 {
+			s.users[i] = u
+		} else {
+			s.users = append(s.users, u)
+		}
+	case "delete":
+		var login string
+		if err := json.Unmarshal(data, &login); err != nil {
+			return err
+		}
+		if i := s.indexLocked(login); i >= 0 {
+			s.users = append(s.users[:i:i], s.users[i+1:]...)
+		}
+	default:
+		return fmt.Errorf("неизвестная операция %q", op)
+	}
+	return nil
+}
+
+func (s *jsonAdminUserStore) indexLocked(login string) int {
+	for i := range s.users {
+		if s.users[i].Login == login {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *jsonAdminUserStore) get(login string) (*adminUser, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.indexLocked(login); i >= 0 {
+		u := s.users[i]
+		return &u, true, nil
+	}
+	return nil, false, nil
+}
+
+func (s *jsonAdminUserStore) list() ([]adminUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]adminUser(nil), s.users...), nil
+}
+
+func (s *jsonAdminUserStore) save(u adminUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.mutate("put", u, &s.users)
+}
+
+func (s *jsonAdminUserStore) delete(login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexLocked(login) < 0 {
+		return errNotFound
+	}
+	return s.file.mutate("delete", login, &s.users)
+}
+
+func (s *jsonAdminUserStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.close(&s.users)
+}
+
+type jsonAuditStore struct {
+	mu      sync.Mutex
+	file    *journaledFile
+	entries []auditEntry
+}
+
+func openJSONAuditStore(path string) (*jsonAuditStore, error) {
+	s := &jsonAuditStore{}
+	f, err := openJournaledFile(path, &s.entries, s.apply)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+func (s *jsonAuditStore) apply(op string, data json.RawMessage) error {
+	if op != "append" {
+		return fmt.Errorf("неизвестная операция %q", op)
+	}
+	var e auditEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return err
+	}
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func (s *jsonAuditStore) append(e auditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.mutate("append", e, &s.entries)
+}
+
+func (s *jsonAuditStore) list() ([]auditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]auditEntry(nil), s.entries...), nil
+}
+
+func (s *jsonAuditStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.close(&s.entries)
+}
+
+type jsonOutboxStore struct {
+	mu       sync.Mutex
+	file     *journaledFile
+	messages []outboxMessage
+}
+
+func openJSONOutboxStore(path string) (*jsonOutboxStore, error) {
+	s := &jsonOutboxStore{}
+	f, err := openJournaledFile(path, &s.messages, s.apply)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+func (s *jsonOutboxStore) apply(op string, data json.RawMessage) error {
+	switch op {
+	case "put":
+		var m outboxMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		s.putLocked(m)
+	case "put_batch":
+		var list []outboxMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		for _, m := range list {
+			s.putLocked(m)
+		}
+	case "prune":
+		var before string
+		if err := json.Unmarshal(data, &before); err != nil {
+			return err
+		}
+		s.pruneLocked(before)
+	default:
+		return fmt.Errorf("неизвестная операция %q", op)
+	}
+	return nil
+}
+
+func (s *jsonOutboxStore) putLocked(m outboxMessage) {
+	if i := s.indexLocked(m.ID); i >= 0 {
+		s.messages[i] = m
+	} else {
+		s.messages = append(s.messages, m)
+	}
+}
+
+// pruneLocked удаляет отправленные и брошенные сообщения, поставленные раньше before (RFC3339 в UTC),
+// и возвращает, сколько удалено.
+func (s *jsonOutboxStore) pruneLocked(before string) int {
+	kept := make([]outboxMessage, 0, len(s.messages))
+	for _, m := range s.messages {
+		if (m.Status == outboxSent || m.Status == outboxDead) && m.CreatedAt < before {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	n := len(s.messages) - len(kept)
+	s.messages = kept
+	return n
+}
+
+func (s *jsonOutboxStore) indexLocked(id string) int {
+	for i := range s.messages {
+		if s.messages[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *jsonOutboxStore) enqueue(m outboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.mutate("put", m, &s.messages)
+}
+
+// relay добавляет уведомления из операции "put_notify" одной операцией журнала очереди. Уже известные
+// пропускаются: журнал ответов проигрывается при каждом открытии. Поставленные раньше outboxRetention
+// тоже: такие могли быть уже отправлены и удалены (см. prune), и второй раз их слать нельзя.
+func (s *jsonOutboxStore) relay(messages []outboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := time.Now().UTC().Add(-outboxRetention).Format(time.RFC3339)
+	var fresh []outboxMessage
+	for _, m := range messages {
+		if s.indexLocked(m.ID) < 0 && m.CreatedAt >= cutoff {
+			fresh = append(fresh, m)
+		}
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+	return s.file.mutate("put_batch", fresh, &s.messages)
+}
+
+func (s *jsonOutboxStore) prune(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := before.UTC().Format(time.RFC3339)
+	n := 0
+	for _, m := range s.messages {
+		if (m.Status == outboxSent || m.Status == outboxDead) && m.CreatedAt < cutoff {
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.file.mutate("prune", cutoff, &s.messages)
+}
+
+func (s *jsonOutboxStore) due(now time.Time, limit int) ([]outboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []outboxMessage
+	for _, m := range s.messages {
+		if len(out) >= limit {
+			break
+		}
+		if m.Status != outboxPending {
+			continue
+		}
+		if next, err := time.Parse(time.RFC3339, m.NextAttempt); err == nil && next.After(now) {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (s *jsonOutboxStore) get(id string) (*outboxMessage, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.indexLocked(id); i >= 0 {
+		m := s.messages[i]
+		return &m, true, nil
+	}
+	return nil, false, nil
+}
+
+func (s *jsonOutboxStore) update(m outboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.indexLocked(m.ID) < 0 {
+		return errNotFound
+	}
+	return s.file.mutate("put", m, &s.messages)
+}
+
+func (s *jsonOutboxStore) list() ([]outboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]outboxMessage(nil), s.messages...), nil
+}
+
+func (s *jsonOutboxStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.close(&s.messages)
+}
+
+type jsonStateStore struct {
+	mu     sync.Mutex
+	file   *journaledFile
+	values map[string]string
+}
+
+func openJSONStateStore(path string) (*jsonStateStore, error) {
+	s := &jsonStateStore{values: make(map[string]string)}
+	f, err := openJournaledFile(path, &s.values, s.apply)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+func (s *jsonStateStore) apply(op string, data json.RawMessage) error {
+	if op != "set" {
+		return fmt.Errorf("неизвестная операция %q", op)
+	}
+	var kv [2]string
+	if err := json.Unmarshal(data, &kv); err != nil {
+		return err
+	}
+	// снимок с null оставляет карту nil, а журнал проигрывается уже поверх него
+	if s.values == nil {
+		s.values = make(map[string]string)
+	}
+	s.values[kv[0]] = kv[1]
+	return nil
+}
+
+func (s *jsonStateStore) get(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	return v, ok, nil
+}
+
+// all — копия всех значений (для переноса в SQLite).
+func (s *jsonStateStore) all() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]string, len(s.values))
+	for k, v := range s.values {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *jsonStateStore) set(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.mutate("set", [2]string{key, value}, &s.values)
+}
+
+func (s *jsonStateStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.close(&s.values)
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockDataDir берёт эксклюзивную блокировку каталога данных JSON-хранилища (файл .lock), чтобы сервер и
+// команды import, admin, reminders не писали одни и те же журналы одновременно. Блокировка снимается
+// возвращённой функцией или при завершении процесса.
+func lockDataDir(dir string) (func() error, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, ".lock")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("данные в %s заняты другим процессом (запущен сервер?)", dir)
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f.Close, nil
+}
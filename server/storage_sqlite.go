@@ -0,0 +1,874 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS rsvps (
+	id         TEXT PRIMARY KEY,
+	phone_norm TEXT NOT NULL,
+	email      TEXT NOT NULL DEFAULT '',
+	at         TEXT NOT NULL DEFAULT '',
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS rsvps_phone_norm ON rsvps(phone_norm);
+CREATE INDEX IF NOT EXISTS rsvps_email ON rsvps(email);
+
+CREATE TABLE IF NOT EXISTS tg_users (
+	chat_id    INTEGER PRIMARY KEY,
+	phone      TEXT NOT NULL DEFAULT '',
+	phone_norm TEXT NOT NULL DEFAULT '',
+	name       TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS tg_users_phone_norm ON tg_users(phone_norm);
+
+CREATE TABLE IF NOT EXISTS reminder_sent (
+	key TEXT PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS invitations (
+	id         TEXT PRIMARY KEY,
+	code       TEXT NOT NULL UNIQUE,
+	phone_norm TEXT NOT NULL DEFAULT '',
+	data       TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS admin_users (
+	login TEXT PRIMARY KEY,
+	data  TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	seq     INTEGER PRIMARY KEY AUTOINCREMENT,
+	id      TEXT NOT NULL UNIQUE,
+	rsvp_id TEXT NOT NULL DEFAULT '',
+	data    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_log_rsvp_id ON audit_log(rsvp_id);
+
+CREATE TABLE IF NOT EXISTS outbox (
+	seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+	id           TEXT NOT NULL UNIQUE,
+	status       TEXT NOT NULL,
+	next_attempt TEXT NOT NULL,
+	data         TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS outbox_due ON outbox(status, next_attempt);
+
+CREATE TABLE IF NOT EXISTS state (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// openSQLiteStorage открывает (или создаёт) базу SQLite. Если база пустая, а рядом с legacyRSVPPath
+// лежат JSON-файлы прежнего формата, их содержимое переносится в базу.
+func openSQLiteStorage(dbPath, legacyRSVPPath string) (*storage, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite допускает одного писателя; один коннект избавляет от SQLITE_BUSY между своими же запросами
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlite schema: %w", err)
+	}
+	st := &storage{
+		rsvps:       &sqliteRSVPStore{db: db},
+		tgUsers:     &sqliteTgUserStore{db: db},
+		reminders:   &sqliteReminderSentStore{db: db},
+		invitations: &sqliteInvitationStore{db: db},
+		admins:      &sqliteAdminUserStore{db: db},
+		audit:       &sqliteAuditStore{db: db},
+		outbox:      &sqliteOutboxStore{db: db},
+		state:       &sqliteStateStore{db: db},
+		closeFn:     db.Close,
+	}
+	if err := importLegacyJSON(db, legacyRSVPPath); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// legacyJSONData — всё, что лежит в JSON-файлах рядом с rsvpPath (см. openJSONStorage).
+type legacyJSONData struct {
+	rsvps       []storedRSVP
+	users       []tgUser
+	sent        []string
+	invitations []invitation
+	admins      []adminUser
+	audit       []auditEntry
+	outbox      []outboxMessage
+	state       map[string]string
+}
+
+func (d legacyJSONData) empty() bool {
+	return len(d.rsvps)+len(d.users)+len(d.sent)+len(d.invitations)+len(d.admins)+len(d.audit)+len(d.outbox)+len(d.state) == 0
+}
+
+// readLegacyJSON читает JSON-хранилище path, если файл есть. Последние операции могут быть ещё не в снимке,
+// а в журнале, поэтому файл открывается тем же хранилищем, что и при STORAGE_DRIVER=json, — с проигрыванием журнала.
+func readLegacyJSON[S interface{ close() error }, T any](path string, open func(string) (S, error), read func(S) (T, error)) (T, error) {
+	var out T
+	if !legacyJSONExists(path) {
+		return out, nil
+	}
+	st, err := open(path)
+	if err != nil {
+		return out, fmt.Errorf("перенос %s: %w", path, err)
+	}
+	out, err = read(st)
+	st.close()
+	if err != nil {
+		return out, fmt.Errorf("перенос %s: %w", path, err)
+	}
+	return out, nil
+}
+
+// loadLegacyJSON читает все JSON-хранилища каталога rsvpPath.
+func loadLegacyJSON(rsvpPath string) (legacyJSONData, error) {
+	dir := filepath.Dir(rsvpPath)
+	var d legacyJSONData
+	var err error
+	// Очередь — раньше ответов: в журнале ответов могут быть уведомления, ещё не переданные в неё
+	var outbox *jsonOutboxStore
+	if path := filepath.Join(dir, "outbox.json"); legacyJSONExists(path) {
+		if outbox, err = openJSONOutboxStore(path); err != nil {
+			return d, fmt.Errorf("перенос %s: %w", path, err)
+		}
+		defer outbox.close()
+	}
+	if d.rsvps, err = readLegacyJSON(rsvpPath, func(p string) (*jsonRSVPStore, error) { return openJSONRSVPStore(p, outbox) },
+		(*jsonRSVPStore).list); err != nil {
+		return d, err
+	}
+	if outbox != nil {
+		if d.outbox, err = outbox.list(); err != nil {
+			return d, err
+		}
+	}
+	if d.users, err = readLegacyJSON(filepath.Join(dir, "tg_users.json"), openJSONTgUserStore, (*jsonTgUserStore).list); err != nil {
+		return d, err
+	}
+	marks, err := readLegacyJSON(filepath.Join(dir, "reminder_sent.json"), openJSONReminderSentStore, (*jsonReminderSentStore).list)
+	if err != nil {
+		return d, err
+	}
+	for k := range marks {
+		d.sent = append(d.sent, k)
+	}
+	sort.Strings(d.sent)
+	if d.invitations, err = readLegacyJSON(filepath.Join(dir, "invitations.json"), openJSONInvitationStore, (*jsonInvitationStore).list); err != nil {
+		return d, err
+	}
+	if d.admins, err = readLegacyJSON(filepath.Join(dir, "admin_users.json"), openJSONAdminUserStore, (*jsonAdminUserStore).list); err != nil {
+		return d, err
+	}
+	if d.audit, err = readLegacyJSON(filepath.Join(dir, "audit.json"), openJSONAuditStore, (*jsonAuditStore).list); err != nil {
+		return d, err
+	}
+	d.state, err = readLegacyJSON(filepath.Join(dir, "state.json"), openJSONStateStore, func(s *jsonStateStore) (map[string]string, error) {
+		return s.all(), nil
+	})
+	return d, err
+}
+
+// importLegacyJSON переносит JSON-данные (все хранилища из openJSONStorage) в пустую базу одной транзакцией:
+// если перенос оборвётся, база останется пустой и при следующем запуске он начнётся заново.
+func importLegacyJSON(db *sql.DB, rsvpPath string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var n int
+	if err := tx.QueryRow(`SELECT (SELECT COUNT(*) FROM rsvps) + (SELECT COUNT(*) FROM tg_users) + (SELECT COUNT(*) FROM reminder_sent) +
+		(SELECT COUNT(*) FROM invitations) + (SELECT COUNT(*) FROM admin_users) + (SELECT COUNT(*) FROM audit_log) +
+		(SELECT COUNT(*) FROM outbox) + (SELECT COUNT(*) FROM state)`).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	d, err := loadLegacyJSON(rsvpPath)
+	if err != nil {
+		return err
+	}
+	for _, r := range d.rsvps {
+		if _, err := insertRSVP(tx, r); err != nil {
+			return err
+		}
+	}
+	for _, u := range d.users {
+		if err := saveTgUser(tx, u); err != nil {
+			return err
+		}
+	}
+	if err := addReminderKeys(tx, d.sent); err != nil {
+		return err
+	}
+	for _, inv := range d.invitations {
+		if _, err := insertInvitation(tx, inv); err != nil {
+			return fmt.Errorf("перенос приглашения %s: %w", inv.Code, err)
+		}
+	}
+	for _, u := range d.admins {
+		if err := saveAdminUser(tx, u); err != nil {
+			return err
+		}
+	}
+	for _, e := range d.audit {
+		if err := appendAudit(tx, e); err != nil {
+			return err
+		}
+	}
+	if err := insertOutbox(tx, d.outbox...); err != nil {
+		return err
+	}
+	for k, v := range d.state {
+		if err := setState(tx, k, v); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if !d.empty() {
+		log.Printf("sqlite: перенесено из JSON — ответов %d, пользователей TG %d, напоминаний %d, приглашений %d, учётных записей %d, записей журнала %d, сообщений в очереди %d",
+			len(d.rsvps), len(d.users), len(d.sent), len(d.invitations), len(d.admins), len(d.audit), len(d.outbox))
+	}
+	return nil
+}
+
+// legacyJSONExists — есть ли что переносить: снимок или журнал. Без них JSON-хранилище не открывается,
+// чтобы не создавать рядом с базой пустые файлы.
+func legacyJSONExists(path string) bool {
+	for _, p := range []string{path, path + ".journal"} {
+		if info, err := os.Stat(p); err == nil && info.Size() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sqliteExecer — *sql.DB или *sql.Tx: вставки общие для хранилищ, их транзакций и переноса из JSON.
+type sqliteExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+type sqliteRSVPStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteRSVPStore) create(entry storedRSVP) (storedRSVP, error) {
+	return insertRSVP(s.db, entry)
+}
+
+func (s *sqliteRSVPStore) createNotify(entry storedRSVP, messages []outboxMessage) (storedRSVP, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return storedRSVP{}, err
+	}
+	defer tx.Rollback()
+	entry, err = insertRSVP(tx, entry)
+	if err != nil {
+		return storedRSVP{}, err
+	}
+	if err := insertOutbox(tx, messages...); err != nil {
+		return storedRSVP{}, err
+	}
+	return entry, tx.Commit()
+}
+
+func insertRSVP(ex sqliteExecer, entry storedRSVP) (storedRSVP, error) {
+	if entry.ID == "" {
+		entry.ID = newID()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return storedRSVP{}, err
+	}
+	_, err = ex.Exec(`INSERT INTO rsvps (id, phone_norm, email, at, data) VALUES (?, ?, ?, ?, ?)`,
+		entry.ID, normalizePhone(entry.Phone), normalizeEmail(entry.Email), entry.At, string(data))
+	if err != nil {
+		return storedRSVP{}, err
+	}
+	return entry, nil
+}
+
+func (s *sqliteRSVPStore) list() ([]storedRSVP, error) {
+	rows, err := s.db.Query(`SELECT data FROM rsvps ORDER BY at, rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []storedRSVP
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var e storedRSVP
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteRSVPStore) queryOne(query string, args ...interface{}) (*storedRSVP, bool, error) {
+	var data string
+	err := s.db.QueryRow(query, args...).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var e storedRSVP
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		return nil, false, err
+	}
+	return &e, true, nil
+}
+
+func (s *sqliteRSVPStore) get(id string) (*storedRSVP, bool, error) {
+	return s.queryOne(`SELECT data FROM rsvps WHERE id = ?`, id)
+}
+
+func (s *sqliteRSVPStore) findByPhone(phone string) (*storedRSVP, bool, error) {
+	return s.queryOne(`SELECT data FROM rsvps WHERE phone_norm = ? ORDER BY rowid LIMIT 1`, normalizePhone(phone))
+}
+
+func (s *sqliteRSVPStore) update(entry storedRSVP) error {
+	return updateRSVP(s.db, entry)
+}
+
+func updateRSVP(ex sqliteExecer, entry storedRSVP) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	res, err := ex.Exec(`UPDATE rsvps SET phone_norm = ?, email = ?, at = ?, data = ? WHERE id = ?`,
+		normalizePhone(entry.Phone), normalizeEmail(entry.Email), entry.At, string(data), entry.ID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (s *sqliteRSVPStore) updateNotify(entry storedRSVP, messages []outboxMessage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := updateRSVP(tx, entry); err != nil {
+		return err
+	}
+	if err := insertOutbox(tx, messages...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteRSVPStore) delete(id string) error {
+	res, err := s.db.Exec(`DELETE FROM rsvps WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+type sqliteTgUserStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteTgUserStore) scanOne(query string, args ...interface{}) (*tgUser, bool) {
+	var u tgUser
+	err := s.db.QueryRow(query, args...).Scan(&u.ChatID, &u.Phone, &u.Name)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("sqlite tg_users: %v", err)
+		}
+		return nil, false
+	}
+	return &u, true
+}
+
+func (s *sqliteTgUserStore) get(phone string) (*tgUser, bool) {
+	phoneNorm := normalizePhone(phone)
+	if phoneNorm == "" {
+		return nil, false
+	}
+	return s.scanOne(`SELECT chat_id, phone, name FROM tg_users WHERE phone_norm = ? LIMIT 1`, phoneNorm)
+}
+
+func (s *sqliteTgUserStore) getByChatID(chatID int64) (*tgUser, bool) {
+	return s.scanOne(`SELECT chat_id, phone, name FROM tg_users WHERE chat_id = ?`, chatID)
+}
+
+func (s *sqliteTgUserStore) save(user tgUser) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := saveTgUser(tx, user); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveTgUser(ex sqliteExecer, user tgUser) error {
+	phoneNorm := normalizePhone(user.Phone)
+	// Тот же телефон под другим chat_id — заменяем старую запись (как в JSON-хранилище)
+	if phoneNorm != "" {
+		if _, err := ex.Exec(`DELETE FROM tg_users WHERE phone_norm = ? AND chat_id <> ?`, phoneNorm, user.ChatID); err != nil {
+			return err
+		}
+	}
+	_, err := ex.Exec(`INSERT INTO tg_users (chat_id, phone, phone_norm, name) VALUES (?, ?, ?, ?)
+		ON CONFLICT(chat_id) DO UPDATE SET
+			phone = CASE WHEN excluded.phone_norm <> '' THEN excluded.phone ELSE tg_users.phone END,
+			phone_norm = CASE WHEN excluded.phone_norm <> '' THEN excluded.phone_norm ELSE tg_users.phone_norm END,
+			name = excluded.name`,
+		user.ChatID, user.Phone, phoneNorm, user.Name)
+	return err
+}
+
+func (s *sqliteTgUserStore) list() ([]tgUser, error) {
+	rows, err := s.db.Query(`SELECT chat_id, phone, name FROM tg_users ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []tgUser
+	for rows.Next() {
+		var u tgUser
+		if err := rows.Scan(&u.ChatID, &u.Phone, &u.Name); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteTgUserStore) delete(chatID int64) error {
+	res, err := s.db.Exec(`DELETE FROM tg_users WHERE chat_id = ?`, chatID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+type sqliteReminderSentStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteReminderSentStore) list() (map[string]bool, error) {
+	rows, err := s.db.Query(`SELECT key FROM reminder_sent`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]bool)
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		out[k] = true
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteReminderSentStore) add(keys []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := addReminderKeys(tx, keys); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func addReminderKeys(ex sqliteExecer, keys []string) error {
+	for _, k := range keys {
+		k = normalizeEmail(k)
+		if k == "" {
+			continue
+		}
+		if _, err := ex.Exec(`INSERT OR IGNORE INTO reminder_sent (key) VALUES (?)`, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteReminderSentStore) remove(keys []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, k := range keys {
+		if _, err := tx.Exec(`DELETE FROM reminder_sent WHERE key = ?`, normalizeEmail(k)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type sqliteInvitationStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteInvitationStore) create(inv invitation) (invitation, error) {
+	return insertInvitation(s.db, inv)
+}
+
+func insertInvitation(ex sqliteExecer, inv invitation) (invitation, error) {
+	if inv.ID == "" {
+		inv.ID = newID()
+	}
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return invitation{}, err
+	}
+	_, err = ex.Exec(`INSERT INTO invitations (id, code, phone_norm, data) VALUES (?, ?, ?, ?)`,
+		inv.ID, inv.Code, normalizePhone(inv.Phone), string(data))
+	if isUniqueViolation(err) {
+		return invitation{}, errCodeTaken
+	}
+	if err != nil {
+		return invitation{}, err
+	}
+	return inv, nil
+}
+
+func (s *sqliteInvitationStore) list() ([]invitation, error) {
+	rows, err := s.db.Query(`SELECT data FROM invitations ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []invitation
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var inv invitation
+		if err := json.Unmarshal([]byte(data), &inv); err != nil {
+			return nil, err
+		}
+		out = append(out, inv)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteInvitationStore) queryOne(query string, args ...interface{}) (*invitation, bool, error) {
+	var data string
+	err := s.db.QueryRow(query, args...).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var inv invitation
+	if err := json.Unmarshal([]byte(data), &inv); err != nil {
+		return nil, false, err
+	}
+	return &inv, true, nil
+}
+
+func (s *sqliteInvitationStore) get(id string) (*invitation, bool, error) {
+	return s.queryOne(`SELECT data FROM invitations WHERE id = ?`, id)
+}
+
+func (s *sqliteInvitationStore) getByCode(code string) (*invitation, bool, error) {
+	return s.queryOne(`SELECT data FROM invitations WHERE code = ?`, code)
+}
+
+func (s *sqliteInvitationStore) update(inv invitation) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(`UPDATE invitations SET code = ?, phone_norm = ?, data = ? WHERE id = ?`,
+		inv.Code, normalizePhone(inv.Phone), string(data), inv.ID)
+	if isUniqueViolation(err) {
+		return errCodeTaken
+	}
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (s *sqliteInvitationStore) delete(id string) error {
+	res, err := s.db.Exec(`DELETE FROM invitations WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+type sqliteAdminUserStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteAdminUserStore) get(login string) (*adminUser, bool, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM admin_users WHERE login = ?`, login).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var u adminUser
+	if err := json.Unmarshal([]byte(data), &u); err != nil {
+		return nil, false, err
+	}
+	return &u, true, nil
+}
+
+func (s *sqliteAdminUserStore) list() ([]adminUser, error) {
+	rows, err := s.db.Query(`SELECT data FROM admin_users ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []adminUser
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var u adminUser
+		if err := json.Unmarshal([]byte(data), &u); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteAdminUserStore) save(u adminUser) error {
+	return saveAdminUser(s.db, u)
+}
+
+func saveAdminUser(ex sqliteExecer, u adminUser) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = ex.Exec(`INSERT INTO admin_users (login, data) VALUES (?, ?) ON CONFLICT(login) DO UPDATE SET data = excluded.data`, u.Login, string(data))
+	return err
+}
+
+func (s *sqliteAdminUserStore) delete(login string) error {
+	res, err := s.db.Exec(`DELETE FROM admin_users WHERE login = ?`, login)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+type sqliteAuditStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteAuditStore) append(e auditEntry) error {
+	return appendAudit(s.db, e)
+}
+
+func appendAudit(ex sqliteExecer, e auditEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = ex.Exec(`INSERT INTO audit_log (id, rsvp_id, data) VALUES (?, ?, ?)`, e.ID, e.RSVPID, string(data))
+	return err
+}
+
+func (s *sqliteAuditStore) list() ([]auditEntry, error) {
+	rows, err := s.db.Query(`SELECT data FROM audit_log ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []auditEntry
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var e auditEntry
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+type sqliteOutboxStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteOutboxStore) enqueue(m outboxMessage) error {
+	return insertOutbox(s.db, m)
+}
+
+func insertOutbox(ex sqliteExecer, messages ...outboxMessage) error {
+	for _, m := range messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if _, err := ex.Exec(`INSERT INTO outbox (id, status, next_attempt, data) VALUES (?, ?, ?, ?)`, m.ID, m.Status, m.NextAttempt, string(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteOutboxStore) query(query string, args ...interface{}) ([]outboxMessage, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []outboxMessage
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var m outboxMessage
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// due сравнивает next_attempt строками: время всегда в UTC и в одном формате RFC3339.
+func (s *sqliteOutboxStore) due(now time.Time, limit int) ([]outboxMessage, error) {
+	return s.query(`SELECT data FROM outbox WHERE status = ? AND next_attempt <= ? ORDER BY seq LIMIT ?`,
+		outboxPending, now.UTC().Format(time.RFC3339), limit)
+}
+
+func (s *sqliteOutboxStore) get(id string) (*outboxMessage, bool, error) {
+	list, err := s.query(`SELECT data FROM outbox WHERE id = ?`, id)
+	if err != nil || len(list) == 0 {
+		return nil, false, err
+	}
+	return &list[0], true, nil
+}
+
+func (s *sqliteOutboxStore) update(m outboxMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(`UPDATE outbox SET status = ?, next_attempt = ?, data = ? WHERE id = ?`, m.Status, m.NextAttempt, string(data), m.ID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (s *sqliteOutboxStore) list() ([]outboxMessage, error) {
+	return s.query(`SELECT data FROM outbox ORDER BY seq`)
+}
+
+// prune сравнивает created_at в Go: время постановки хранится только в data.
+func (s *sqliteOutboxStore) prune(before time.Time) (int, error) {
+	done, err := s.query(`SELECT data FROM outbox WHERE status IN (?, ?)`, outboxSent, outboxDead)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := before.UTC().Format(time.RFC3339)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	n := 0
+	for _, m := range done {
+		if m.CreatedAt >= cutoff {
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM outbox WHERE id = ?`, m.ID); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
+
+type sqliteStateStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteStateStore) get(key string) (string, bool, error) {
+	var v string
+	err := s.db.QueryRow(`SELECT value FROM state WHERE key = ?`, key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+func (s *sqliteStateStore) set(key, value string) error {
+	return setState(s.db, key, value)
+}
+
+func setState(ex sqliteExecer, key, value string) error {
+	_, err := ex.Exec(`INSERT INTO state (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	var se sqlite3.Error
+	return errors.As(err, &se) && se.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotFound
+	}
+	return nil
+}
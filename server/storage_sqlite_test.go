@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestImportLegacyJSON(t *testing.T) {
+	dir := t.TempDir()
+	rsvpPath := filepath.Join(dir, "rsvps.json")
+	js, err := openJSONStorage(rsvpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := pendingMessage("m1", outboxMessage{Kind: outboxEmail, RSVPID: "r1", To: "anna@example.com"})
+	js.rsvps.createNotify(storedRSVP{ID: "r1", Name: "Анна", Phone: "+7 999 000-00-01"}, []outboxMessage{msg})
+	js.tgUsers.save(tgUser{ChatID: 100, Phone: "+7 999 000-00-01"})
+	js.reminders.add([]string{"7d:r1:email"})
+	js.invitations.create(invitation{ID: "i1", Code: "ABCD2345", Name: "Семья Ивановых"})
+	js.admins.save(adminUser{Login: "boss", Role: roleOwner, PasswordHash: "hash"})
+	js.audit.append(auditEntry{ID: "a1", Action: auditCreate, RSVPID: "r1"})
+	js.state.set(stateKeyTgOffset, "42")
+	if err := js.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := openSQLiteStorage(filepath.Join(dir, "wedding.db"), rsvpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.close()
+	if _, found, _ := st.rsvps.get("r1"); !found {
+		t.Error("rsvp is not imported")
+	}
+	if _, found := st.tgUsers.getByChatID(100); !found {
+		t.Error("telegram user is not imported")
+	}
+	if sent, _ := st.reminders.list(); !sent["7d:r1:email"] {
+		t.Error("reminder mark is not imported")
+	}
+	if _, found, _ := st.invitations.getByCode("ABCD2345"); !found {
+		t.Error("invitation is not imported")
+	}
+	if _, found, _ := st.admins.get("boss"); !found {
+		t.Error("admin user is not imported")
+	}
+	if list, _ := st.audit.list(); len(list) != 1 || list[0].ID != "a1" {
+		t.Errorf("audit = %+v", list)
+	}
+	if m, found, _ := st.outbox.get("m1"); !found || m.Status != outboxPending {
+		t.Errorf("outbox message = %+v, %v", m, found)
+	}
+	if v, _, _ := st.state.get(stateKeyTgOffset); v != "42" {
+		t.Errorf("telegram offset = %q", v)
+	}
+}
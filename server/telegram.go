@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type tgUser struct {
+	ChatID int64  `json:"chat_id"`
+	Phone  string `json:"phone"` // нормализованный (только цифры)
+	Name   string `json:"name"`
+}
+
+// tgSendInterval — пауза между сообщениями из очереди: Telegram пускает не больше ~30 сообщений бота
+// в секунду, а при превышении отвечает 429 с retry_after.
+const tgSendInterval = 40 * time.Millisecond
+
+// Telegram client
+type tgClient struct {
+	token      string
+	apiURL     string
+	httpClient *http.Client
+}
+
+func newTelegramClient(token string) *tgClient {
+	return &tgClient{
+		token:      token,
+		apiURL:     "https://api.telegram.org/bot" + token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// call вызывает метод Bot API и раскладывает поле result в out (если out != nil).
+func (t *tgClient) call(method string, payload interface{}, out interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := t.httpClient.Post(t.apiURL+"/"+method, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		Description string          `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("telegram %s: HTTP %d: %v", method, resp.StatusCode, err)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("telegram %s: %s", method, envelope.Description)
+	}
+	if out != nil {
+		return json.Unmarshal(envelope.Result, out)
+	}
+	return nil
+}
+
+type tgWebhookInfo struct {
+	URL                string   `json:"url"`
+	PendingUpdateCount int      `json:"pending_update_count"`
+	LastErrorDate      int64    `json:"last_error_date"`
+	LastErrorMessage   string   `json:"last_error_message"`
+	AllowedUpdates     []string `json:"allowed_updates"`
+}
+
+func (t *tgClient) setWebhook(url, secretToken string, allowedUpdates []string) error {
+	payload := map[string]interface{}{
+		"url":             url,
+		"allowed_updates": allowedUpdates,
+	}
+	if secretToken != "" {
+		payload["secret_token"] = secretToken
+	}
+	return t.call("setWebhook", payload, nil)
+}
+
+func (t *tgClient) deleteWebhook() error {
+	return t.call("deleteWebhook", map[string]interface{}{}, nil)
+}
+
+// getUpdates — один запрос long polling; возвращается по приходу обновлений, по таймауту или при отмене ctx.
+func (t *tgClient) getUpdates(ctx context.Context, offset int64, timeout time.Duration, allowedUpdates []string) ([]tgUpdate, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": allowedUpdates,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout+15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.apiURL+"/getUpdates", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Общий httpClient с коротким таймаутом здесь не подходит — ограничиваемся контекстом
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var envelope struct {
+		OK          bool       `json:"ok"`
+		Result      []tgUpdate `json:"result"`
+		Description string     `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("telegram getUpdates: HTTP %d: %v", resp.StatusCode, err)
+	}
+	if !envelope.OK {
+		return nil, fmt.Errorf("telegram getUpdates: %s", envelope.Description)
+	}
+	return envelope.Result, nil
+}
+
+func (t *tgClient) getWebhookInfo() (*tgWebhookInfo, error) {
+	var info tgWebhookInfo
+	if err := t.call("getWebhookInfo", map[string]interface{}{}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// registerWebhook при старте сверяет вебхук бота с настройками: если задан url — регистрирует его
+// (вместе с secret_token и allowed_updates), затем читает getWebhookInfo и пишет в лог расхождения.
+func registerWebhook(tg *tgClient, url, secretToken string, allowedUpdates []string) {
+	if url != "" {
+		if err := tg.setWebhook(url, secretToken, allowedUpdates); err != nil {
+			log.Printf("TG setWebhook: %v", err)
+		} else {
+			log.Printf("TG: вебхук зарегистрирован: %s", url)
+		}
+	}
+	info, err := tg.getWebhookInfo()
+	if err != nil {
+		log.Printf("TG getWebhookInfo: %v", err)
+		return
+	}
+	if url == "" {
+		if info.URL == "" {
+			log.Printf("TG: вебхук не зарегистрирован, а TELEGRAM_WEBHOOK_URL не задан — обновления не будут приходить")
+		} else {
+			log.Printf("TG: зарегистрирован вебхук %s (TELEGRAM_WEBHOOK_URL не задан, не трогаем)", info.URL)
+		}
+		return
+	}
+	if info.URL != url {
+		log.Printf("TG: расхождение вебхука: зарегистрирован %q, ожидается %q", info.URL, url)
+	}
+	// Пустой allowed_updates у Telegram означает «все, кроме некоторых» — сравниваем только явные списки
+	if len(info.AllowedUpdates) > 0 && !sameStringSet(info.AllowedUpdates, allowedUpdates) {
+		log.Printf("TG: расхождение allowed_updates: зарегистрировано %v, ожидается %v", info.AllowedUpdates, allowedUpdates)
+	}
+	if info.LastErrorMessage != "" {
+		log.Printf("TG: последняя ошибка доставки вебхука (%s): %s",
+			time.Unix(info.LastErrorDate, 0).Format(time.RFC3339), info.LastErrorMessage)
+	}
+	if info.PendingUpdateCount > 0 {
+		log.Printf("TG: в очереди вебхука %d обновлений", info.PendingUpdateCount)
+	}
+}
+
+// validWebhookSecret — ограничения Telegram на secret_token.
+func validWebhookSecret(s string) bool {
+	if len(s) == 0 || len(s) > 256 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func sameStringSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string(nil), a...)
+	y := append([]string(nil), b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	return strings.Join(x, ",") == strings.Join(y, ",")
+}
+
+// tgRetryAfterError — Telegram ответил 429: повторить не раньше чем через after.
+type tgRetryAfterError struct {
+	after time.Duration
+	body  string
+}
+
+func (e *tgRetryAfterError) Error() string {
+	return "telegram API error: " + e.body
+}
+
+// postMessage вызывает sendMessage. Ответы бота уходят сразу; темп рассылки держит tgPacer в очереди.
+func (t *tgClient) postMessage(payload map[string]interface{}) error {
+	data, _ := json.Marshal(payload)
+	resp, err := t.httpClient.Post(t.apiURL+"/sendMessage", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		var tooMany struct {
+			Parameters struct {
+				RetryAfter int `json:"retry_after"`
+			} `json:"parameters"`
+		}
+		if json.Unmarshal(body, &tooMany) == nil && tooMany.Parameters.RetryAfter > 0 {
+			return &tgRetryAfterError{after: time.Duration(tooMany.Parameters.RetryAfter) * time.Second, body: string(body)}
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("telegram API error: %s", string(body))
+	}
+	return nil
+}
+
+// tgPacer — темп отправки сообщений в Telegram из очереди (уведомления, напоминания, рассылки), чтобы
+// рассылка не упёрлась в лимиты. Ответы бота в диалоге через него не идут и не ждут рассылку.
+type tgPacer struct {
+	mu sync.Mutex
+	// next — не раньше какого момента можно отправить следующее сообщение
+	next time.Time
+}
+
+// wait ждёт своей очереди на отправку или отмены ctx.
+func (p *tgPacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	at := p.next
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(tgSendInterval)
+	p.mu.Unlock()
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pause откладывает следующие отправки на d (после 429 с retry_after).
+func (p *tgPacer) pause(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if until := time.Now().Add(d); until.After(p.next) {
+		p.next = until
+	}
+	log.Printf("TG: лимит сообщений, пауза %s", d)
+}
+
+func (t *tgClient) sendMessage(chatID int64, text, parseMode string) error {
+	payload := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	if parseMode != "" {
+		payload["parse_mode"] = parseMode
+	}
+	return t.postMessage(payload)
+}
+
+func (t *tgClient) sendWebApp(chatID int64, text, url, buttonText string) error {
+	// Keyboard с Web App кнопкой
+	keyboard := map[string]interface{}{
+		"inline_keyboard": [][]map[string]interface{}{
+			{
+				{
+					"text": buttonText,
+					"web_app": map[string]string{
+						"url": url,
+					},
+				},
+			},
+		},
+	}
+
+	payload := map[string]interface{}{
+		"chat_id":      chatID,
+		"text":         text,
+		"parse_mode":   "Markdown",
+		"reply_markup": keyboard,
+	}
+
+	return t.postMessage(payload)
+}
+
+func (t *tgClient) sendMessageWithCancel(chatID int64, text, cancelText string) error {
+	// Keyboard с кнопкой отмены
+	keyboard := map[string]interface{}{
+		"inline_keyboard": [][]map[string]interface{}{
+			{
+				{
+					"text":          cancelText,
+					"callback_data": "cancel_rsvp",
+				},
+			},
+		},
+	}
+
+	payload := map[string]interface{}{
+		"chat_id":      chatID,
+		"text":         text,
+		"parse_mode":   "Markdown",
+		"reply_markup": keyboard,
+	}
+
+	return t.postMessage(payload)
+}
+
+// answerCallback отвечает на callback query
+func answerCallback(tg *tgClient, callbackID string) {
+	apiURL := tg.apiURL + "/answerCallbackQuery"
+	payload := map[string]interface{}{
+		"callback_query_id": callbackID,
+	}
+	data, _ := json.Marshal(payload)
+	_, _ = http.Post(apiURL, "application/json", bytes.NewReader(data))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errInitDataInvalid = errors.New("telegram init data: invalid signature")
+	errInitDataStale   = errors.New("telegram init data: auth_date too old")
+)
+
+// tgInitData — проверенные поля initData из Telegram Web App.
+type tgInitData struct {
+	User struct {
+		ID        int64  `json:"id"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Username  string `json:"username"`
+	}
+	AuthDate time.Time
+}
+
+// displayName — @username, иначе имя, как и в остальных местах бота.
+func (d *tgInitData) displayName() string {
+	if d.User.Username != "" {
+		return "@" + d.User.Username
+	}
+	name := strings.TrimSpace(d.User.FirstName + " " + d.User.LastName)
+	if name == "" {
+		name = "Telegram User"
+	}
+	return name
+}
+
+// verifyTelegramInitData проверяет подпись initData по алгоритму Telegram:
+// secret = HMAC_SHA256("WebAppData", bot_token), hash = hex(HMAC_SHA256(secret, data_check_string)),
+// где data_check_string — отсортированные пары key=value (кроме hash), разделённые \n.
+func verifyTelegramInitData(botToken, initData string, maxAge time.Duration) (*tgInitData, error) {
+	vals, err := url.ParseQuery(initData)
+	if err != nil {
+		return nil, errInitDataInvalid
+	}
+	hash := vals.Get("hash")
+	if hash == "" {
+		return nil, errInitDataInvalid
+	}
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		if k != "hash" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+vals.Get(k))
+	}
+
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+	m := hmac.New(sha256.New, secret.Sum(nil))
+	m.Write([]byte(strings.Join(pairs, "\n")))
+	got, err := hex.DecodeString(hash)
+	if err != nil || !hmac.Equal(got, m.Sum(nil)) {
+		return nil, errInitDataInvalid
+	}
+
+	authUnix, err := strconv.ParseInt(vals.Get("auth_date"), 10, 64)
+	if err != nil {
+		return nil, errInitDataInvalid
+	}
+	out := &tgInitData{AuthDate: time.Unix(authUnix, 0)}
+	age := time.Since(out.AuthDate)
+	// Небольшой запас на расхождение часов в обе стороны
+	if age > maxAge || age < -time.Minute {
+		return nil, errInitDataStale
+	}
+	if err := json.Unmarshal([]byte(vals.Get("user")), &out.User); err != nil || out.User.ID == 0 {
+		return nil, errInitDataInvalid
+	}
+	return out, nil
+}
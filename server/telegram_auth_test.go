@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signInitData собирает initData так же, как Telegram: пары без hash, отсортированные, через \n.
+func signInitData(botToken string, vals url.Values) string {
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+vals.Get(k))
+	}
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+	m := hmac.New(sha256.New, secret.Sum(nil))
+	m.Write([]byte(strings.Join(pairs, "\n")))
+	out := url.Values{}
+	for k := range vals {
+		out.Set(k, vals.Get(k))
+	}
+	out.Set("hash", hex.EncodeToString(m.Sum(nil)))
+	return out.Encode()
+}
+
+func TestVerifyTelegramInitData(t *testing.T) {
+	const token = "123:bot-token"
+	fields := func(authDate time.Time, user string) url.Values {
+		return url.Values{
+			"auth_date": {strconv.FormatInt(authDate.Unix(), 10)},
+			"query_id":  {"AAE"},
+			"user":      {user},
+		}
+	}
+	now := time.Now()
+	user := `{"id":777,"first_name":"Анна","username":"anna"}`
+	valid := signInitData(token, fields(now, user))
+	tampered := strings.Replace(valid, "query_id=AAE", "query_id=AAF", 1)
+
+	tests := []struct {
+		name     string
+		initData string
+		wantErr  error
+	}{
+		{"valid", valid, nil},
+		{"other bot token", signInitData("456:other", fields(now, user)), errInitDataInvalid},
+		{"field changed after signing", tampered, errInitDataInvalid},
+		{"hash missing", fields(now, user).Encode(), errInitDataInvalid},
+		{"hash not hex", fields(now, user).Encode() + "&hash=zz", errInitDataInvalid},
+		{"stale auth_date", signInitData(token, fields(now.Add(-2*time.Hour), user)), errInitDataStale},
+		{"auth_date in the future", signInitData(token, fields(now.Add(10*time.Minute), user)), errInitDataStale},
+		{"small clock skew", signInitData(token, fields(now.Add(30*time.Second), user)), nil},
+		{"no user id", signInitData(token, fields(now, `{"first_name":"Анна"}`)), errInitDataInvalid},
+		{"garbage", "%zz", errInitDataInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyTelegramInitData(token, tt.initData, time.Hour)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (got.User.ID != 777 || got.displayName() != "@anna") {
+				t.Fatalf("user = %+v", got.User)
+			}
+		})
+	}
+}
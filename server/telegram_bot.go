@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tgUpdate — нужные нам поля Update из Bot API.
+type tgUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID   int64  `json:"id"`
+			Type string `json:"type"`
+		} `json:"chat"`
+		From *struct {
+			ID        int64  `json:"id"`
+			FirstName string `json:"first_name"`
+			Username  string `json:"username"`
+		} `json:"from"`
+		Text string `json:"text"`
+	} `json:"message"`
+	CallbackQuery *struct {
+		ID   string `json:"id"`
+		From *struct {
+			ID int64 `json:"id"`
+		} `json:"from"`
+		Data string `json:"data"`
+	} `json:"callback_query"`
+}
+
+// tgBot — обработка входящих обновлений; одна и та же для вебхука и long polling.
+type tgBot struct {
+	tg      *tgClient
+	users   tgUserStore
+	rsvps   rsvpStore
+	audit   auditStore
+	siteURL string
+}
+
+func (b *tgBot) handleUpdate(update tgUpdate) {
+	tg := b.tg
+
+	// Обработка callback query (кнопки)
+	if update.CallbackQuery != nil {
+		if update.CallbackQuery.From == nil {
+			return
+		}
+		chatID := update.CallbackQuery.From.ID
+		data := update.CallbackQuery.Data
+
+		if data == "cancel_rsvp" {
+			// Отмечаем RSVP пользователя как «не придёт»
+			cancelled, err := cancelRSVPByChatID(b.rsvps, b.audit, chatID)
+			if err != nil {
+				log.Printf("TG: отмена chat_id=%d: %v", chatID, err)
+			}
+
+			// Отвечаем на callback
+			answerCallback(tg, update.CallbackQuery.ID)
+
+			// Отправляем подтверждение отмены
+			if cancelled > 0 || err != nil {
+				_ = tg.sendMessage(chatID, "✅ Отменено.\n\nЕсли передумаете — заполните форму снова, мы будем рады! 💕", "")
+			} else {
+				_ = tg.sendMessage(chatID, "Не нашли ответа, отправленного из этого чата. Отменить ответ можно по ссылке из письма.", "")
+			}
+		}
+		return
+	}
+
+	if update.Message == nil {
+		return
+	}
+
+	chatID := update.Message.Chat.ID
+	userName := ""
+	if update.Message.From != nil {
+		if update.Message.From.Username != "" {
+			userName = "@" + update.Message.From.Username
+		} else {
+			userName = update.Message.From.FirstName
+		}
+	}
+
+	text := update.Message.Text
+
+	// Обработка /start
+	if text == "/start" {
+		// URL для Web App — всегда сайт, а не карта
+		reply := "🎉 *Привет!*\n\nМы очень рады, что вы с нами! 💕\n\nПожалуйста, заполните небольшую форму — это поможет нам всё организовать наилучшим образом.\n\nНажмите на кнопку ниже."
+
+		// Отправляем текст с кнопкой Web App
+		if err := tg.sendWebApp(chatID, reply, b.siteURL, "🎊 Я приду!"); err != nil {
+			log.Printf("TG /start chat_id=%d: %v", chatID, err)
+		}
+		return
+	}
+
+	// Обработка /phone +79990000000
+	if strings.HasPrefix(text, "/phone ") {
+		phone := strings.TrimSpace(strings.TrimPrefix(text, "/phone "))
+		if phone != "" {
+			_ = b.users.save(tgUser{
+				ChatID: chatID,
+				Phone:  phone,
+				Name:   userName,
+			})
+			reply := fmt.Sprintf("✅ *Отлично!*\n\nВаш номер %s сохранён.\n\nТеперь, когда вы заполните форму RSVP, мы отправим вам приглашение здесь!", phone)
+			_ = tg.sendMessage(chatID, reply, "Markdown")
+		} else {
+			_ = tg.sendMessage(chatID, "❌ Пожалуйста, укажите номер после `/phone`", "")
+		}
+		return
+	}
+
+	// Обработка номера телефона в любом формате (сохраняем)
+	phoneDigits := normalizePhone(text)
+	if len(phoneDigits) >= 10 {
+		_ = b.users.save(tgUser{
+			ChatID: chatID,
+			Phone:  text,
+			Name:   userName,
+		})
+		reply := fmt.Sprintf("✅ *Отлично!*\n\nВаш номер %s сохранён.\n\nТеперь, когда вы заполните форму RSVP, мы отправим вам приглашение здесь!", text)
+		_ = tg.sendMessage(chatID, reply, "Markdown")
+	}
+}
+
+// Telegram webhook handler
+func handleTelegramWebhook(bot *tgBot, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// Запросы не от Telegram не знают секрета, заданного в setWebhook
+		if secret != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(secret)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxTgUpdateSize)
+		var update tgUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bot.handleUpdate(update)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// stateKeyTgOffset — ключ в stateStore со следующим offset для getUpdates.
+const stateKeyTgOffset = "telegram_update_offset"
+
+// tgPollTimeout — сколько Telegram держит запрос getUpdates, если обновлений нет.
+const tgPollTimeout = 50 * time.Second
+
+// runTelegramPolling получает обновления через getUpdates, пока не отменён ctx.
+// Offset сохраняется после обработки каждого обновления: если сервер упадёт посреди обработки, после
+// перезапуска это обновление придёт снова, а не потеряется (повтор безопасен: отмена и сохранение телефона
+// идемпотентны, в худшем случае гость получит ответ бота дважды).
+func runTelegramPolling(ctx context.Context, bot *tgBot, state stateStore, allowedUpdates []string) {
+	tg := bot.tg
+	// Пока у бота есть вебхук, getUpdates отвечает 409 Conflict
+	if err := tg.deleteWebhook(); err != nil {
+		log.Printf("TG deleteWebhook: %v", err)
+	}
+
+	var offset int64
+	if v, ok, err := state.get(stateKeyTgOffset); err != nil {
+		log.Printf("TG polling: не прочитать offset: %v", err)
+	} else if ok {
+		offset, _ = strconv.ParseInt(v, 10, 64)
+	}
+	log.Printf("TG: long polling запущен (offset=%d)", offset)
+
+	backoff := time.Second
+	for {
+		updates, err := tg.getUpdates(ctx, offset, tgPollTimeout, allowedUpdates)
+		if ctx.Err() != nil {
+			log.Printf("TG: long polling остановлен")
+			return
+		}
+		if err != nil {
+			log.Printf("TG getUpdates: %v (повтор через %s)", err, backoff)
+			select {
+			case <-ctx.Done():
+				log.Printf("TG: long polling остановлен")
+				return
+			case <-time.After(backoff):
+			}
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = time.Second
+
+		for _, u := range updates {
+			if u.UpdateID < offset {
+				continue
+			}
+			bot.handleUpdate(u)
+			offset = u.UpdateID + 1
+			if err := state.set(stateKeyTgOffset, strconv.FormatInt(offset, 10)); err != nil {
+				log.Printf("TG polling: не сохранить offset: %v", err)
+			}
+		}
+	}
+}
+
+// cancelRSVPByChatID отмечает RSVP, отправленные из этого чата, как «не придёт», и возвращает, сколько отменено.
+// Телефон из tg_users не учитывается: его гость вводит сам, и по нему можно было бы отменить чужой ответ.
+func cancelRSVPByChatID(rsvps rsvpStore, audit auditStore, chatID int64) (int, error) {
+	list, err := rsvps.list()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	cancelled := 0
+	for _, r := range list {
+		if r.TelegramChatID != nil && *r.TelegramChatID == chatID && r.attendance() != statusDeclined {
+			old := r
+			r.markDeclined(now)
+			r.recordRevision(revisionSourceCancelTelegram, diffRSVP(old, r, nil), now)
+			if err := rsvps.update(r); err != nil && err != errNotFound {
+				return cancelled, err
+			}
+			recordAudit(audit, auditEntry{Action: auditCancel, Channel: auditChannelTelegram, Actor: auditTelegramActor(chatID), Before: &old, After: &r})
+			cancelled++
+		}
+	}
+	return cancelled, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCancelRSVPByChatID(t *testing.T) {
+	st, err := openJSONStorage(filepath.Join(t.TempDir(), "rsvps.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.close()
+	chat, other := int64(100), int64(200)
+	st.rsvps.create(storedRSVP{ID: "own", Name: "Анна", Phone: "+7 999 000-00-01", TelegramChatID: &chat})
+	// чужой ответ с телефоном, который владелец чата 100 назвал боту
+	st.rsvps.create(storedRSVP{ID: "victim", Name: "Борис", Phone: "+7 999 000-00-02"})
+	st.rsvps.create(storedRSVP{ID: "other", Name: "Вера", TelegramChatID: &other})
+	st.tgUsers.save(tgUser{ChatID: chat, Phone: "+7 999 000-00-02"})
+
+	cancelled, err := cancelRSVPByChatID(st.rsvps, st.audit, chat)
+	if err != nil || cancelled != 1 {
+		t.Fatalf("cancelled %d, %v; want 1", cancelled, err)
+	}
+	for id, want := range map[string]string{"own": statusDeclined, "victim": statusAttending, "other": statusAttending} {
+		entry, _, _ := st.rsvps.get(id)
+		if entry.attendance() != want {
+			t.Errorf("%s: status %s, want %s", id, entry.attendance(), want)
+		}
+	}
+	if entry, _, _ := st.rsvps.get("own"); entry.CancelledAt == "" {
+		t.Error("cancelled_at is not set")
+	}
+	// повторное нажатие ничего не меняет
+	if cancelled, _ := cancelRSVPByChatID(st.rsvps, st.audit, chat); cancelled != 0 {
+		t.Fatalf("second cancel = %d", cancelled)
+	}
+}
+
+func TestTelegramWebhookLimitsBody(t *testing.T) {
+	h := handleTelegramWebhook(&tgBot{}, "s3cret")
+	body := `{"update_id":1,"message":{"chat":{"id":1},"text":"` + strings.Repeat("x", maxTgUpdateSize) + `"}}`
+	r := httptest.NewRequest(http.MethodPost, "/api/tg/webhook", strings.NewReader(body))
+	r.Header.Set("X-Telegram-Bot-Api-Secret-Token", "s3cret")
+	w := httptest.NewRecorder()
+	h(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("oversized update: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
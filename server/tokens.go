@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	errTokenInvalid = errors.New("invalid token")
+	errTokenExpired = errors.New("token expired")
+)
+
+// Назначение токена: ссылка «отменить» и ссылка «изменить ответ» из письма гостю, вход в панель управления.
+const (
+	tokenPurposeCancel = "cancel"
+	tokenPurposeEdit   = "edit"
+	tokenPurposeAdmin  = "admin"
+)
+
+// tokenSigner выдаёт и проверяет подписанные HMAC-SHA256 токены вида base64(payload).base64(sig).
+type tokenSigner struct {
+	key []byte
+}
+
+type tokenPayload struct {
+	Purpose string `json:"p"`
+	ID      string `json:"id"`
+	Exp     int64  `json:"exp"`
+}
+
+func (t *tokenSigner) sign(purpose, id string, exp time.Time) string {
+	payload, _ := json.Marshal(tokenPayload{Purpose: purpose, ID: id, Exp: exp.Unix()})
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + base64.RawURLEncoding.EncodeToString(t.mac(body))
+}
+
+// verify возвращает id записи, если подпись верна, назначение совпадает и срок не истёк.
+func (t *tokenSigner) verify(purpose, token string) (string, error) {
+	body, sig, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok || body == "" {
+		return "", errTokenInvalid
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, t.mac(body)) {
+		return "", errTokenInvalid
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return "", errTokenInvalid
+	}
+	var p tokenPayload
+	if err := json.Unmarshal(raw, &p); err != nil || p.Purpose != purpose || p.ID == "" {
+		return "", errTokenInvalid
+	}
+	if time.Now().Unix() > p.Exp {
+		return "", errTokenExpired
+	}
+	return p.ID, nil
+}
+
+func (t *tokenSigner) mac(body string) []byte {
+	m := hmac.New(sha256.New, t.key)
+	m.Write([]byte(body))
+	return m.Sum(nil)
+}
+
+// loadTokenSecret берёт секрет из env, иначе читает (или создаёт) файл со случайным ключом,
+// чтобы ссылки из уже отправленных писем переживали перезапуск.
+func loadTokenSecret(envSecret, path string) ([]byte, error) {
+	if envSecret != "" {
+		return []byte(envSecret), nil
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err == nil && len(key) >= 32 {
+			return key, nil
+		}
+		return nil, errors.New(path + ": неверный формат ключа")
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenVerify(t *testing.T) {
+	signer := &tokenSigner{key: []byte("test-key")}
+	other := &tokenSigner{key: []byte("other-key")}
+	valid := signer.sign(tokenPurposeCancel, "rsvp1", time.Now().Add(time.Hour))
+	body, sig, _ := strings.Cut(valid, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"p":"cancel","id":"rsvp2","exp":9999999999}`))
+
+	tests := []struct {
+		name    string
+		purpose string
+		token   string
+		wantID  string
+		wantErr error
+	}{
+		{"valid", tokenPurposeCancel, valid, "rsvp1", nil},
+		{"surrounding spaces", tokenPurposeCancel, " " + valid + "\n", "rsvp1", nil},
+		{"expired", tokenPurposeCancel, signer.sign(tokenPurposeCancel, "rsvp1", time.Now().Add(-time.Second)), "", errTokenExpired},
+		{"other purpose", "edit", valid, "", errTokenInvalid},
+		{"other key", tokenPurposeCancel, other.sign(tokenPurposeCancel, "rsvp1", time.Now().Add(time.Hour)), "", errTokenInvalid},
+		{"payload swapped", tokenPurposeCancel, forged + "." + sig, "", errTokenInvalid},
+		{"signature tampered", tokenPurposeCancel, body + "." + strings.Repeat("A", len(sig)), "", errTokenInvalid},
+		{"signature missing", tokenPurposeCancel, body, "", errTokenInvalid},
+		{"signature not base64", tokenPurposeCancel, body + ".!!!", "", errTokenInvalid},
+		{"empty", tokenPurposeCancel, "", "", errTokenInvalid},
+		{"empty id", tokenPurposeCancel, signer.sign(tokenPurposeCancel, "", time.Now().Add(time.Hour)), "", errTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := signer.verify(tt.purpose, tt.token)
+			if !errors.Is(err, tt.wantErr) || id != tt.wantID {
+				t.Fatalf("verify = %q, %v; want %q, %v", id, err, tt.wantID, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadTokenSecret(t *testing.T) {
+	path := t.TempDir() + "/token_secret"
+	key, err := loadTokenSecret("", path)
+	if err != nil || len(key) != 32 {
+		t.Fatalf("new key: %x, %v", key, err)
+	}
+	again, err := loadTokenSecret("", path)
+	if err != nil || string(again) != string(key) {
+		t.Fatalf("key is not persisted: %x, %v", again, err)
+	}
+	if env, err := loadTokenSecret("from-env", path); err != nil || string(env) != "from-env" {
+		t.Fatalf("env secret: %q, %v", env, err)
+	}
+}